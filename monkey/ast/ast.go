@@ -103,6 +103,7 @@ func (es *ExpressionStatement) String() string {
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
+	End        token.Token // The closing brace, or EOF if it is missing
 }
 
 func (bs *BlockStatement) StatementNode()       {}
@@ -184,6 +185,7 @@ func (fl *FunctionLiteral) String() string {
 type ArrayLiteral struct {
 	Token    token.Token
 	Elements []Expression
+	End      token.Token // The ] token
 }
 
 func (al *ArrayLiteral) ExpressionNode()      {}
@@ -206,6 +208,7 @@ func (al *ArrayLiteral) String() string {
 type HashLiteral struct {
 	Token token.Token
 	Pairs map[Expression]Expression
+	End   token.Token // The } token
 }
 
 func (hl *HashLiteral) ExpressionNode()      {}
@@ -294,6 +297,7 @@ type CallExpression struct {
 	Token     token.Token // The ( token
 	Function  Expression  // Identifier or FunctionLiteral
 	Arguments []Expression
+	End       token.Token // The ) token
 }
 
 func (ce *CallExpression) ExpressionNode()      {}
@@ -334,3 +338,63 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 
 }
+
+type MemberExpression struct {
+	Token  token.Token // The . token
+	Object Expression
+	Member *Identifier
+}
+
+func (me *MemberExpression) ExpressionNode()      {}
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MemberExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(me.Object.String())
+	out.WriteString(".")
+	out.WriteString(me.Member.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// Start returns the first token of a node, which for operations is not their
+// Token
+func Start(node Node) token.Token {
+	switch node := node.(type) {
+	case *LetStatement:
+		return node.Token
+	case *ReturnStatement:
+		return node.Token
+	case *ExpressionStatement:
+		return node.Token
+	case *InfixExpression:
+		return Start(node.Left)
+	case *CallExpression:
+		return Start(node.Function)
+	case *IndexExpression:
+		return Start(node.Left)
+	case *MemberExpression:
+		return Start(node.Object)
+	case *Identifier:
+		return node.Token
+	case *IntegerLiteral:
+		return node.Token
+	case *BooleanLiteral:
+		return node.Token
+	case *StringLiteral:
+		return node.Token
+	case *PrefixExpression:
+		return node.Token
+	case *IfExpression:
+		return node.Token
+	case *FunctionLiteral:
+		return node.Token
+	case *ArrayLiteral:
+		return node.Token
+	case *HashLiteral:
+		return node.Token
+	}
+	return token.Token{}
+}
@@ -0,0 +1,132 @@
+package ast
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Fprint writes the tree under node, a node per line indented below its
+// parent, with what sets it apart on the same line:
+//
+//	Program
+//	  LetStatement x
+//	    InfixExpression +
+//	      IntegerLiteral 1
+//	      Identifier y
+func Fprint(out io.Writer, node Node) error {
+	var tree strings.Builder
+	printNode(&tree, node, 0, "")
+	_, err := io.WriteString(out, tree.String())
+	return err
+}
+
+// Label says what part of its parent the node is, where that isn't clear
+func printNode(tree *strings.Builder, node Node, depth int, label string) {
+	line := func(format string, a ...interface{}) {
+		tree.WriteString(strings.Repeat("  ", depth))
+		if label != "" {
+			tree.WriteString(label + ": ")
+		}
+		fmt.Fprintf(tree, format, a...)
+		tree.WriteString("\n")
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		line("Program")
+		for _, statement := range node.Statements {
+			printNode(tree, statement, depth+1, "")
+		}
+	case *BlockStatement:
+		line("BlockStatement")
+		for _, statement := range node.Statements {
+			printNode(tree, statement, depth+1, "")
+		}
+	case *LetStatement:
+		line("LetStatement %s", node.Name.Value)
+		printNode(tree, node.Value, depth+1, "")
+	case *ReturnStatement:
+		line("ReturnStatement")
+		printNode(tree, node.ReturnValue, depth+1, "")
+	case *ExpressionStatement:
+		line("ExpressionStatement")
+		printNode(tree, node.Expression, depth+1, "")
+
+	case *Identifier:
+		line("Identifier %s", node.Value)
+	case *IntegerLiteral:
+		line("IntegerLiteral %d", node.Value)
+	case *BooleanLiteral:
+		line("BooleanLiteral %t", node.Value)
+	case *StringLiteral:
+		line("StringLiteral %s", strconv.Quote(node.Value))
+	case *FunctionLiteral:
+		parameters := make([]string, len(node.Parameters))
+		for i, parameter := range node.Parameters {
+			parameters[i] = parameter.Value
+		}
+		line("FunctionLiteral %s(%s)", node.Name, strings.Join(parameters, ", "))
+		printNode(tree, node.Body, depth+1, "")
+	case *ArrayLiteral:
+		line("ArrayLiteral")
+		for _, element := range node.Elements {
+			printNode(tree, element, depth+1, "")
+		}
+	case *HashLiteral:
+		line("HashLiteral")
+		for _, key := range sortedKeys(node) {
+			printNode(tree, key, depth+1, "key")
+			printNode(tree, node.Pairs[key], depth+1, "value")
+		}
+
+	case *PrefixExpression:
+		line("PrefixExpression %s", node.Operator)
+		printNode(tree, node.Right, depth+1, "")
+	case *InfixExpression:
+		line("InfixExpression %s", node.Operator)
+		printNode(tree, node.Left, depth+1, "")
+		printNode(tree, node.Right, depth+1, "")
+	case *IfExpression:
+		line("IfExpression")
+		printNode(tree, node.Condition, depth+1, "condition")
+		printNode(tree, node.Consequence, depth+1, "then")
+		if node.Alternative != nil {
+			printNode(tree, node.Alternative, depth+1, "else")
+		}
+	case *CallExpression:
+		line("CallExpression")
+		printNode(tree, node.Function, depth+1, "function")
+		for _, argument := range node.Arguments {
+			printNode(tree, argument, depth+1, "")
+		}
+	case *IndexExpression:
+		line("IndexExpression")
+		printNode(tree, node.Left, depth+1, "")
+		printNode(tree, node.Index, depth+1, "index")
+	case *MemberExpression:
+		line("MemberExpression %s", node.Member.Value)
+		printNode(tree, node.Object, depth+1, "")
+
+	case nil:
+		line("<missing>")
+	default:
+		line("%T", node)
+	}
+}
+
+// Pairs are kept in a map, so they are listed in the order of their keys in
+// the source
+func sortedKeys(hash *HashLiteral) []Expression {
+	keys := make([]Expression, 0, len(hash.Pairs))
+	for key := range hash.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := Start(keys[i]), Start(keys[j])
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return keys
+}
@@ -34,6 +34,7 @@ func main() {
 
 	var duration time.Duration
 	var result object.Object
+	var memory object.MemoryStats
 
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -59,16 +60,19 @@ func main() {
 
 		duration = time.Since(start)
 		result = machine.LastPoppedStackElem()
+		memory = machine.Runtime().MemoryStats()
 	} else {
 		env := object.NewEnvironment()
 		start := time.Now()
 		result = evaluator.Eval(program, env)
 		duration = time.Since(start)
+		memory = env.Runtime().MemoryStats()
 	}
 
 	fmt.Printf(
-		"engine=%s, result=%s, duration=%s\n",
+		"engine=%s, result=%s, duration=%s, memory=%s\n",
 		*engine,
 		result.Inspect(),
-		duration)
+		duration,
+		memory)
 }
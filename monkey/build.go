@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"monkey/compiler"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const precompiledExtension = ".mkc"
+
+func buildCommand(args []string) int {
+	flags := newFlagSet("monkey build")
+	output := flags.String("o", "", "write the bytecode to this file instead of file.mkc")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "monkey build: expected exactly one file")
+		flags.Usage()
+		return 2
+	}
+
+	path := flags.Arg(0)
+	if *output == "" {
+		*output = strings.TrimSuffix(path, filepath.Ext(path)) + precompiledExtension
+	}
+
+	err := build(path, *output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func build(path string, output string) error {
+	source, err := readSource(path)
+	if err != nil {
+		return err
+	}
+
+	program, err := parse(string(source))
+	if err != nil {
+		return err
+	}
+
+	comp := compiler.New()
+	err = comp.Compile(program)
+	if err != nil {
+		return fmt.Errorf("compile error: %s", err)
+	}
+
+	data, err := comp.Bytecode().MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(output, data, 0o644)
+}
@@ -0,0 +1,166 @@
+package code
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Assembler turns listings in the format printed by Instructions.String back
+// into instructions, one line at a time. Besides instructions it accepts
+//
+//	name:       a label, usable in place of an operand for the offset that follows
+//	12| ...     a source line, attributed to the instructions that follow
+//	; ...       a comment, also allowed after an instruction
+//
+// Leading offsets are ignored, so edited listings don't need renumbering
+type Assembler struct {
+	instructions Instructions
+	lines        LineTable
+	labels       map[string]int
+	fixups       []fixup
+	line         int // Line of the listing being assembled, for errors
+}
+
+// Operand that names a label, patched once every label is known
+type fixup struct {
+	label  string
+	offset int
+	width  int
+	line   int
+}
+
+var (
+	labelPattern      = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*):$`)
+	sourceLinePattern = regexp.MustCompile(`^(\d+)\|`)
+	offsetPattern     = regexp.MustCompile(`^\d+$`)
+)
+
+func NewAssembler() *Assembler {
+	return &Assembler{labels: make(map[string]int)}
+}
+
+// Assemble parses a complete listing
+func Assemble(listing string) (Instructions, error) {
+	assembler := NewAssembler()
+	for i, line := range strings.Split(listing, "\n") {
+		err := assembler.Line(i+1, line)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	instructions, _, err := assembler.Finish()
+	return instructions, err
+}
+
+// Line assembles one line of a listing, number is only used in errors
+func (assembler *Assembler) Line(number int, text string) error {
+	assembler.line = number
+
+	text = strings.TrimSpace(text)
+	if match := sourceLinePattern.FindStringSubmatch(text); match != nil {
+		line, _ := strconv.Atoi(match[1])
+		assembler.lines = assembler.lines.Add(len(assembler.instructions), line)
+		return nil
+	}
+
+	if i := strings.Index(text, ";"); i >= 0 {
+		text = strings.TrimSpace(text[:i])
+	}
+	if text == "" {
+		return nil
+	}
+
+	if match := labelPattern.FindStringSubmatch(text); match != nil {
+		if _, ok := assembler.labels[match[1]]; ok {
+			return assembler.errorf("label %s already defined", match[1])
+		}
+		assembler.labels[match[1]] = len(assembler.instructions)
+		return nil
+	}
+
+	fields := strings.Fields(text)
+	if offsetPattern.MatchString(fields[0]) {
+		fields = fields[1:]
+	}
+	// Printed by the disassembler for labels at the very end
+	if len(fields) == 1 && fields[0] == "(end)" {
+		return nil
+	}
+	if len(fields) == 0 {
+		return assembler.errorf("missing instruction")
+	}
+
+	op, ok := lookupName(fields[0])
+	if !ok {
+		return assembler.errorf("unknown instruction %s", fields[0])
+	}
+	def := definitions[op]
+
+	operands := fields[1:]
+	if len(operands) != len(def.OperandWidths) {
+		return assembler.errorf("%s takes %d operands, got %d", def.Name, len(def.OperandWidths), len(operands))
+	}
+
+	values := make([]int, len(operands))
+	offset := len(assembler.instructions) + 1
+	for i, operand := range operands {
+		width := def.OperandWidths[i]
+
+		if labelPattern.MatchString(operand + ":") {
+			assembler.fixups = append(assembler.fixups, fixup{operand, offset, width, assembler.line})
+		} else {
+			value, err := strconv.Atoi(operand)
+			if err != nil || value < 0 || value >= 1<<(8*width) {
+				return assembler.errorf("invalid operand %s for %s", operand, def.Name)
+			}
+			values[i] = value
+		}
+		offset += width
+	}
+
+	assembler.instructions = append(assembler.instructions, Make(op, values...)...)
+	return nil
+}
+
+// Finish resolves the labels and returns the assembled instructions along with
+// the source lines given in the listing
+func (assembler *Assembler) Finish() (Instructions, LineTable, error) {
+	for _, fixup := range assembler.fixups {
+		target, ok := assembler.labels[fixup.label]
+		if !ok {
+			return nil, nil, fmt.Errorf("line %d: undefined label %s", fixup.line, fixup.label)
+		}
+		if target >= 1<<(8*fixup.width) {
+			return nil, nil, fmt.Errorf("line %d: label %s out of range", fixup.line, fixup.label)
+		}
+
+		switch fixup.width {
+		case 2:
+			assembler.instructions[fixup.offset] = byte(target >> 8)
+			assembler.instructions[fixup.offset+1] = byte(target)
+		case 1:
+			assembler.instructions[fixup.offset] = byte(target)
+		}
+	}
+
+	if assembler.instructions == nil {
+		assembler.instructions = Instructions{}
+	}
+	return assembler.instructions, assembler.lines, nil
+}
+
+func (assembler *Assembler) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("line %d: %s", assembler.line, fmt.Sprintf(format, a...))
+}
+
+func lookupName(name string) (Opcode, bool) {
+	for op, def := range definitions {
+		if def.Name == name {
+			return op, true
+		}
+	}
+	return 0, false
+}
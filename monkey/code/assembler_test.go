@@ -0,0 +1,102 @@
+package code
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAssemble(t *testing.T) {
+	listing := `
+; adds one until the top of the stack is 10
+0000 OpConstant 1
+loop:
+     OpConstant 0          ; comments are ignored
+     OpAdd
+     OpJumpNotTruthy done
+0011 OpJump loop
+done:
+     OpClosure 65535 255
+`
+
+	expected := Instructions{}
+	for _, ins := range [][]byte{
+		Make(OpConstant, 1),
+		Make(OpConstant, 0),
+		Make(OpAdd),
+		Make(OpJumpNotTruthy, 13),
+		Make(OpJump, 3),
+		Make(OpClosure, 65535, 255),
+	} {
+		expected = append(expected, ins...)
+	}
+
+	instructions, err := Assemble(listing)
+	if err != nil {
+		t.Fatalf("assemble error: %s", err)
+	}
+	if !bytes.Equal(instructions, expected) {
+		t.Errorf("wrong instructions.\nwant=%q\ngot =%q", expected.String(), instructions.String())
+	}
+
+	roundTrip, err := Assemble(expected.String())
+	if err != nil {
+		t.Fatalf("assemble error: %s", err)
+	}
+	if !bytes.Equal(roundTrip, expected) {
+		t.Errorf("String output does not round trip.\nwant=%q\ngot =%q", expected.String(), roundTrip.String())
+	}
+}
+
+func TestAssembleSourceLines(t *testing.T) {
+	listing := `
+    1| let a = 1;
+     OpConstant 0
+     OpSetGlobal 0
+    3| a
+     OpGetGlobal 0
+     OpPop`
+
+	assembler := NewAssembler()
+	for i, line := range bytes.Split([]byte(listing), []byte("\n")) {
+		if err := assembler.Line(i+1, string(line)); err != nil {
+			t.Fatalf("assemble error: %s", err)
+		}
+	}
+
+	_, lines, err := assembler.Finish()
+	if err != nil {
+		t.Fatalf("assemble error: %s", err)
+	}
+
+	expected := LineTable{{0, 1}, {6, 3}}
+	if len(lines) != len(expected) || lines[0] != expected[0] || lines[1] != expected[1] {
+		t.Errorf("wrong lines. want=%v, got=%v", expected, lines)
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		listing  string
+		expected string
+	}{
+		{"OpPush 1", "line 1: unknown instruction OpPush"},
+		{"OpPop\nOpConstant", "line 2: OpConstant takes 1 operands, got 0"},
+		{"OpPop 1", "line 1: OpPop takes 0 operands, got 1"},
+		{"OpGetLocal 256", "line 1: invalid operand 256 for OpGetLocal"},
+		{"OpConstant -1", "line 1: invalid operand -1 for OpConstant"},
+		{"a:\nOpPop\na:", "line 3: label a already defined"},
+		{"OpPop\n\nOpJump nowhere", "line 3: undefined label nowhere"},
+		{"0004", "line 1: missing instruction"},
+	}
+
+	for _, tt := range tests {
+		_, err := Assemble(tt.listing)
+		if err == nil {
+			t.Errorf("%q: expected an error", tt.listing)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.listing, tt.expected, err)
+		}
+	}
+}
@@ -41,6 +41,7 @@ const (
 	OpClosure
 	OpGetFree
 	OpCurrentClosure
+	OpTryCall // Like OpCall, but an error returned by a builtin is pushed rather than stopping the VM
 )
 
 type Definition struct {
@@ -79,6 +80,7 @@ var definitions = map[Opcode]*Definition{
 	OpClosure:        {"OpClosure", []int{2, 1}}, // {constantIndex, freeVariableCount}
 	OpGetFree:        {"OpGetFree", []int{1}},
 	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpTryCall:        {"OpTryCall", []int{1}},
 }
 
 func Lookup(op byte) (*Definition, error) {
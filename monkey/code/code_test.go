@@ -88,3 +88,40 @@ func TestReadOperands(t *testing.T) {
 		}
 	}
 }
+
+func TestLineTable(t *testing.T) {
+	var table LineTable
+	table = table.Add(0, 1)
+	table = table.Add(3, 1) // Same line, dropped
+	table = table.Add(6, 2) // Replaced by the next entry
+	table = table.Add(6, 4)
+	table = table.Add(10, 5) // Replaced by line 4, which merges into the previous entry
+	table = table.Add(10, 4)
+	table = table.Add(12, 1)
+
+	expected := LineTable{{0, 1}, {6, 4}, {12, 1}}
+	if len(table) != len(expected) {
+		t.Fatalf("wrong table. want=%v, got=%v", expected, table)
+	}
+	for i := range expected {
+		if table[i] != expected[i] {
+			t.Fatalf("wrong table. want=%v, got=%v", expected, table)
+		}
+	}
+
+	tests := []struct {
+		offset   int
+		expected int
+	}{
+		{0, 1}, {5, 1}, {6, 4}, {11, 4}, {12, 1}, {100, 1},
+	}
+	for _, tt := range tests {
+		if line := table.Line(tt.offset); line != tt.expected {
+			t.Errorf("wrong line for offset %d. want=%d, got=%d", tt.offset, tt.expected, line)
+		}
+	}
+
+	if line := LineTable(nil).Line(0); line != 0 {
+		t.Errorf("empty table should not know any lines, got=%d", line)
+	}
+}
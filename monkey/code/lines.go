@@ -0,0 +1,41 @@
+package code
+
+import "sort"
+
+// LineTable maps instruction offsets back to source lines. Entries are sorted
+// by offset and each one covers the instructions up to the next entry
+type LineTable []LineEntry
+
+type LineEntry struct {
+	Offset int
+	Line   int
+}
+
+// Add records that the instructions from offset on came from line. Entries
+// that would not change the line are dropped, and an entry at the same offset
+// as the last one replaces it
+func (table LineTable) Add(offset int, line int) LineTable {
+	if len(table) > 0 {
+		last := &table[len(table)-1]
+		if last.Offset == offset {
+			last.Line = line
+			if len(table) > 1 && table[len(table)-2].Line == line {
+				return table[:len(table)-1]
+			}
+			return table
+		}
+		if last.Line == line {
+			return table
+		}
+	}
+	return append(table, LineEntry{Offset: offset, Line: line})
+}
+
+// Line returns the source line of the instruction at offset, or 0 if unknown
+func (table LineTable) Line(offset int) int {
+	i := sort.Search(len(table), func(i int) bool { return table[i].Offset > offset })
+	if i == 0 {
+		return 0
+	}
+	return table[i-1].Line
+}
@@ -0,0 +1,185 @@
+package compiler
+
+import (
+	"fmt"
+	"monkey/code"
+	"monkey/object"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	functionHeaderPattern = regexp.MustCompile(`^fn (\S+) \[constant (\d+), (\d+) params, (\d+) locals\]:$`)
+	constantPattern       = regexp.MustCompile(`^(\d+)\s+(.*)$`)
+)
+
+// Assemble builds bytecode from a listing in the format printed by `monkey
+// disasm`. Instructions before any header belong to the main program, and the
+// other sections look like
+//
+//	fn add [constant 0, 2 params, 2 locals]:
+//	    locals: a b             names for the debugger, - for none
+//	    free: x
+//	    OpGetLocal 0
+//	    ...
+//	constants:
+//	    0  fn add
+//	    1  42
+//	    2  "a string"
+//
+// See code.Assembler for the instruction syntax
+func Assemble(listing string) (*Bytecode, error) {
+	main := code.NewAssembler()
+	current := main
+	var currentFn *object.CompiledFunction
+
+	type function struct {
+		fn        *object.CompiledFunction
+		assembler *code.Assembler
+	}
+	functions := map[int]function{}
+	constants := map[int]object.Object{}
+	declared := map[int]bool{} // Functions named in the constants section
+	inConstants := false
+
+	for i, text := range strings.Split(listing, "\n") {
+		number := i + 1
+		trimmed := strings.TrimSpace(text)
+
+		if trimmed == "main:" {
+			current, currentFn, inConstants = main, nil, false
+			continue
+		}
+		if trimmed == "constants:" {
+			currentFn, inConstants = nil, true
+			continue
+		}
+		if match := functionHeaderPattern.FindStringSubmatch(trimmed); match != nil {
+			index, _ := strconv.Atoi(match[2])
+			if _, ok := functions[index]; ok {
+				return nil, fmt.Errorf("line %d: constant %d already defined", number, index)
+			}
+
+			fn := &object.CompiledFunction{}
+			fn.NumParameters, _ = strconv.Atoi(match[3])
+			fn.NumLocals, _ = strconv.Atoi(match[4])
+			if match[1] != "<anonymous>" {
+				fn.Name = match[1]
+			}
+
+			current, currentFn, inConstants = code.NewAssembler(), fn, false
+			functions[index] = function{fn, current}
+			continue
+		}
+
+		if currentFn != nil {
+			if names, ok := strings.CutPrefix(trimmed, "locals:"); ok {
+				currentFn.LocalNames = parseNames(names)
+				continue
+			}
+			if names, ok := strings.CutPrefix(trimmed, "free:"); ok {
+				currentFn.FreeNames = parseNames(names)
+				continue
+			}
+		}
+
+		if !inConstants {
+			err := current.Line(number, text)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if trimmed == "" || strings.HasPrefix(trimmed, ";") {
+			continue
+		}
+		match := constantPattern.FindStringSubmatch(trimmed)
+		if match == nil {
+			return nil, fmt.Errorf("line %d: expected an index followed by a constant", number)
+		}
+		index, _ := strconv.Atoi(match[1])
+		if _, ok := constants[index]; ok || declared[index] {
+			return nil, fmt.Errorf("line %d: constant %d already defined", number, index)
+		}
+
+		value, err := parseConstant(match[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", number, err)
+		}
+		if value == nil {
+			declared[index] = true
+		} else {
+			constants[index] = value
+		}
+	}
+
+	for index, function := range functions {
+		if _, ok := constants[index]; ok {
+			return nil, fmt.Errorf("constant %d is both a function and a value", index)
+		}
+
+		instructions, lines, err := function.assembler.Finish()
+		if err != nil {
+			return nil, err
+		}
+		function.fn.Instructions = instructions
+		function.fn.Lines = lines
+		constants[index] = function.fn
+	}
+	for index := range declared {
+		if _, ok := functions[index]; !ok {
+			return nil, fmt.Errorf("constant %d: missing function body", index)
+		}
+	}
+
+	pool := make([]object.Object, len(constants))
+	for index, constant := range constants {
+		if index >= len(pool) {
+			return nil, fmt.Errorf("constant %d: constants must be numbered from 0 without gaps", index)
+		}
+		pool[index] = constant
+	}
+
+	instructions, lines, err := main.Finish()
+	if err != nil {
+		return nil, err
+	}
+	return &Bytecode{Instructions: instructions, Constants: pool, Lines: lines}, nil
+}
+
+func parseNames(text string) []string {
+	names := strings.Fields(text)
+	for i, name := range names {
+		if name == "-" {
+			names[i] = ""
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return names
+}
+
+// Returns nil for functions, whose bodies have their own section
+func parseConstant(text string) (object.Object, error) {
+	text = strings.TrimSpace(text)
+
+	switch {
+	case strings.HasPrefix(text, "fn "):
+		return nil, nil
+	case strings.HasPrefix(text, `"`):
+		value, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid string constant %s", text)
+		}
+		return &object.String{Value: value}, nil
+	default:
+		value, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid constant %s", text)
+		}
+		return &object.Integer{Value: value}, nil
+	}
+}
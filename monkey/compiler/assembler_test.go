@@ -0,0 +1,86 @@
+package compiler
+
+import (
+	"monkey/code"
+	"strings"
+	"testing"
+)
+
+func TestAssemble(t *testing.T) {
+	listing := `
+main:
+    OpClosure 1 0
+    OpConstant 0
+    OpCall 1
+    OpPop
+
+fn <anonymous> [constant 1, 1 params, 1 locals]:
+    OpGetLocal 0
+    OpConstant 2
+    OpAdd
+    OpReturnValue
+
+constants:
+    0  -41
+    1  fn <anonymous>
+    2  "a;\n"
+`
+
+	bytecode, err := Assemble(listing)
+	if err != nil {
+		t.Fatalf("assemble error: %s", err)
+	}
+
+	err = testInstructions([]code.Instructions{
+		code.Make(code.OpClosure, 1, 0),
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpCall, 1),
+		code.Make(code.OpPop),
+	}, bytecode.Instructions)
+	if err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+
+	err = testConstants(t, []interface{}{
+		-41,
+		[]code.Instructions{
+			code.Make(code.OpGetLocal, 0),
+			code.Make(code.OpConstant, 2),
+			code.Make(code.OpAdd),
+			code.Make(code.OpReturnValue),
+		},
+		"a;\n",
+	}, bytecode.Constants)
+	if err != nil {
+		t.Fatalf("testConstants failed: %s", err)
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		listing  string
+		expected string
+	}{
+		{"OpConstant 0\nOpBogus", "line 2: unknown instruction OpBogus"},
+		{"fn f [constant 0, 0 params, 0 locals]:\n  OpReturn\nfn g [constant 0, 0 params, 0 locals]:", "line 3: constant 0 already defined"},
+		{"constants:\n  0 1\n  0 2", "line 3: constant 0 already defined"},
+		{"constants:\n  1", "line 2: expected an index followed by a constant"},
+		{"constants:\n  0 one", "line 2: invalid constant one"},
+		{"constants:\n  0 \"open", "line 2: invalid string constant \"open"},
+		{"constants:\n  0 fn f", "constant 0: missing function body"},
+		{"constants:\n  1 1", "constant 1: constants must be numbered from 0 without gaps"},
+		{"fn f [constant 0, 0 params, 0 locals]:\nconstants:\n  0 1", "constant 0 is both a function and a value"},
+		{"fn f [constant 0, 0 params, 0 locals]:\n  OpJump end", "line 2: undefined label end"},
+	}
+
+	for _, tt := range tests {
+		_, err := Assemble(tt.listing)
+		if err == nil {
+			t.Errorf("%q: expected an error", tt.listing)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.listing, tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"monkey/code"
+	"monkey/object"
+)
+
+// Precompiled .mkc files start with Magic followed by a big endian uint16
+// FormatVersion. The rest is the main instructions and then the constant pool,
+// with all lengths and integers stored as varints:
+//
+//	program      := instructions lines constants
+//	instructions := length bytes
+//	lines        := count (offsetDelta lineDelta)*
+//	constants    := count constant*
+//	constant     := tag (integer: varint | string: length bytes |
+//	                     function: name numLocals numParameters instructions lines
+//	                               localNames freeNames)
+//	names        := count (length bytes)*
+//
+// Bump FormatVersion whenever this layout or the instruction set changes
+const Magic = "MKC\x1a"
+const FormatVersion uint16 = 4
+
+const (
+	tagInteger byte = iota + 1
+	tagString
+	tagCompiledFunction
+)
+
+var ErrInvalidBytecode = errors.New("invalid bytecode")
+
+func IsPrecompiled(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Magic))
+}
+
+func (bytecode *Bytecode) MarshalBinary() ([]byte, error) {
+	var out bytes.Buffer
+
+	out.WriteString(Magic)
+	binary.Write(&out, binary.BigEndian, FormatVersion)
+
+	writeBytes(&out, bytecode.Instructions)
+	writeLines(&out, bytecode.Lines)
+
+	writeUvarint(&out, uint64(len(bytecode.Constants)))
+	for i, constant := range bytecode.Constants {
+		switch constant := constant.(type) {
+		case *object.Integer:
+			out.WriteByte(tagInteger)
+			writeVarint(&out, constant.Value)
+		case *object.String:
+			out.WriteByte(tagString)
+			writeBytes(&out, []byte(constant.Value))
+		case *object.CompiledFunction:
+			out.WriteByte(tagCompiledFunction)
+			writeBytes(&out, []byte(constant.Name))
+			writeUvarint(&out, uint64(constant.NumLocals))
+			writeUvarint(&out, uint64(constant.NumParameters))
+			writeBytes(&out, constant.Instructions)
+			writeLines(&out, constant.Lines)
+			writeNames(&out, constant.LocalNames)
+			writeNames(&out, constant.FreeNames)
+		default:
+			return nil, fmt.Errorf("cannot serialise constant %d of type %s", i, constant.Type())
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+func (bytecode *Bytecode) UnmarshalBinary(data []byte) error {
+	if !IsPrecompiled(data) {
+		return fmt.Errorf("%w: missing %q header", ErrInvalidBytecode, Magic)
+	}
+	in := &bytecodeReader{data: data, pos: len(Magic)}
+
+	version := in.uint16()
+	if in.err == nil && version != FormatVersion {
+		return fmt.Errorf("%w: format version %d, want %d", ErrInvalidBytecode, version, FormatVersion)
+	}
+
+	instructions := in.bytes()
+	lines := in.lines()
+
+	numConstants := in.count()
+	constants := make([]object.Object, 0, numConstants)
+	for i := 0; i < numConstants && in.err == nil; i++ {
+		switch tag := in.byte(); tag {
+		case tagInteger:
+			constants = append(constants, &object.Integer{Value: in.varint()})
+		case tagString:
+			constants = append(constants, &object.String{Value: string(in.bytes())})
+		case tagCompiledFunction:
+			fn := &object.CompiledFunction{}
+			fn.Name = string(in.bytes())
+			fn.NumLocals = in.int()
+			fn.NumParameters = in.int()
+			fn.Instructions = in.bytes()
+			fn.Lines = in.lines()
+			fn.LocalNames = in.names()
+			fn.FreeNames = in.names()
+			constants = append(constants, fn)
+		default:
+			in.fail("unknown constant tag %d", tag)
+		}
+	}
+
+	if in.err == nil && in.pos != len(data) {
+		in.fail("%d trailing bytes", len(data)-in.pos)
+	}
+	if in.err != nil {
+		return in.err
+	}
+
+	bytecode.Instructions = instructions
+	bytecode.Constants = constants
+	bytecode.Lines = lines
+	return nil
+}
+
+func writeUvarint(out *bytes.Buffer, value uint64) {
+	out.Write(binary.AppendUvarint(nil, value))
+}
+
+func writeVarint(out *bytes.Buffer, value int64) {
+	out.Write(binary.AppendVarint(nil, value))
+}
+
+func writeBytes(out *bytes.Buffer, value []byte) {
+	writeUvarint(out, uint64(len(value)))
+	out.Write(value)
+}
+
+// Offsets only grow, lines mostly do, so both are stored as deltas to keep
+// them to a byte each
+func writeLines(out *bytes.Buffer, lines code.LineTable) {
+	writeUvarint(out, uint64(len(lines)))
+	previous := code.LineEntry{}
+	for _, entry := range lines {
+		writeUvarint(out, uint64(entry.Offset-previous.Offset))
+		writeVarint(out, int64(entry.Line-previous.Line))
+		previous = entry
+	}
+}
+
+func writeNames(out *bytes.Buffer, names []string) {
+	writeUvarint(out, uint64(len(names)))
+	for _, name := range names {
+		writeBytes(out, []byte(name))
+	}
+}
+
+// Reads the values written above, remembering the first error so callers only
+// need to check once at the end
+type bytecodeReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (in *bytecodeReader) fail(format string, a ...interface{}) {
+	if in.err == nil {
+		msg := fmt.Sprintf(format, a...)
+		in.err = fmt.Errorf("%w: %s at offset %d", ErrInvalidBytecode, msg, in.pos)
+	}
+}
+
+func (in *bytecodeReader) byte() byte {
+	if in.err != nil || in.pos >= len(in.data) {
+		in.fail("unexpected end of data")
+		return 0
+	}
+	b := in.data[in.pos]
+	in.pos++
+	return b
+}
+
+func (in *bytecodeReader) uint16() uint16 {
+	if in.err != nil || in.pos+2 > len(in.data) {
+		in.fail("unexpected end of data")
+		return 0
+	}
+	value := binary.BigEndian.Uint16(in.data[in.pos:])
+	in.pos += 2
+	return value
+}
+
+func (in *bytecodeReader) uvarint() uint64 {
+	if in.err != nil {
+		return 0
+	}
+	value, n := binary.Uvarint(in.data[in.pos:])
+	if n <= 0 {
+		in.fail("malformed varint")
+		return 0
+	}
+	in.pos += n
+	return value
+}
+
+func (in *bytecodeReader) varint() int64 {
+	if in.err != nil {
+		return 0
+	}
+	value, n := binary.Varint(in.data[in.pos:])
+	if n <= 0 {
+		in.fail("malformed varint")
+		return 0
+	}
+	in.pos += n
+	return value
+}
+
+func (in *bytecodeReader) int() int {
+	value := in.uvarint()
+	if value > math.MaxInt32 {
+		in.fail("value %d out of range", value)
+		return 0
+	}
+	return int(value)
+}
+
+// Counts and lengths can never exceed the remaining data, checking that keeps
+// corrupt input from causing huge allocations
+func (in *bytecodeReader) count() int {
+	value := in.uvarint()
+	if value > uint64(len(in.data)-in.pos) {
+		in.fail("length %d exceeds remaining data", value)
+		return 0
+	}
+	return int(value)
+}
+
+func (in *bytecodeReader) bytes() code.Instructions {
+	length := in.count()
+	if in.err != nil {
+		return nil
+	}
+	value := make([]byte, length)
+	copy(value, in.data[in.pos:])
+	in.pos += length
+	return value
+}
+
+func (in *bytecodeReader) lines() code.LineTable {
+	// Every entry takes at least two bytes
+	count := in.count()
+	if count == 0 || in.err != nil {
+		return nil
+	}
+
+	lines := make(code.LineTable, count)
+	previous := code.LineEntry{}
+	for i := range lines {
+		offset := previous.Offset + in.int()
+		line := previous.Line + int(in.varint())
+		if in.err != nil {
+			return nil
+		}
+		lines[i] = code.LineEntry{Offset: offset, Line: line}
+		previous = lines[i]
+	}
+	return lines
+}
+
+func (in *bytecodeReader) names() []string {
+	// Every name takes at least a byte for its length
+	count := in.count()
+	if count == 0 || in.err != nil {
+		return nil
+	}
+
+	names := make([]string, count)
+	for i := range names {
+		names[i] = string(in.bytes())
+	}
+	return names
+}
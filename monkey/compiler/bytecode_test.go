@@ -0,0 +1,116 @@
+package compiler
+
+import (
+	"bytes"
+	"errors"
+	"monkey/object"
+	"reflect"
+	"testing"
+)
+
+func compile(t *testing.T, input string) *Bytecode {
+	t.Helper()
+
+	compiler := New()
+	err := compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return compiler.Bytecode()
+}
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	inputs := []string{
+		"",
+		"1 + 2; -9223372036854775807 - 1",
+		`"monkey" + ""`,
+		`let add = fn(a, b) { let c = a + b; c }; add(1, 2)`,
+		"let adder = fn(x) {\n  fn(y) {\n    fn(z) { x + y + z }\n  }\n};\nadder(1)(2)(3)",
+		`let m = {"one": [1, 2], "two": fn() { puts("two") }}; m.one[0]`,
+	}
+
+	for _, input := range inputs {
+		bytecode := compile(t, input)
+
+		data, err := bytecode.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%q: marshal error: %s", input, err)
+		}
+		if !IsPrecompiled(data) {
+			t.Fatalf("%q: output does not start with the magic header", input)
+		}
+
+		decoded := &Bytecode{}
+		err = decoded.UnmarshalBinary(data)
+		if err != nil {
+			t.Fatalf("%q: unmarshal error: %s", input, err)
+		}
+
+		if !bytes.Equal(decoded.Instructions, bytecode.Instructions) {
+			t.Errorf("%q: wrong instructions.\nwant=%q\ngot =%q",
+				input, bytecode.Instructions, decoded.Instructions)
+		}
+		if !reflect.DeepEqual(decoded.Lines, bytecode.Lines) {
+			t.Errorf("%q: wrong lines. want=%v, got=%v", input, bytecode.Lines, decoded.Lines)
+		}
+		if !reflect.DeepEqual(decoded.Constants, bytecode.Constants) {
+			t.Errorf("%q: wrong constants.\nwant=%#v\ngot =%#v",
+				input, bytecode.Constants, decoded.Constants)
+		}
+	}
+}
+
+func TestInvalidBytecode(t *testing.T) {
+	data, err := compile(t, `let f = fn(x) { x + "a" }; f(1)`).MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal error: %s", err)
+	}
+
+	badVersion := append([]byte{}, data...)
+	badVersion[len(Magic)+1]++
+
+	unknownTag := append([]byte{}, data...)
+	// The integer 1 is the last constant, its tag sits right before its value
+	unknownTag[len(unknownTag)-2] = 99
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"empty", nil, `invalid bytecode: missing "MKC\x1a" header`},
+		{"source", []byte("let a = 1;"), `invalid bytecode: missing "MKC\x1a" header`},
+		{"version", badVersion, "invalid bytecode: format version 5, want 4"},
+		{"header only", data[:len(Magic)+2], "invalid bytecode: malformed varint at offset 6"},
+		{"truncated", data[:len(data)-1], "invalid bytecode: malformed varint at offset"},
+		{"unknown tag", unknownTag, "invalid bytecode: unknown constant tag 99"},
+		{"trailing", append(append([]byte{}, data...), 0), "invalid bytecode: 1 trailing bytes"},
+	}
+
+	for _, tt := range tests {
+		bytecode := &Bytecode{}
+		err := bytecode.UnmarshalBinary(tt.data)
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+			continue
+		}
+		if !errors.Is(err, ErrInvalidBytecode) {
+			t.Errorf("%s: error does not wrap ErrInvalidBytecode: %s", tt.name, err)
+		}
+		if !bytes.HasPrefix([]byte(err.Error()), []byte(tt.expected)) {
+			t.Errorf("%s: wrong error. want prefix %q, got=%q", tt.name, tt.expected, err)
+		}
+		if bytecode.Instructions != nil || bytecode.Constants != nil {
+			t.Errorf("%s: bytecode modified despite the error", tt.name)
+		}
+	}
+}
+
+func TestMarshalUnsupportedConstant(t *testing.T) {
+	bytecode := &Bytecode{Constants: []object.Object{&object.Boolean{Value: true}}}
+
+	_, err := bytecode.MarshalBinary()
+	if err == nil || err.Error() != "cannot serialise constant 0 of type BOOLEAN" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"monkey/ast"
 	"monkey/code"
 	"monkey/object"
+	"monkey/token"
 	"sort"
 )
 
@@ -18,6 +19,17 @@ type Compiler struct {
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	Lines        code.LineTable // Source lines of the main instructions
+}
+
+// Error is a compile error at the token of the node that caused it
+type Error struct {
+	Message string
+	Token   token.Token
+}
+
+func (err *Error) Error() string {
+	return err.Message
 }
 
 type EmittedInstruction struct {
@@ -29,6 +41,7 @@ type CompilationScope struct {
 	instructions           code.Instructions
 	lastInstruction        EmittedInstruction
 	penultimateInstruction EmittedInstruction
+	lines                  code.LineTable
 }
 
 func New() *Compiler {
@@ -67,12 +80,15 @@ func (compiler *Compiler) Compile(node ast.Node) error {
 		}
 
 	case *ast.LetStatement:
-		// Define before compiling node to allow for recursive functions
-		symbol := compiler.symbolTable.Define(node.Name.Value)
+		compiler.markLine(node.Token)
+
+		// Functions refer to their own name through FunctionScope, so the value
+		// is compiled first and sees any outer binding it shadows, like `let a = a + 1`
 		err := compiler.Compile(node.Value)
 		if err != nil {
 			return err
 		}
+		symbol := compiler.symbolTable.Define(node.Name.Value)
 
 		if symbol.Scope == GlobalScope {
 			compiler.emit(code.OpSetGlobal, symbol.Index)
@@ -89,6 +105,8 @@ func (compiler *Compiler) Compile(node ast.Node) error {
 		}
 
 	case *ast.ReturnStatement:
+		compiler.markLine(node.Token)
+
 		err := compiler.Compile(node.ReturnValue)
 		if err != nil {
 			return err
@@ -97,6 +115,8 @@ func (compiler *Compiler) Compile(node ast.Node) error {
 		compiler.emit(code.OpReturnValue)
 
 	case *ast.ExpressionStatement:
+		compiler.markLine(node.Token)
+
 		err := compiler.Compile(node.Expression)
 		if err != nil {
 			return err
@@ -115,7 +135,7 @@ func (compiler *Compiler) Compile(node ast.Node) error {
 		case "-":
 			compiler.emit(code.OpMinus)
 		default:
-			return fmt.Errorf("unknown operator %s", node.Operator)
+			return &Error{fmt.Sprintf("unknown operator %s", node.Operator), node.Token}
 		}
 
 	case *ast.InfixExpression:
@@ -159,7 +179,7 @@ func (compiler *Compiler) Compile(node ast.Node) error {
 		case "!=":
 			compiler.emit(code.OpNotEqual)
 		default:
-			return fmt.Errorf("unknown operator %s", node.Operator)
+			return &Error{fmt.Sprintf("unknown operator %s", node.Operator), node.Token}
 		}
 
 	case *ast.IfExpression:
@@ -168,6 +188,10 @@ func (compiler *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 
+		// The jump deciding the branch belongs to the line of the if, which
+		// is how coverage tells branches apart
+		compiler.markLine(node.Token)
+
 		// Emit OpJumpNotTruthy with bogus value, we will backpatch later
 		jumpNotTruthyPos := compiler.emit(code.OpJumpNotTruthy, 9999)
 
@@ -176,9 +200,7 @@ func (compiler *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 
-		if compiler.lastInstructionIs(code.OpPop) {
-			compiler.removeLastPop()
-		}
+		compiler.keepBlockValue()
 
 		// Emit bogus jump value to backpatch later
 		jumpPos := compiler.emit(code.OpJump, 9999)
@@ -194,9 +216,7 @@ func (compiler *Compiler) Compile(node ast.Node) error {
 				return err
 			}
 
-			if compiler.lastInstructionIs(code.OpPop) {
-				compiler.removeLastPop()
-			}
+			compiler.keepBlockValue()
 		}
 
 		afterAlternativePos := len(compiler.currentInstructions())
@@ -215,10 +235,21 @@ func (compiler *Compiler) Compile(node ast.Node) error {
 
 		compiler.emit(code.OpIndex)
 
+	case *ast.MemberExpression:
+		err := compiler.Compile(node.Object)
+		if err != nil {
+			return err
+		}
+
+		// `object.member` is sugar for `object["member"]`
+		member := &object.String{Value: node.Member.Value}
+		compiler.emit(code.OpConstant, compiler.addConstant(member))
+		compiler.emit(code.OpIndex)
+
 	case *ast.Identifier:
 		symbol, ok := compiler.symbolTable.Resolve(node.Value)
 		if !ok {
-			return fmt.Errorf("undefined variable %s", node.Value)
+			return &Error{fmt.Sprintf("undefined variable %s", node.Value), node.Token}
 		}
 
 		compiler.loadSymbol(symbol)
@@ -296,6 +327,8 @@ func (compiler *Compiler) Compile(node ast.Node) error {
 
 		freeSymbols := compiler.symbolTable.FreeSymbols
 		numLocals := compiler.symbolTable.numDefinitions
+		localNames, freeNames := compiler.symbolTable.names()
+		lines := compiler.currentScope().lines
 		instructions := compiler.leaveScope()
 
 		for _, symbol := range freeSymbols {
@@ -306,30 +339,56 @@ func (compiler *Compiler) Compile(node ast.Node) error {
 			Instructions:  instructions,
 			NumLocals:     numLocals,
 			NumParameters: len(node.Parameters),
+			Name:          node.Name,
+			Lines:         lines,
+			LocalNames:    localNames,
+			FreeNames:     freeNames,
 		}
 
 		fnIndex := compiler.addConstant(compiledFn)
 		compiler.emit(code.OpClosure, fnIndex, len(freeSymbols))
 
 	case *ast.CallExpression:
-		err := compiler.Compile(node.Function)
+		return compiler.compileCall(node, code.OpCall)
+	}
+
+	return nil
+}
+
+// Calls made directly in the arguments of assertError use OpTryCall, so an error
+// a builtin returns reaches assertError rather than stopping the VM
+func (compiler *Compiler) compileCall(node *ast.CallExpression, op code.Opcode) error {
+	err := compiler.Compile(node.Function)
+	if err != nil {
+		return err
+	}
+
+	keepErrors := compiler.isBuiltin(node.Function, "assertError")
+	for _, arg := range node.Arguments {
+		if call, ok := arg.(*ast.CallExpression); ok && keepErrors {
+			err = compiler.compileCall(call, code.OpTryCall)
+		} else {
+			err = compiler.Compile(arg)
+		}
 		if err != nil {
 			return err
 		}
-
-		for _, arg := range node.Arguments {
-			err := compiler.Compile(arg)
-			if err != nil {
-				return err
-			}
-		}
-
-		compiler.emit(code.OpCall, len(node.Arguments))
 	}
 
+	compiler.emit(op, len(node.Arguments))
 	return nil
 }
 
+// Reports whether exp names the builtin called name, not shadowed by a binding
+func (compiler *Compiler) isBuiltin(exp ast.Expression, name string) bool {
+	ident, ok := exp.(*ast.Identifier)
+	if !ok || ident.Value != name {
+		return false
+	}
+	symbol, ok := compiler.symbolTable.Resolve(name)
+	return ok && symbol.Scope == BuiltinScope
+}
+
 func (compiler *Compiler) addConstant(obj object.Object) int {
 	compiler.constants = append(compiler.constants, obj)
 	return len(compiler.constants) - 1
@@ -342,6 +401,12 @@ func (compiler *Compiler) emit(opcode code.Opcode, operands ...int) int {
 	return pos
 }
 
+// Attributes the instructions emitted from here on to the line of tok
+func (compiler *Compiler) markLine(tok token.Token) {
+	scope := compiler.currentScope()
+	scope.lines = scope.lines.Add(len(scope.instructions), tok.Line)
+}
+
 func (compiler *Compiler) currentScope() *CompilationScope {
 	return &compiler.scopes[compiler.scopeIndex]
 }
@@ -387,6 +452,17 @@ func (compiler *Compiler) removeLastPop() {
 	currentScope.lastInstruction = previous
 }
 
+// Leaves the value of the block just compiled on the stack. Blocks that don't
+// end in an expression, like empty ones, have the value null
+func (compiler *Compiler) keepBlockValue() {
+	switch {
+	case compiler.lastInstructionIs(code.OpPop):
+		compiler.removeLastPop()
+	case !compiler.lastInstructionIs(code.OpReturnValue):
+		compiler.emit(code.OpNull)
+	}
+}
+
 func (compiler *Compiler) replaceInstruction(pos int, newInstruction []byte) {
 	instructions := compiler.currentInstructions()
 	for i := range len(newInstruction) {
@@ -413,9 +489,14 @@ func (compiler *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: compiler.currentInstructions(),
 		Constants:    compiler.constants,
+		Lines:        compiler.currentScope().lines,
 	}
 }
 
+func (compiler *Compiler) SymbolTable() *SymbolTable {
+	return compiler.symbolTable
+}
+
 func (compiler *Compiler) enterScope() {
 	scope := CompilationScope{
 		instructions:           code.Instructions{},
@@ -338,6 +338,31 @@ func TestConditionals(t *testing.T) {
 			},
 		},
 
+		{
+			input: `
+            if (true) { }; 3333;
+            `,
+			expectedConstants: []interface{}{3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 8),
+				// 0004
+				code.Make(code.OpNull),
+				// 0005
+				code.Make(code.OpJump, 9),
+				// 0008
+				code.Make(code.OpNull),
+				// 0009
+				code.Make(code.OpPop),
+				// 0010
+				code.Make(code.OpConstant, 0),
+				// 0013
+				code.Make(code.OpPop),
+			},
+		},
+
 		{
 			input: `
             if (true) { 10 } else { 20 }; 3333;
@@ -411,6 +436,22 @@ func TestGlobalLetStatements(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			// The value reads the binding it shadows
+			input: `
+            let a = 1;
+            let a = a + 1;
+            `,
+			expectedConstants: []interface{}{1, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetGlobal, 1),
+			},
+		},
 	}
 
 	runCompilerTests(t, tests)
@@ -565,6 +606,25 @@ func TestIndexExpressions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestMemberExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `{"a": 1}.a`,
+			expectedConstants: []interface{}{"a", 1, "a"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpHash, 2),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestFunctions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -901,6 +961,41 @@ func TestBuiltins(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input:             `assertError(len(1), first([]))`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 13),
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpTryCall, 1),
+				code.Make(code.OpGetBuiltin, 1),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpTryCall, 1),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `let assertError = fn(x) { x }; assertError(len(1))`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
 	}
 
 	runCompilerTests(t, tests)
@@ -1101,3 +1196,146 @@ func TestRecursiveFunctions(t *testing.T) {
 
 	runCompilerTests(t, tests)
 }
+
+// A let's value is compiled before its name is defined, so it reads the binding
+// it shadows, and only functions can refer to themselves
+func TestLetScoping(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn(a) { let a = a * 10; a }`,
+			expectedConstants: []interface{}{
+				10,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpMul),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(a) { fn() { let a = a + 1; a } }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 1, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `let f = 1; let f = fn() { f };`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 1),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestLineTables(t *testing.T) {
+	input := `let one = 1;
+let double = fn(x) {
+  let y = x * 2;
+  y
+};
+double(one)`
+
+	compiler := New()
+	err := compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	expectedMain := code.LineTable{{Offset: 0, Line: 1}, {Offset: 6, Line: 2}, {Offset: 13, Line: 6}}
+	if fmt.Sprint(bytecode.Lines) != fmt.Sprint(expectedMain) {
+		t.Errorf("wrong main lines. want=%v, got=%v", expectedMain, bytecode.Lines)
+	}
+
+	fn, ok := bytecode.Constants[2].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant 2 - not a function: %T", bytecode.Constants[2])
+	}
+	if fn.Name != "double" {
+		t.Errorf("wrong function name. want=%q, got=%q", "double", fn.Name)
+	}
+	expectedFn := code.LineTable{{Offset: 0, Line: 3}, {Offset: 8, Line: 4}}
+	if fmt.Sprint(fn.Lines) != fmt.Sprint(expectedFn) {
+		t.Errorf("wrong function lines. want=%v, got=%v", expectedFn, fn.Lines)
+	}
+}
+
+func TestIfLines(t *testing.T) {
+	input := `let x = [1,
+  if (true) { 2 } else { 3 }];`
+
+	compiler := New()
+	err := compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	// The OpJumpNotTruthy at 4 starts the line of its if
+	expected := code.LineTable{{Offset: 0, Line: 1}, {Offset: 4, Line: 2}}
+	if lines := compiler.Bytecode().Lines; fmt.Sprint(lines) != fmt.Sprint(expected) {
+		t.Errorf("wrong lines. want=%v, got=%v", expected, lines)
+	}
+}
+
+func TestCompilerErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+		line    int
+		column  int
+	}{
+		{"let a = 1;\na + b", "undefined variable b", 2, 5},
+		{"fn(x) {\n  x * y\n}", "undefined variable y", 2, 7},
+		{"let x = x;", "undefined variable x", 1, 9},
+		{"fn() { let y = [y]; }", "undefined variable y", 1, 17},
+	}
+
+	for _, tt := range tests {
+		err := New().Compile(parse(tt.input))
+
+		compileErr, ok := err.(*Error)
+		if !ok {
+			t.Fatalf("%q: expected a *Error, got %T (%v)", tt.input, err, err)
+		}
+		if compileErr.Message != tt.message || compileErr.Token.Line != tt.line || compileErr.Token.Column != tt.column {
+			t.Errorf("%q: wrong error. want=%q at %d:%d, got=%q at %d:%d", tt.input, tt.message, tt.line,
+				tt.column, compileErr.Message, compileErr.Token.Line, compileErr.Token.Column)
+		}
+	}
+}
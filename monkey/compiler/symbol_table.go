@@ -1,5 +1,7 @@
 package compiler
 
+import "sort"
+
 type SymbolScope string
 
 const (
@@ -35,6 +37,21 @@ func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 	return s
 }
 
+// Copy returns a table with the same definitions that can be added to without
+// changing this one. Enclosing tables are shared
+func (symbolTable *SymbolTable) Copy() *SymbolTable {
+	store := make(map[string]Symbol, len(symbolTable.store))
+	for name, symbol := range symbolTable.store {
+		store[name] = symbol
+	}
+	return &SymbolTable{
+		Outer:          symbolTable.Outer,
+		store:          store,
+		numDefinitions: symbolTable.numDefinitions,
+		FreeSymbols:    append([]Symbol{}, symbolTable.FreeSymbols...),
+	}
+}
+
 func (symbolTable *SymbolTable) Define(name string) Symbol {
 	symbol := Symbol{Name: name, Index: symbolTable.numDefinitions}
 	if symbolTable.Outer == nil {
@@ -87,3 +104,36 @@ func (symbolTable *SymbolTable) Resolve(name string) (Symbol, bool) {
 	}
 	return symbol, ok
 }
+
+// Names of the locals and free variables of a function scope, by index
+func (symbolTable *SymbolTable) names() ([]string, []string) {
+	var locals, free []string
+	if symbolTable.numDefinitions > 0 {
+		locals = make([]string, symbolTable.numDefinitions)
+	}
+	for _, symbol := range symbolTable.store {
+		if symbol.Scope == LocalScope {
+			locals[symbol.Index] = symbol.Name
+		}
+	}
+	for _, symbol := range symbolTable.FreeSymbols {
+		free = append(free, symbol.Name)
+	}
+	return locals, free
+}
+
+// Symbols lists the names defined directly in this table, ordered by scope and index
+func (symbolTable *SymbolTable) Symbols() []Symbol {
+	symbols := make([]Symbol, 0, len(symbolTable.store))
+	for _, symbol := range symbolTable.store {
+		symbols = append(symbols, symbol)
+	}
+
+	sort.Slice(symbols, func(i, j int) bool {
+		if symbols[i].Scope != symbols[j].Scope {
+			return symbols[i].Scope < symbols[j].Scope
+		}
+		return symbols[i].Index < symbols[j].Index
+	})
+	return symbols
+}
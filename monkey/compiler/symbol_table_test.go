@@ -335,3 +335,24 @@ func TestShadowingFunctionName(t *testing.T) {
 			expected.Name, expected, result)
 	}
 }
+
+func TestCopy(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	copied := global.Copy()
+	b := copied.Define("b")
+	if b != (Symbol{Name: "b", Scope: GlobalScope, Index: 1}) {
+		t.Errorf("b wrong in copy. got=%+v", b)
+	}
+	if _, ok := copied.Resolve("a"); !ok {
+		t.Errorf("a not resolvable in copy")
+	}
+
+	if _, ok := global.Resolve("b"); ok {
+		t.Errorf("b defined in the original table")
+	}
+	if c := global.Define("c"); c.Index != 1 {
+		t.Errorf("c wrong in original. got=%+v", c)
+	}
+}
@@ -0,0 +1,211 @@
+// Package cover records which lines and if expressions of a script run, on
+// either engine, and reports them as a text summary or as HTML with the
+// source annotated
+package cover
+
+import (
+	"fmt"
+	"io"
+	"monkey/ast"
+	"sort"
+	"strings"
+)
+
+// Profile records the coverage of one script, as the object.Coverage of its
+// environment or VM. Ifs sharing a line are counted together
+type Profile struct {
+	Name string
+
+	source     []string
+	statements map[int]bool // Lines on which statements start
+	ifs        map[int]bool
+	runs       map[int]int
+	branches   map[int]*branch
+}
+
+type branch struct {
+	taken   int // Times the consequence ran
+	skipped int
+}
+
+// New prepares the profile of a script from its source and syntax tree
+func New(name string, source string, program *ast.Program) *Profile {
+	profile := &Profile{
+		Name:       name,
+		source:     strings.Split(source, "\n"),
+		statements: map[int]bool{},
+		ifs:        map[int]bool{},
+		runs:       map[int]int{},
+		branches:   map[int]*branch{},
+	}
+	profile.collect(program)
+	return profile
+}
+
+func (profile *Profile) collect(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, statement := range node.Statements {
+			profile.collect(statement)
+		}
+	case *ast.BlockStatement:
+		for _, statement := range node.Statements {
+			profile.collect(statement)
+		}
+	case *ast.LetStatement:
+		profile.statements[node.Token.Line] = true
+		profile.collect(node.Value)
+	case *ast.ReturnStatement:
+		profile.statements[node.Token.Line] = true
+		profile.collect(node.ReturnValue)
+	case *ast.ExpressionStatement:
+		profile.statements[node.Token.Line] = true
+		profile.collect(node.Expression)
+
+	case *ast.IfExpression:
+		profile.ifs[node.Token.Line] = true
+		profile.collect(node.Condition)
+		profile.collect(node.Consequence)
+		if node.Alternative != nil {
+			profile.collect(node.Alternative)
+		}
+	case *ast.FunctionLiteral:
+		profile.collect(node.Body)
+	case *ast.PrefixExpression:
+		profile.collect(node.Right)
+	case *ast.InfixExpression:
+		profile.collect(node.Left)
+		profile.collect(node.Right)
+	case *ast.CallExpression:
+		profile.collect(node.Function)
+		for _, argument := range node.Arguments {
+			profile.collect(argument)
+		}
+	case *ast.IndexExpression:
+		profile.collect(node.Left)
+		profile.collect(node.Index)
+	case *ast.MemberExpression:
+		profile.collect(node.Object)
+	case *ast.ArrayLiteral:
+		for _, element := range node.Elements {
+			profile.collect(element)
+		}
+	case *ast.HashLiteral:
+		for key, value := range node.Pairs {
+			profile.collect(key)
+			profile.collect(value)
+		}
+	}
+}
+
+func (profile *Profile) Statement(line int) {
+	profile.runs[line]++
+}
+
+func (profile *Profile) Branch(line int, taken bool) {
+	counts, ok := profile.branches[line]
+	if !ok {
+		counts = &branch{}
+		profile.branches[line] = counts
+	}
+	if taken {
+		counts.taken++
+	} else {
+		counts.skipped++
+	}
+}
+
+// Summary counts the lines with statements and those of them that ran, and
+// the ways ifs can go, two for each, and those they went
+type Summary struct {
+	Lines         int
+	LinesRun      int
+	Branches      int
+	BranchesTaken int
+}
+
+func (profile *Profile) Summary() Summary {
+	summary := Summary{Lines: len(profile.statements), Branches: 2 * len(profile.ifs)}
+	for line := range profile.statements {
+		if profile.runs[line] > 0 {
+			summary.LinesRun++
+		}
+	}
+	for line := range profile.ifs {
+		if counts, ok := profile.branches[line]; ok {
+			summary.BranchesTaken += min(counts.taken, 1) + min(counts.skipped, 1)
+		}
+	}
+	return summary
+}
+
+func (summary Summary) String() string {
+	return fmt.Sprintf("%s of lines (%d/%d), %s of branches (%d/%d)",
+		percent(summary.LinesRun, summary.Lines), summary.LinesRun, summary.Lines,
+		percent(summary.BranchesTaken, summary.Branches), summary.BranchesTaken, summary.Branches)
+}
+
+func percent(part, whole int) string {
+	if whole == 0 {
+		return "100.0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(part)/float64(whole))
+}
+
+// WriteText writes the summary of the profile followed by what did not run:
+//
+//	fib.mk: 87.5% of lines (7/8), 75.0% of branches (3/4)
+//	  line 4: the if never skipped its consequence
+//	  line 9 never ran
+func (profile *Profile) WriteText(out io.Writer) error {
+	_, err := fmt.Fprintf(out, "%s: %s\n", profile.Name, profile.Summary())
+	if err != nil {
+		return err
+	}
+
+	for _, line := range profile.sortedLines() {
+		if note := profile.note(line); note != "" {
+			_, err := fmt.Fprintf(out, "  line %d%s\n", line, note)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Lines with statements or ifs, in order
+func (profile *Profile) sortedLines() []int {
+	lines := []int{}
+	for line := range profile.statements {
+		lines = append(lines, line)
+	}
+	for line := range profile.ifs {
+		if !profile.statements[line] {
+			lines = append(lines, line)
+		}
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// Says what on a line was missed, if anything
+func (profile *Profile) note(line int) string {
+	if profile.statements[line] && profile.runs[line] == 0 {
+		return " never ran"
+	}
+	if !profile.ifs[line] {
+		return ""
+	}
+
+	counts, ok := profile.branches[line]
+	switch {
+	case !ok:
+		return ": the if never ran"
+	case counts.taken == 0:
+		return ": the if never ran its consequence"
+	case counts.skipped == 0:
+		return ": the if never skipped its consequence"
+	}
+	return ""
+}
@@ -0,0 +1,142 @@
+package cover
+
+import (
+	"bytes"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/vm"
+	"strings"
+	"testing"
+)
+
+const script = `let sign = fn(x) {
+  if (x < 0) {
+    return -1;
+  }
+  if (x > 0) { 1 } else { 0 }
+};
+let unused = fn() {
+  puts("never");
+};
+sign(3);
+sign(0);`
+
+const report = `script.mk: 75.0% of lines (6/8), 75.0% of branches (3/4)
+  line 2: the if never ran its consequence
+  line 3 never ran
+  line 8 never ran
+`
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
+
+func TestEvaluatorCoverage(t *testing.T) {
+	program := parse(t, script)
+	profile := New("script.mk", script, program)
+
+	env := object.NewEnvironment()
+	env.SetCoverage(profile)
+	if result, ok := evaluator.Eval(program, env).(*object.Error); ok {
+		t.Fatalf("evaluator error: %s", result.Message)
+	}
+
+	checkReport(t, profile)
+}
+
+func TestVMCoverage(t *testing.T) {
+	program := parse(t, script)
+	profile := New("script.mk", script, program)
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := vm.New(comp.Bytecode())
+	machine.SetCoverage(profile)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	checkReport(t, profile)
+}
+
+func checkReport(t *testing.T, profile *Profile) {
+	t.Helper()
+
+	var out bytes.Buffer
+	if err := profile.WriteText(&out); err != nil {
+		t.Fatalf("WriteText error: %s", err)
+	}
+	if out.String() != report {
+		t.Errorf("wrong report.\nwant=\n%s\ngot=\n%s", report, out.String())
+	}
+}
+
+func TestSummary(t *testing.T) {
+	tests := []struct {
+		input    string
+		run      []int
+		branches map[int][]bool
+		expected string
+	}{
+		{"", nil, nil, "100.0% of lines (0/0), 100.0% of branches (0/0)"},
+		{"1;\n2;", []int{1}, nil, "50.0% of lines (1/2), 100.0% of branches (0/0)"},
+		{"if (true) { 1 }", []int{1}, map[int][]bool{1: {true, true}}, "100.0% of lines (1/1), 50.0% of branches (1/2)"},
+		{"if (x) { 1 } else { 2 };\nif (y) { 3 }", []int{1, 2}, map[int][]bool{1: {true, false}}, "100.0% of lines (2/2), 50.0% of branches (2/4)"},
+		// Ifs sharing a line count as one
+		{"[if (a) { 1 }, if (b) { 2 }]", []int{1}, map[int][]bool{1: {true, false}}, "100.0% of lines (1/1), 100.0% of branches (2/2)"},
+	}
+
+	for _, tt := range tests {
+		profile := New("test.mk", tt.input, parse(t, tt.input))
+		for _, line := range tt.run {
+			profile.Statement(line)
+		}
+		for line, taken := range tt.branches {
+			for _, way := range taken {
+				profile.Branch(line, way)
+			}
+		}
+
+		if summary := profile.Summary().String(); summary != tt.expected {
+			t.Errorf("wrong summary for %q. want=%q, got=%q", tt.input, tt.expected, summary)
+		}
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	input := "let x = 1;\nif (x > 1) {\n  puts(\"<big>\");\n}"
+	profile := New("page.mk", input, parse(t, input))
+	profile.Statement(1)
+	profile.Statement(2)
+	profile.Branch(2, false)
+
+	var out bytes.Buffer
+	if err := WriteHTML(&out, []*Profile{profile}); err != nil {
+		t.Fatalf("WriteHTML error: %s", err)
+	}
+	page := out.String()
+
+	expected := []string{
+		"<h2>page.mk</h2>",
+		`<tr class="run"><td class="number">1</td><td class="runs">1</td>`,
+		`<tr class="partial"><td class="number">2</td><td class="runs">1</td><td class="text">if (x &gt; 1) {</td><td class="note">the if never ran its consequence</td>`,
+		`<tr class="missed"><td class="number">3</td><td class="runs">0</td><td class="text">  puts(&#34;&lt;big&gt;&#34;);</td><td class="note">never ran</td>`,
+		`<tr class=""><td class="number">4</td><td class="runs"></td>`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(page, want) {
+			t.Errorf("page does not contain %q:\n%s", want, page)
+		}
+	}
+}
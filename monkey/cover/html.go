@@ -0,0 +1,79 @@
+package cover
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+type htmlFile struct {
+	Name    string
+	Summary Summary
+	Lines   []htmlLine
+}
+
+type htmlLine struct {
+	Number int
+	Runs   string
+	Class  string // run, missed, partial or empty for lines without code
+	Text   string
+	Note   string
+}
+
+// WriteHTML writes a page showing the source of each profiled script, with
+// lines that ran in green, lines that did not in red and ifs that only went
+// one way in yellow
+func WriteHTML(out io.Writer, profiles []*Profile) error {
+	files := []htmlFile{}
+	for _, profile := range profiles {
+		file := htmlFile{Name: profile.Name, Summary: profile.Summary()}
+		for i, text := range profile.source {
+			line := i + 1
+			annotated := htmlLine{Number: line, Text: strings.TrimRight(text, "\r")}
+			if profile.statements[line] || profile.ifs[line] {
+				annotated.Runs = fmt.Sprint(profile.runs[line])
+				annotated.Note = strings.TrimLeft(profile.note(line), ": ")
+				switch {
+				case annotated.Note == "":
+					annotated.Class = "run"
+				case profile.runs[line] == 0:
+					annotated.Class = "missed"
+				default:
+					annotated.Class = "partial"
+				}
+			}
+			file.Lines = append(file.Lines, annotated)
+		}
+		files = append(files, file)
+	}
+	return page.Execute(out, files)
+}
+
+var page = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Monkey coverage</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; font-family: monospace; }
+td { padding: 0 0.5em; white-space: pre; vertical-align: top; }
+td.number, td.runs { color: #888; text-align: right; }
+td.note { color: #555; font-style: italic; }
+tr.run td.text { background: #dfd; }
+tr.missed td.text { background: #fdd; }
+tr.partial td.text { background: #ffc; }
+</style>
+</head>
+<body>
+{{range .}}
+<h2>{{.Name}}</h2>
+<p>{{.Summary}}</p>
+<table>
+{{range .Lines}}<tr class="{{.Class}}"><td class="number">{{.Number}}</td><td class="runs">{{.Runs}}</td><td class="text">{{.Text}}</td><td class="note">{{.Note}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"monkey/dap"
+	"os"
+)
+
+// Lets editors debug scripts, see package dap
+func dapCommand(args []string) int {
+	flags := newFlagSet("monkey dap")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	err := dap.NewServer(os.Stdin, os.Stdout).Serve()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
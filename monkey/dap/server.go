@@ -0,0 +1,648 @@
+// Package dap implements the Debug Adapter Protocol on top of vm.Debugger, so
+// editors like VS Code and Neovim can debug Monkey scripts
+package dap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"monkey/compiler"
+	"monkey/jsonrpc"
+	"monkey/lexer"
+	"monkey/module"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/vm"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The VM runs a single thread, which the protocol still wants to see
+const threadID = 1
+
+// Server handles one debug session. Requests are read and answered on the
+// goroutine calling Serve while the program runs on another one, which blocks
+// in the debugger's Stopped callback whenever the program is paused. Anything
+// the two share is guarded by mu
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	writeMu sync.Mutex
+	seq     int
+
+	mu          sync.Mutex
+	program     string
+	lines       map[int]bool // Lines with statements, known after launch
+	breakpoints []int
+	functions   []string
+	machine     *vm.VM
+	debugger    *vm.Debugger // Nil when launched with noDebug
+	launched    bool
+	configured  bool
+	running     bool
+	paused      bool
+	stopping    bool
+	cancel      context.CancelFunc
+	handles     []func() []vm.Variable // Indexed by variablesReference - 1
+
+	resume chan func(debugger *vm.Debugger)
+	done   chan struct{} // Closed once the program has finished
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:     bufio.NewReader(in),
+		out:    out,
+		resume: make(chan func(debugger *vm.Debugger)),
+		done:   make(chan struct{}),
+	}
+}
+
+// Serve answers requests until the client disconnects or closes the input
+func (server *Server) Serve() error {
+	for {
+		message, err := jsonrpc.ReadMessage(server.in)
+		if err == io.EOF {
+			server.stop()
+			return nil
+		}
+		if err != nil {
+			server.stop()
+			return err
+		}
+
+		request := &request{}
+		err = json.Unmarshal(message, request)
+		if err != nil || request.Type != "request" {
+			continue // Clients only send requests, and nothing can answer garbage
+		}
+
+		if request.Command == "disconnect" {
+			server.stop()
+			server.respond(request, nil)
+			return nil
+		}
+
+		err = server.handle(request)
+		if err != nil {
+			server.fail(request, err)
+		}
+	}
+}
+
+func (server *Server) handle(request *request) error {
+	switch request.Command {
+	case "initialize":
+		server.respond(request, map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsFunctionBreakpoints":      true,
+			"supportsEvaluateForHovers":        true,
+			"supportsTerminateRequest":         true,
+		})
+		server.event("initialized", nil)
+
+	case "launch":
+		arguments := &launchArguments{}
+		if err := decode(request, arguments); err != nil {
+			return err
+		}
+		if err := server.launch(arguments); err != nil {
+			return err
+		}
+		server.respond(request, nil)
+		server.start()
+
+	case "setBreakpoints":
+		arguments := &setBreakpointsArguments{}
+		if err := decode(request, arguments); err != nil {
+			return err
+		}
+		server.respond(request, map[string]interface{}{"breakpoints": server.setBreakpoints(arguments)})
+
+	case "setFunctionBreakpoints":
+		arguments := &setFunctionBreakpointsArguments{}
+		if err := decode(request, arguments); err != nil {
+			return err
+		}
+		server.respond(request, map[string]interface{}{"breakpoints": server.setFunctionBreakpoints(arguments)})
+
+	case "setExceptionBreakpoints":
+		server.respond(request, map[string]interface{}{"breakpoints": []breakpoint{}})
+
+	case "configurationDone":
+		server.mu.Lock()
+		server.configured = true
+		server.mu.Unlock()
+		server.respond(request, nil)
+		server.start()
+
+	case "threads":
+		server.respond(request, map[string]interface{}{
+			"threads": []map[string]interface{}{{"id": threadID, "name": "main"}},
+		})
+
+	case "stackTrace":
+		frames, err := server.stackTrace()
+		if err != nil {
+			return err
+		}
+		server.respond(request, map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)})
+
+	case "scopes":
+		arguments := &frameArguments{}
+		if err := decode(request, arguments); err != nil {
+			return err
+		}
+		scopes, err := server.scopes(arguments.FrameID)
+		if err != nil {
+			return err
+		}
+		server.respond(request, map[string]interface{}{"scopes": scopes})
+
+	case "variables":
+		arguments := &variablesArguments{}
+		if err := decode(request, arguments); err != nil {
+			return err
+		}
+		variables, err := server.variables(arguments.VariablesReference)
+		if err != nil {
+			return err
+		}
+		server.respond(request, map[string]interface{}{"variables": variables})
+
+	case "evaluate":
+		arguments := &evaluateArguments{}
+		if err := decode(request, arguments); err != nil {
+			return err
+		}
+		result, err := server.evaluate(arguments)
+		if err != nil {
+			return err
+		}
+		server.respond(request, map[string]interface{}{
+			"result":             result.Value,
+			"type":               result.Type,
+			"variablesReference": result.VariablesReference,
+		})
+
+	case "continue":
+		return server.resumeWith(request, map[string]interface{}{"allThreadsContinued": true}, (*vm.Debugger).Continue)
+	case "next":
+		return server.resumeWith(request, nil, (*vm.Debugger).StepOver)
+	case "stepIn":
+		return server.resumeWith(request, nil, (*vm.Debugger).StepInto)
+	case "stepOut":
+		return server.resumeWith(request, nil, (*vm.Debugger).StepOut)
+
+	case "pause":
+		server.mu.Lock()
+		debugger := server.debugger
+		server.mu.Unlock()
+		if debugger == nil {
+			return fmt.Errorf("the program is not being debugged")
+		}
+		debugger.Pause()
+		server.respond(request, nil)
+
+	case "terminate":
+		server.stop()
+		server.respond(request, nil)
+
+	default:
+		return fmt.Errorf("unsupported request %s", request.Command)
+	}
+
+	return nil
+}
+
+func decode(request *request, arguments interface{}) error {
+	if len(request.Arguments) == 0 {
+		return nil
+	}
+	err := json.Unmarshal(request.Arguments, arguments)
+	if err != nil {
+		return fmt.Errorf("invalid arguments for %s: %s", request.Command, err)
+	}
+	return nil
+}
+
+// Compiles the program and prepares a VM for it, which starts once the client
+// has also sent its configuration
+func (server *Server) launch(arguments *launchArguments) error {
+	server.mu.Lock()
+	launched := server.launched
+	server.mu.Unlock()
+	if launched {
+		return fmt.Errorf("a program has already been launched")
+	}
+
+	if arguments.Program == "" {
+		return fmt.Errorf("launch needs a program")
+	}
+	path, err := filepath.Abs(arguments.Program)
+	if err != nil {
+		return err
+	}
+
+	bytecode, symbols, err := load(path)
+	if err != nil {
+		return err
+	}
+
+	runtime := object.NewRuntime()
+	runtime.Args = arguments.Args
+	runtime.Stdout = &outputWriter{server, "stdout"}
+	runtime.Stdin = strings.NewReader("") // Stdin carries the protocol
+	runtime.Importer = module.NewLoader("vm", filepath.Dir(path))
+	ctx, cancel := context.WithCancel(context.Background())
+	runtime.Context = ctx
+
+	machine := vm.New(bytecode)
+	machine.SetRuntime(runtime)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.program = path
+	server.cancel = cancel
+	server.lines = statementLines(bytecode)
+	server.machine = machine
+	server.launched = true
+
+	if !arguments.NoDebug {
+		debugger := vm.NewDebugger(machine, symbols)
+		debugger.StopOnEntry = arguments.StopOnEntry
+		debugger.Stopped = server.stopped
+		for _, line := range server.breakpoints {
+			debugger.BreakAtLine(line)
+		}
+		for _, name := range server.functions {
+			debugger.BreakAtFunction(name)
+		}
+		server.debugger = debugger
+	}
+	return nil
+}
+
+func load(path string) (*compiler.Bytecode, *compiler.SymbolTable, error) {
+	input, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if compiler.IsPrecompiled(input) {
+		bytecode := &compiler.Bytecode{}
+		err := bytecode.UnmarshalBinary(input)
+		if err != nil {
+			return nil, nil, err
+		}
+		return bytecode, nil, vm.Verify(bytecode)
+	}
+
+	p := parser.New(lexer.New(string(input)))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, nil, fmt.Errorf("parser errors:\n\t%s", strings.Join(p.Errors(), "\n\t"))
+	}
+
+	comp := compiler.New()
+	err = comp.Compile(program)
+	if err != nil {
+		return nil, nil, fmt.Errorf("compile error: %s", err)
+	}
+	return comp.Bytecode(), comp.SymbolTable(), nil
+}
+
+// The lines a breakpoint can stop at
+func statementLines(bytecode *compiler.Bytecode) map[int]bool {
+	lines := map[int]bool{}
+	for _, entry := range bytecode.Lines {
+		lines[entry.Line] = true
+	}
+	for _, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			for _, entry := range fn.Lines {
+				lines[entry.Line] = true
+			}
+		}
+	}
+	return lines
+}
+
+// Runs the program once it is launched and configured
+func (server *Server) start() {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if !server.launched || !server.configured || server.running {
+		return
+	}
+	server.running = true
+
+	go func() {
+		err := server.machine.Run()
+
+		exitCode := 0
+		if err != nil && !errors.Is(err, vm.ErrKilled) && !errors.Is(err, object.ErrCancelled) {
+			server.output("stderr", fmt.Sprintf("runtime error: %s\n", err))
+			exitCode = 1
+		}
+		server.event("exited", map[string]interface{}{"exitCode": exitCode})
+		server.event("terminated", nil)
+		close(server.done)
+	}()
+}
+
+// Kills the program, if it runs, and waits for it to finish
+func (server *Server) stop() {
+	server.mu.Lock()
+	running, paused, debugger := server.running, server.paused, server.debugger
+	server.paused = false
+	server.stopping = true
+	server.mu.Unlock()
+
+	if !running {
+		return
+	}
+	server.cancel()
+	if debugger != nil {
+		debugger.Kill()
+		if paused {
+			server.resume <- func(debugger *vm.Debugger) {}
+		}
+	}
+	<-server.done
+}
+
+// Called on the program's goroutine, which stays paused until a request
+// resumes it
+func (server *Server) stopped(debugger *vm.Debugger, reason vm.StopReason) {
+	server.mu.Lock()
+	if server.stopping {
+		server.mu.Unlock()
+		return // The debugger was killed, Run returns once this does
+	}
+	server.paused = true
+	server.handles = nil
+	server.mu.Unlock()
+
+	server.event("stopped", map[string]interface{}{
+		"reason":            string(reason),
+		"threadId":          threadID,
+		"allThreadsStopped": true,
+	})
+
+	action := <-server.resume
+	action(debugger)
+}
+
+func (server *Server) resumeWith(request *request, body interface{}, action func(debugger *vm.Debugger)) error {
+	server.mu.Lock()
+	if !server.paused {
+		server.mu.Unlock()
+		return fmt.Errorf("the program is not paused")
+	}
+	server.paused = false
+	server.mu.Unlock()
+
+	// Answered first, the program may stop again right away
+	server.respond(request, body)
+	server.resume <- action
+	return nil
+}
+
+// Returns the debugger while the program is paused, with mu held until
+// release is called
+func (server *Server) pausedDebugger() (*vm.Debugger, func(), error) {
+	server.mu.Lock()
+	if !server.paused {
+		server.mu.Unlock()
+		return nil, nil, fmt.Errorf("the program is not paused")
+	}
+	return server.debugger, server.mu.Unlock, nil
+}
+
+func (server *Server) setBreakpoints(arguments *setBreakpointsArguments) []breakpoint {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	path, _ := filepath.Abs(arguments.Source.Path)
+	sameProgram := !server.launched || path == server.program
+
+	if server.debugger != nil {
+		for _, line := range server.breakpoints {
+			server.debugger.ClearLine(line)
+		}
+	}
+	server.breakpoints = nil
+
+	breakpoints := []breakpoint{}
+	for _, requested := range arguments.Breakpoints {
+		result := breakpoint{Verified: true, Line: requested.Line}
+		switch {
+		case !sameProgram:
+			result = breakpoint{Message: "only the launched program can be debugged"}
+		case server.launched && !server.lines[requested.Line]:
+			result = breakpoint{Line: requested.Line, Message: "no code on this line"}
+		default:
+			server.breakpoints = append(server.breakpoints, requested.Line)
+			if server.debugger != nil {
+				server.debugger.BreakAtLine(requested.Line)
+			}
+		}
+		breakpoints = append(breakpoints, result)
+	}
+	return breakpoints
+}
+
+func (server *Server) setFunctionBreakpoints(arguments *setFunctionBreakpointsArguments) []breakpoint {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if server.debugger != nil {
+		for _, name := range server.functions {
+			server.debugger.ClearFunction(name)
+		}
+	}
+	server.functions = nil
+
+	breakpoints := []breakpoint{}
+	for _, requested := range arguments.Breakpoints {
+		server.functions = append(server.functions, requested.Name)
+		if server.debugger != nil {
+			server.debugger.BreakAtFunction(requested.Name)
+		}
+		breakpoints = append(breakpoints, breakpoint{Verified: true})
+	}
+	return breakpoints
+}
+
+// Frame ids count from 1 for the innermost frame, as some clients take 0 for
+// no frame
+func (server *Server) stackTrace() ([]stackFrame, error) {
+	debugger, release, err := server.pausedDebugger()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	frames := []stackFrame{}
+	for i, frame := range debugger.Frames() {
+		frames = append(frames, stackFrame{
+			ID:     i + 1,
+			Name:   frame.Function,
+			Source: source{Name: filepath.Base(server.program), Path: server.program},
+			Line:   frame.Line,
+			Column: 1,
+		})
+	}
+	return frames, nil
+}
+
+func (server *Server) scopes(frameID int) ([]scope, error) {
+	debugger, release, err := server.pausedDebugger()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	n := frameID - 1
+	locals, err := debugger.Locals(n)
+	if err != nil {
+		return nil, err
+	}
+	free, _ := debugger.Free(n)
+
+	scopes := []scope{{Name: "Locals", VariablesReference: server.reference(locals)}}
+	if len(free) > 0 {
+		scopes = append(scopes, scope{Name: "Closure", VariablesReference: server.reference(free)})
+	}
+	scopes = append(scopes, scope{Name: "Globals", VariablesReference: server.reference(debugger.Globals())})
+	return scopes, nil
+}
+
+// Registers variables for a later variables request, needs mu held
+func (server *Server) reference(variables []vm.Variable) int {
+	server.handles = append(server.handles, func() []vm.Variable { return variables })
+	return len(server.handles)
+}
+
+func (server *Server) variables(reference int) ([]variable, error) {
+	_, release, err := server.pausedDebugger()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if reference < 1 || reference > len(server.handles) {
+		return nil, fmt.Errorf("unknown variablesReference %d", reference)
+	}
+
+	variables := []variable{}
+	for _, v := range server.handles[reference-1]() {
+		variables = append(variables, server.describe(v))
+	}
+	return variables, nil
+}
+
+// Arrays and hashes get a reference to their elements so clients can expand
+// them. Needs mu held
+func (server *Server) describe(v vm.Variable) variable {
+	described := variable{Name: v.Name, Value: v.Value.Inspect(), Type: string(v.Value.Type())}
+
+	var children []vm.Variable
+	switch value := v.Value.(type) {
+	case *object.Array:
+		for i, element := range value.Elements {
+			children = append(children, vm.Variable{Name: fmt.Sprint(i), Value: element})
+		}
+	case *object.Hash:
+		for _, pair := range value.Pairs {
+			children = append(children, vm.Variable{Name: pair.Key.Inspect(), Value: pair.Value})
+		}
+		sort.Slice(children, func(i, j int) bool { return children[i].Name < children[j].Name })
+	}
+	if len(children) > 0 {
+		server.handles = append(server.handles, func() []vm.Variable { return children })
+		described.VariablesReference = len(server.handles)
+	}
+	return described
+}
+
+// Only variable names can be evaluated, the VM can't run code while paused
+func (server *Server) evaluate(arguments *evaluateArguments) (variable, error) {
+	debugger, release, err := server.pausedDebugger()
+	if err != nil {
+		return variable{}, err
+	}
+	defer release()
+
+	name := strings.TrimSpace(arguments.Expression)
+	frame := arguments.FrameID - 1
+	if frame < 0 {
+		frame = 0
+	}
+	value, ok := debugger.Lookup(frame, name)
+	if !ok {
+		return variable{}, fmt.Errorf("%s is not set", name)
+	}
+	return server.describe(vm.Variable{Name: name, Value: value}), nil
+}
+
+func (server *Server) respond(request *request, body interface{}) {
+	server.send(&response{
+		Type:       "response",
+		RequestSeq: request.Seq,
+		Command:    request.Command,
+		Success:    true,
+		Body:       body,
+	})
+}
+
+func (server *Server) fail(request *request, err error) {
+	server.send(&response{
+		Type:       "response",
+		RequestSeq: request.Seq,
+		Command:    request.Command,
+		Message:    err.Error(),
+	})
+}
+
+func (server *Server) event(name string, body interface{}) {
+	server.send(&event{Type: "event", Event: name, Body: body})
+}
+
+func (server *Server) output(category string, text string) {
+	server.event("output", map[string]interface{}{"category": category, "output": text})
+}
+
+func (server *Server) send(message interface{}) {
+	server.writeMu.Lock()
+	defer server.writeMu.Unlock()
+
+	server.seq++
+	switch message := message.(type) {
+	case *response:
+		message.Seq = server.seq
+	case *event:
+		message.Seq = server.seq
+	}
+	// Nothing can be reported once the client stopped listening
+	jsonrpc.WriteMessage(server.out, message)
+}
+
+// Sends what the program prints to the client
+type outputWriter struct {
+	server   *Server
+	category string
+}
+
+func (writer *outputWriter) Write(p []byte) (int, error) {
+	writer.server.output(writer.category, string(p))
+	return len(p), nil
+}
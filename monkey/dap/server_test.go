@@ -0,0 +1,369 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"monkey/jsonrpc"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// A scripted client talking to a server over pipes
+type client struct {
+	t        *testing.T
+	out      io.Writer
+	messages chan message
+	seq      int
+	served   chan error
+}
+
+// Any message the server sends, with the body left for the test to decode
+type message struct {
+	Type       string          `json:"type"`
+	Seq        int             `json:"seq"`
+	Command    string          `json:"command"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+func newClient(t *testing.T) *client {
+	t.Helper()
+
+	requests, requestWriter := io.Pipe()
+	responseReader, responses := io.Pipe()
+	c := &client{t: t, out: requestWriter, messages: make(chan message, 100), served: make(chan error, 1)}
+
+	server := NewServer(requests, responses)
+	go func() {
+		c.served <- server.Serve()
+		responses.Close()
+	}()
+
+	go func() {
+		reader := bufio.NewReader(responseReader)
+		for {
+			body, err := jsonrpc.ReadMessage(reader)
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			var m message
+			if err := json.Unmarshal(body, &m); err != nil {
+				t.Errorf("invalid message %s: %s", body, err)
+			}
+			c.messages <- m
+		}
+	}()
+
+	t.Cleanup(func() { requestWriter.Close() })
+	return c
+}
+
+func (c *client) send(command string, arguments interface{}) int {
+	c.t.Helper()
+	c.seq++
+	err := jsonrpc.WriteMessage(c.out, map[string]interface{}{
+		"seq": c.seq, "type": "request", "command": command, "arguments": arguments,
+	})
+	if err != nil {
+		c.t.Fatalf("writing %s: %s", command, err)
+	}
+	return c.seq
+}
+
+func (c *client) next() message {
+	c.t.Helper()
+	select {
+	case m, ok := <-c.messages:
+		if !ok {
+			c.t.Fatal("server closed the connection")
+		}
+		return m
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timed out waiting for the server")
+	}
+	return message{}
+}
+
+// Sends a request and returns its response, decoding the body into body when
+// it isn't nil. Events arriving first must be expected separately
+func (c *client) request(command string, arguments interface{}, body interface{}) message {
+	c.t.Helper()
+	seq := c.send(command, arguments)
+
+	m := c.next()
+	if m.Type != "response" || m.RequestSeq != seq || m.Command != command {
+		c.t.Fatalf("expected the response to %s, got %+v", command, m)
+	}
+	if m.Success && body != nil {
+		if err := json.Unmarshal(m.Body, body); err != nil {
+			c.t.Fatalf("invalid %s body %s: %s", command, m.Body, err)
+		}
+	}
+	return m
+}
+
+func (c *client) expectEvent(name string, body interface{}) {
+	c.t.Helper()
+	m := c.next()
+	if m.Type != "event" || m.Event != name {
+		c.t.Fatalf("expected a %s event, got %+v (%s)", name, m, m.Body)
+	}
+	if body != nil {
+		if err := json.Unmarshal(m.Body, body); err != nil {
+			c.t.Fatalf("invalid %s body %s: %s", name, m.Body, err)
+		}
+	}
+}
+
+func (c *client) expectStopped(reason string, function string, line int) []stackFrame {
+	c.t.Helper()
+	stopped := struct{ Reason string }{}
+	c.expectEvent("stopped", &stopped)
+	if stopped.Reason != reason {
+		c.t.Fatalf("wrong stop reason. want=%q, got=%q", reason, stopped.Reason)
+	}
+
+	trace := struct{ StackFrames []stackFrame }{}
+	c.request("stackTrace", map[string]interface{}{"threadId": threadID}, &trace)
+	top := trace.StackFrames[0]
+	if top.Name != function || top.Line != line {
+		c.t.Fatalf("wrong location. want=%s:%d, got=%s:%d", function, line, top.Name, top.Line)
+	}
+	return trace.StackFrames
+}
+
+func (c *client) variables(reference int) map[string]variable {
+	c.t.Helper()
+	body := struct{ Variables []variable }{}
+	c.request("variables", map[string]interface{}{"variablesReference": reference}, &body)
+
+	variables := map[string]variable{}
+	for _, v := range body.Variables {
+		variables[v.Name] = v
+	}
+	return variables
+}
+
+func (c *client) expectOutput(category string, text string) {
+	c.t.Helper()
+	output := struct{ Category, Output string }{}
+	c.expectEvent("output", &output)
+	if output.Category != category || output.Output != text {
+		c.t.Fatalf("wrong output. want=%s %q, got=%s %q", category, text, output.Category, output.Output)
+	}
+}
+
+func (c *client) expectExit(code int) {
+	c.t.Helper()
+	exited := struct{ ExitCode int }{}
+	c.expectEvent("exited", &exited)
+	if exited.ExitCode != code {
+		c.t.Fatalf("wrong exit code. want=%d, got=%d", code, exited.ExitCode)
+	}
+	c.expectEvent("terminated", nil)
+}
+
+// Ends the session, skipping the events of a program killed on the way
+func (c *client) disconnect() {
+	c.t.Helper()
+	c.send("disconnect", nil)
+	for c.next().Type != "response" {
+	}
+	select {
+	case err := <-c.served:
+		if err != nil {
+			c.t.Fatalf("Serve returned an error: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("Serve did not return after disconnect")
+	}
+}
+
+func writeProgram(t *testing.T, source string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "program.mk")
+	err := os.WriteFile(path, []byte(source), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const program = `puts("start");
+let counter = fn(start) {
+  let step = [1, 2];
+  fn(x) {
+    let total = start + x * step[1];
+    total
+  }
+};
+let add = counter(10);
+let a = add(1);
+puts(a);
+`
+
+// Starts a session the way editors do, with breakpoints set between launch
+// and configurationDone
+func launch(t *testing.T, path string, arguments map[string]interface{}, lines ...int) (*client, []breakpoint) {
+	c := newClient(t)
+
+	capabilities := map[string]bool{}
+	c.request("initialize", map[string]interface{}{"adapterID": "monkey"}, &capabilities)
+	if !capabilities["supportsConfigurationDoneRequest"] {
+		t.Fatalf("configurationDone not supported: %v", capabilities)
+	}
+	c.expectEvent("initialized", nil)
+
+	arguments["program"] = path
+	response := c.request("launch", arguments, nil)
+	if !response.Success {
+		t.Fatalf("launch failed: %s", response.Message)
+	}
+
+	requested := []map[string]int{}
+	for _, line := range lines {
+		requested = append(requested, map[string]int{"line": line})
+	}
+	result := struct{ Breakpoints []breakpoint }{}
+	c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]string{"path": path},
+		"breakpoints": requested,
+	}, &result)
+
+	c.request("configurationDone", nil, nil)
+	return c, result.Breakpoints
+}
+
+func TestDebugSession(t *testing.T) {
+	path := writeProgram(t, program)
+	c, breakpoints := launch(t, path, map[string]interface{}{}, 5, 7)
+
+	if !breakpoints[0].Verified || breakpoints[1].Verified {
+		t.Fatalf("expected only the breakpoint on line 5 to be verified, got %+v", breakpoints)
+	}
+
+	c.expectOutput("stdout", "start\n")
+	frames := c.expectStopped("breakpoint", "<anonymous>", 5)
+	if len(frames) != 2 || frames[1].Name != "main" || frames[1].Line != 10 || frames[0].Source.Path != path {
+		t.Fatalf("wrong stack trace %+v", frames)
+	}
+
+	scopes := struct{ Scopes []scope }{}
+	c.request("scopes", map[string]interface{}{"frameId": frames[0].ID}, &scopes)
+	if len(scopes.Scopes) != 3 {
+		t.Fatalf("expected locals, closure and globals scopes, got %+v", scopes.Scopes)
+	}
+
+	locals := c.variables(scopes.Scopes[0].VariablesReference)
+	if len(locals) != 1 || locals["x"].Value != "1" || locals["x"].Type != "INTEGER" {
+		t.Errorf("wrong locals %+v", locals)
+	}
+
+	free := c.variables(scopes.Scopes[1].VariablesReference)
+	if free["start"].Value != "10" || free["step"].Value != "[1, 2]" {
+		t.Errorf("wrong closure variables %+v", free)
+	}
+	elements := c.variables(free["step"].VariablesReference)
+	if elements["0"].Value != "1" || elements["1"].Value != "2" {
+		t.Errorf("wrong array elements %+v", elements)
+	}
+
+	globals := c.variables(scopes.Scopes[2].VariablesReference)
+	if _, ok := globals["counter"]; !ok || len(globals) != 2 {
+		t.Errorf("wrong globals %+v", globals)
+	}
+
+	evaluated := struct{ Result string }{}
+	c.request("evaluate", map[string]interface{}{"expression": "start", "frameId": frames[0].ID}, &evaluated)
+	if evaluated.Result != "10" {
+		t.Errorf("wrong evaluate result %q", evaluated.Result)
+	}
+
+	c.request("next", map[string]interface{}{"threadId": threadID}, nil)
+	c.expectStopped("step", "<anonymous>", 6)
+
+	c.request("stepOut", map[string]interface{}{"threadId": threadID}, nil)
+	c.expectStopped("step", "main", 10)
+
+	c.request("stepIn", map[string]interface{}{"threadId": threadID}, nil)
+	c.expectStopped("step", "main", 11)
+
+	c.request("continue", map[string]interface{}{"threadId": threadID}, nil)
+	c.expectOutput("stdout", "12\n")
+	c.expectExit(0)
+
+	c.disconnect()
+}
+
+func TestFunctionBreakpointsAndStopOnEntry(t *testing.T) {
+	path := writeProgram(t, program)
+	c, _ := launch(t, path, map[string]interface{}{"stopOnEntry": true})
+
+	c.expectStopped("entry", "main", 1)
+
+	c.request("setFunctionBreakpoints", map[string]interface{}{
+		"breakpoints": []map[string]string{{"name": "counter"}},
+	}, nil)
+	c.request("continue", nil, nil)
+	c.expectOutput("stdout", "start\n")
+	c.expectStopped("breakpoint", "counter", 3)
+
+	c.disconnect()
+}
+
+func TestFailures(t *testing.T) {
+	path := writeProgram(t, "let a = 1;\nlet b = a / 0;\n")
+	c, _ := launch(t, path, map[string]interface{}{})
+
+	c.expectOutput("stderr", "runtime error: division by zero\n")
+	c.expectExit(1)
+
+	tests := []struct {
+		command   string
+		arguments interface{}
+		expected  string
+	}{
+		{"launch", map[string]string{"program": path}, "a program has already been launched"},
+		{"stackTrace", nil, "the program is not paused"},
+		{"continue", nil, "the program is not paused"},
+		{"variables", map[string]int{"variablesReference": 1}, "the program is not paused"},
+		{"goto", nil, "unsupported request goto"},
+	}
+	for _, tt := range tests {
+		response := c.request(tt.command, tt.arguments, nil)
+		if response.Success || response.Message != tt.expected {
+			t.Errorf("%s: expected failure %q, got %+v", tt.command, tt.expected, response)
+		}
+	}
+
+	c.disconnect()
+
+	c = newClient(t)
+	response := c.request("launch", map[string]string{"program": filepath.Join(t.TempDir(), "missing.mk")}, nil)
+	if response.Success {
+		t.Errorf("launching a missing program succeeded")
+	}
+	c.disconnect()
+}
+
+func TestDisconnectWhilePaused(t *testing.T) {
+	path := writeProgram(t, program)
+	c, _ := launch(t, path, map[string]interface{}{}, 5)
+
+	c.expectOutput("stdout", "start\n")
+	c.expectStopped("breakpoint", "<anonymous>", 5)
+
+	// The program is killed first, it reports no error
+	c.send("disconnect", nil)
+	c.expectExit(0)
+	if m := c.next(); m.Type != "response" || m.Command != "disconnect" {
+		t.Fatalf("expected the disconnect response, got %+v", m)
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"monkey/compiler"
+	"monkey/module"
+	"monkey/object"
+	"monkey/vm"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const debugHelp = `Commands:
+  break, b LINE|FUNCTION   stop at a line or whenever a function is called
+  delete LINE|FUNCTION     remove a breakpoint, or all of them without an argument
+  breakpoints              list the breakpoints
+  continue, c              run until the next breakpoint
+  step, s                  run to the next statement, entering calls
+  next, n                  run to the next statement, stepping over calls
+  out, o                   run until the current function returns
+  backtrace, bt            print the call stack
+  frame N                  select frame N of the backtrace for inspection
+  locals                   print the local variables
+  free                     print the variables the closure captured
+  globals                  print the global variables
+  stack                    print the values on the operand stack
+  print, p NAME            print a variable
+  list, l                  print the source around the current line
+  quit, q                  stop the program
+`
+
+func debugCommand(args []string) int {
+	flags := newFlagSet("monkey debug")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "monkey debug: no file given")
+		flags.Usage()
+		return 2
+	}
+
+	err := debug(flags.Arg(0), flags.Args()[1:], os.Stdin, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+type debugSession struct {
+	in       *bufio.Reader
+	out      io.Writer
+	source   []string
+	selected int // Frame the inspection commands look at
+}
+
+// Runs a script under the debugger, which stops before the first statement.
+// The script reads its input from the same stream as the debugger commands
+func debug(path string, args []string, in io.Reader, out io.Writer) error {
+	input, err := readSource(path)
+	if err != nil {
+		return err
+	}
+
+	var bytecode *compiler.Bytecode
+	var symbols *compiler.SymbolTable
+	var source []string // Precompiled files come without it
+	if compiler.IsPrecompiled(input) {
+		bytecode = &compiler.Bytecode{}
+		err := bytecode.UnmarshalBinary(input)
+		if err != nil {
+			return err
+		}
+		err = vm.Verify(bytecode)
+		if err != nil {
+			return err
+		}
+	} else {
+		program, err := parse(string(input))
+		if err != nil {
+			return err
+		}
+		comp := compiler.New()
+		err = comp.Compile(program)
+		if err != nil {
+			return fmt.Errorf("compile error: %s", err)
+		}
+		bytecode, symbols = comp.Bytecode(), comp.SymbolTable()
+		source = strings.Split(string(input), "\n")
+	}
+
+	session := &debugSession{in: bufio.NewReader(in), out: out, source: source}
+
+	runtime := object.NewRuntime()
+	runtime.Args = args
+	runtime.Stdin = session.in
+	runtime.Stdout = out
+	runtime.Importer = module.NewLoader("vm", filepath.Dir(path))
+
+	machine := vm.New(bytecode)
+	machine.SetRuntime(runtime)
+	debugger := vm.NewDebugger(machine, symbols)
+	debugger.StopOnEntry = true
+	debugger.Stopped = session.stopped
+
+	err = machine.Run()
+	if errors.Is(err, vm.ErrKilled) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("runtime error: %s", err)
+	}
+	fmt.Fprintln(out, "program finished")
+	return nil
+}
+
+// Reads commands until one of them resumes the program
+func (session *debugSession) stopped(debugger *vm.Debugger, reason vm.StopReason) {
+	session.selected = 0
+	frame := debugger.Frames()[0]
+	fmt.Fprintf(session.out, "stopped at line %d in %s (%s)\n", frame.Line, frame.Function, reason)
+	session.printLine(frame.Line, true)
+
+	for {
+		fmt.Fprint(session.out, "(debug) ")
+		line, err := session.in.ReadString('\n')
+		if err != nil && line == "" {
+			debugger.Kill()
+			return
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		command, args := fields[0], fields[1:]
+
+		switch command {
+		case "continue", "c":
+			debugger.Continue()
+			return
+		case "step", "s":
+			debugger.StepInto()
+			return
+		case "next", "n":
+			debugger.StepOver()
+			return
+		case "out", "o":
+			debugger.StepOut()
+			return
+		case "quit", "q":
+			debugger.Kill()
+			return
+		default:
+			err := session.inspect(debugger, command, args)
+			if err != nil {
+				fmt.Fprintln(session.out, err)
+			}
+		}
+	}
+}
+
+// Runs the commands that leave the program paused
+func (session *debugSession) inspect(debugger *vm.Debugger, command string, args []string) error {
+	switch command {
+	case "break", "b":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: break LINE|FUNCTION")
+		}
+		if isNumber(args[0]) {
+			line, _ := strconv.Atoi(args[0])
+			debugger.BreakAtLine(line)
+		} else {
+			debugger.BreakAtFunction(args[0])
+		}
+
+	case "delete":
+		switch {
+		case len(args) == 0:
+			debugger.ClearBreakpoints()
+		case isNumber(args[0]):
+			line, _ := strconv.Atoi(args[0])
+			debugger.ClearLine(line)
+		default:
+			debugger.ClearFunction(args[0])
+		}
+
+	case "breakpoints":
+		lines, functions := debugger.Breakpoints()
+		for _, line := range lines {
+			fmt.Fprintf(session.out, "line %d\n", line)
+		}
+		for _, name := range functions {
+			fmt.Fprintf(session.out, "fn %s\n", name)
+		}
+
+	case "backtrace", "bt":
+		for i, frame := range debugger.Frames() {
+			marker := " "
+			if i == session.selected {
+				marker = "*"
+			}
+			fmt.Fprintf(session.out, "%s%2d  %s at line %d\n", marker, i, frame.Function, frame.Line)
+		}
+
+	case "frame":
+		if len(args) != 1 || !isNumber(args[0]) {
+			return fmt.Errorf("usage: frame N")
+		}
+		n, _ := strconv.Atoi(args[0])
+		frames := debugger.Frames()
+		if n >= len(frames) {
+			return fmt.Errorf("no frame %d, there are %d", n, len(frames))
+		}
+		session.selected = n
+		fmt.Fprintf(session.out, "%2d  %s at line %d\n", n, frames[n].Function, frames[n].Line)
+		session.printLine(frames[n].Line, true)
+
+	case "locals":
+		variables, err := debugger.Locals(session.selected)
+		if err != nil {
+			return err
+		}
+		session.printVariables(variables)
+
+	case "free":
+		variables, err := debugger.Free(session.selected)
+		if err != nil {
+			return err
+		}
+		session.printVariables(variables)
+
+	case "globals":
+		session.printVariables(debugger.Globals())
+
+	case "stack":
+		values, err := debugger.Stack(session.selected)
+		if err != nil {
+			return err
+		}
+		for i := len(values) - 1; i >= 0; i-- {
+			fmt.Fprintf(session.out, "%4d  %s\n", i, values[i].Inspect())
+		}
+
+	case "print", "p":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: print NAME")
+		}
+		value, ok := debugger.Lookup(session.selected, args[0])
+		if !ok {
+			return fmt.Errorf("%s is not set", args[0])
+		}
+		fmt.Fprintln(session.out, value.Inspect())
+
+	case "list", "l":
+		current := debugger.Frames()[session.selected].Line
+		for line := current - 5; line <= current+5; line++ {
+			session.printLine(line, line == current)
+		}
+
+	case "help", "h":
+		fmt.Fprint(session.out, debugHelp)
+
+	default:
+		return fmt.Errorf("unknown command %q, try help", command)
+	}
+
+	return nil
+}
+
+func (session *debugSession) printLine(line int, current bool) {
+	if line < 1 || line > len(session.source) {
+		return
+	}
+	marker := " "
+	if current {
+		marker = ">"
+	}
+	fmt.Fprintf(session.out, "%s%4d| %s\n", marker, line, session.source[line-1])
+}
+
+func (session *debugSession) printVariables(variables []vm.Variable) {
+	for _, variable := range variables {
+		fmt.Fprintf(session.out, "%s = %s\n", variable.Name, variable.Value.Inspect())
+	}
+}
+
+func isNumber(text string) bool {
+	_, err := strconv.Atoi(text)
+	return err == nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"monkey/compiler"
+	"monkey/disasm"
+	"os"
+)
+
+func disasmCommand(args []string) int {
+	flags := newFlagSet("monkey disasm")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "monkey disasm: expected exactly one file")
+		flags.Usage()
+		return 2
+	}
+
+	err := disassemble(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// Precompiled files carry line tables but neither the source nor the names
+// of globals, so their listings only show instructions and constants
+func disassemble(path string) error {
+	input, err := readSource(path)
+	if err != nil {
+		return err
+	}
+
+	if compiler.IsPrecompiled(input) {
+		bytecode := &compiler.Bytecode{}
+		err := bytecode.UnmarshalBinary(input)
+		if err != nil {
+			return err
+		}
+		return disasm.Fprint(os.Stdout, bytecode, nil, "")
+	}
+
+	program, err := parse(string(input))
+	if err != nil {
+		return err
+	}
+
+	comp := compiler.New()
+	err = comp.Compile(program)
+	if err != nil {
+		return fmt.Errorf("compile error: %s", err)
+	}
+
+	return disasm.Fprint(os.Stdout, comp.Bytecode(), comp.SymbolTable(), string(input))
+}
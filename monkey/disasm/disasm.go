@@ -0,0 +1,219 @@
+package disasm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/object"
+	"sort"
+	"strings"
+)
+
+// Fprint writes a listing of the main program, every function in the constant
+// pool and the remaining constants, which compiler.Assemble turns back into
+// the same bytecode. Symbols names the globals and source is interleaved using
+// the line tables, both are optional
+func Fprint(out io.Writer, bytecode *compiler.Bytecode, symbols *compiler.SymbolTable, source string) error {
+	d := &disassembler{
+		constants: bytecode.Constants,
+		globals:   map[int]string{},
+		source:    strings.Split(source, "\n"),
+	}
+	if source == "" {
+		d.source = nil
+	}
+	if symbols != nil {
+		for _, symbol := range symbols.Symbols() {
+			if symbol.Scope == compiler.GlobalScope {
+				d.globals[symbol.Index] = symbol.Name
+			}
+		}
+	}
+
+	d.listing("main", bytecode.Instructions, bytecode.Lines)
+	for index, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			fmt.Fprintf(&d.out, "\n%s [constant %d, %d params, %d locals]:\n",
+				functionName(fn), index, fn.NumParameters, fn.NumLocals)
+			if len(fn.LocalNames) > 0 {
+				fmt.Fprintf(&d.out, "    locals: %s\n", joinNames(fn.LocalNames))
+			}
+			if len(fn.FreeNames) > 0 {
+				fmt.Fprintf(&d.out, "    free: %s\n", joinNames(fn.FreeNames))
+			}
+			d.locals, d.free = fn.LocalNames, fn.FreeNames
+			d.listing("", fn.Instructions, fn.Lines)
+		}
+	}
+
+	if len(bytecode.Constants) > 0 {
+		fmt.Fprintf(&d.out, "\nconstants:\n")
+		for index := range bytecode.Constants {
+			fmt.Fprintf(&d.out, "%5d  %s\n", index, d.constant(index))
+		}
+	}
+
+	_, err := out.Write(d.out.Bytes())
+	return err
+}
+
+type disassembler struct {
+	out       bytes.Buffer
+	constants []object.Object
+	globals   map[int]string
+	source    []string
+
+	// Names in the function being listed
+	locals []string
+	free   []string
+}
+
+type instruction struct {
+	offset   int
+	op       code.Opcode
+	def      *code.Definition
+	operands []int
+	err      error
+}
+
+// Decodes instructions, stopping at the first one that can't be read
+func decode(ins code.Instructions) []instruction {
+	decoded := []instruction{}
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return append(decoded, instruction{offset: i, err: err})
+		}
+
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if i+1+width > len(ins) {
+			err := fmt.Errorf("%s truncated", def.Name)
+			return append(decoded, instruction{offset: i, err: err})
+		}
+
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		decoded = append(decoded, instruction{offset: i, op: code.Opcode(ins[i]), def: def, operands: operands})
+		i += 1 + read
+	}
+	return decoded
+}
+
+func (d *disassembler) listing(title string, ins code.Instructions, lines code.LineTable) {
+	if title != "" {
+		fmt.Fprintf(&d.out, "%s:\n", title)
+	}
+
+	decoded := decode(ins)
+
+	labels := map[int]string{}
+	targets := []int{}
+	for _, in := range decoded {
+		if in.err == nil && (in.op == code.OpJump || in.op == code.OpJumpNotTruthy) {
+			if _, ok := labels[in.operands[0]]; !ok {
+				labels[in.operands[0]] = ""
+				targets = append(targets, in.operands[0])
+			}
+		}
+	}
+	sort.Ints(targets)
+	for i, target := range targets {
+		labels[target] = fmt.Sprintf("L%d", i+1)
+	}
+
+	lastLine := 0
+	for _, in := range decoded {
+		if line := lines.Line(in.offset); line != lastLine && line > 0 && line <= len(d.source) {
+			fmt.Fprintf(&d.out, "%5d| %s\n", line, strings.TrimRight(d.source[line-1], " \t\r"))
+			lastLine = line
+		}
+		if label, ok := labels[in.offset]; ok {
+			fmt.Fprintf(&d.out, "  %s:\n", label)
+		}
+
+		if in.err != nil {
+			fmt.Fprintf(&d.out, "    %04d  ERROR: %s\n", in.offset, in.err)
+			return
+		}
+
+		text := in.def.Name
+		for _, operand := range in.operands {
+			text += fmt.Sprintf(" %d", operand)
+		}
+		if comment := d.comment(in, labels); comment != "" {
+			fmt.Fprintf(&d.out, "    %04d  %-22s ; %s\n", in.offset, text, comment)
+		} else {
+			fmt.Fprintf(&d.out, "    %04d  %s\n", in.offset, text)
+		}
+	}
+
+	// Jumps past the last instruction land on the end of the function
+	if label, ok := labels[len(ins)]; ok {
+		fmt.Fprintf(&d.out, "  %s:\n    %04d  (end)\n", label, len(ins))
+	}
+}
+
+func (d *disassembler) comment(in instruction, labels map[int]string) string {
+	switch in.op {
+	case code.OpConstant, code.OpClosure:
+		return d.constant(in.operands[0])
+	case code.OpGetGlobal, code.OpSetGlobal:
+		return d.globals[in.operands[0]]
+	case code.OpGetLocal, code.OpSetLocal:
+		return nameAt(d.locals, in.operands[0])
+	case code.OpGetFree:
+		return nameAt(d.free, in.operands[0])
+	case code.OpGetBuiltin:
+		if in.operands[0] < len(object.Builtins) {
+			return object.Builtins[in.operands[0]].Name
+		}
+	case code.OpJump, code.OpJumpNotTruthy:
+		return labels[in.operands[0]]
+	}
+	return ""
+}
+
+func (d *disassembler) constant(index int) string {
+	if index >= len(d.constants) {
+		return "missing constant"
+	}
+
+	switch constant := d.constants[index].(type) {
+	case *object.String:
+		return fmt.Sprintf("%q", constant.Value)
+	case *object.CompiledFunction:
+		return functionName(constant)
+	default:
+		return constant.Inspect()
+	}
+}
+
+func nameAt(names []string, index int) string {
+	if index < len(names) {
+		return names[index]
+	}
+	return ""
+}
+
+// Shadowed locals have no name, they're printed as - to keep the positions
+func joinNames(names []string) string {
+	printed := make([]string, len(names))
+	for i, name := range names {
+		printed[i] = name
+		if name == "" {
+			printed[i] = "-"
+		}
+	}
+	return strings.Join(printed, " ")
+}
+
+func functionName(fn *object.CompiledFunction) string {
+	if fn.Name == "" {
+		return "fn <anonymous>"
+	}
+	return "fn " + fn.Name
+}
@@ -0,0 +1,149 @@
+package disasm
+
+import (
+	"bytes"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"reflect"
+	"testing"
+)
+
+func TestFprint(t *testing.T) {
+	input := `let max = fn(a, b) {
+  if (a > b) { a } else { b }
+};
+puts(max(1, "two"));`
+
+	expected := `main:
+    1| let max = fn(a, b) {
+    0000  OpClosure 0 0          ; fn max
+    0004  OpSetGlobal 0          ; max
+    4| puts(max(1, "two"));
+    0007  OpGetBuiltin 5         ; puts
+    0009  OpGetGlobal 0          ; max
+    0012  OpConstant 1           ; 1
+    0015  OpConstant 2           ; "two"
+    0018  OpCall 2
+    0020  OpCall 1
+    0022  OpPop
+
+fn max [constant 0, 2 params, 2 locals]:
+    locals: a b
+    2|   if (a > b) { a } else { b }
+    0000  OpGetLocal 0           ; a
+    0002  OpGetLocal 1           ; b
+    0004  OpGreaterThan
+    0005  OpJumpNotTruthy 13     ; L1
+    0008  OpGetLocal 0           ; a
+    0010  OpJump 15              ; L2
+  L1:
+    0013  OpGetLocal 1           ; b
+  L2:
+    0015  OpReturnValue
+
+constants:
+    0  fn max
+    1  1
+    2  "two"
+`
+
+	comp := compiler.New()
+	err := comp.Compile(parser.New(lexer.New(input)).ParseProgram())
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var out bytes.Buffer
+	err = Fprint(&out, comp.Bytecode(), comp.SymbolTable(), input)
+	if err != nil {
+		t.Fatalf("Fprint error: %s", err)
+	}
+	if out.String() != expected {
+		t.Errorf("wrong listing.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestFprintWithoutSymbols(t *testing.T) {
+	tests := []struct {
+		bytecode *compiler.Bytecode
+		expected string
+	}{
+		{
+			&compiler.Bytecode{
+				Instructions: concat(code.Make(code.OpGetGlobal, 3), code.Make(code.OpJump, 7), code.Make(code.OpPop)),
+			},
+			"main:\n    0000  OpGetGlobal 3\n    0003  OpJump 7               ; L1\n    0006  OpPop\n  L1:\n    0007  (end)\n",
+		},
+		{
+			&compiler.Bytecode{
+				Instructions: concat(code.Make(code.OpConstant, 0), []byte{255}),
+				Constants:    []object.Object{&object.Integer{Value: 7}},
+			},
+			"main:\n    0000  OpConstant 0           ; 7\n    0003  ERROR: opcode 255 undefined\n\nconstants:\n    0  7\n",
+		},
+		{
+			&compiler.Bytecode{Instructions: code.Make(code.OpConstant, 1)[:2]},
+			"main:\n    0000  ERROR: OpConstant truncated\n",
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		err := Fprint(&out, tt.bytecode, nil, "")
+		if err != nil {
+			t.Fatalf("Fprint error: %s", err)
+		}
+		if out.String() != tt.expected {
+			t.Errorf("wrong listing.\nwant=%q\ngot =%q", tt.expected, out.String())
+		}
+	}
+}
+
+func concat(instructions ...[]byte) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range instructions {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func TestListingRoundTrip(t *testing.T) {
+	inputs := []string{
+		``,
+		`1 + 2 * 3; "semi; colon"`,
+		`let fib = fn(n) {
+  if (n < 2) { return n; }
+  fib(n - 1) + fib(n - 2)
+};
+fib(10)`,
+		`let adder = fn(x) { fn(y) { x + y } }; let m = {"add": adder(1)}; m.add([1][0])`,
+		`let f = fn(a) { let a = a + 1; let b = a; fn() { a + b } }; f(1)()`,
+	}
+
+	for _, input := range inputs {
+		comp := compiler.New()
+		err := comp.Compile(parser.New(lexer.New(input)).ParseProgram())
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		bytecode := comp.Bytecode()
+
+		var listing bytes.Buffer
+		err = Fprint(&listing, bytecode, comp.SymbolTable(), input)
+		if err != nil {
+			t.Fatalf("Fprint error: %s", err)
+		}
+
+		assembled, err := compiler.Assemble(listing.String())
+		if err != nil {
+			t.Fatalf("%q: assemble error: %s\n%s", input, err, listing.String())
+		}
+
+		if !reflect.DeepEqual(assembled, bytecode) {
+			t.Errorf("%q: listing does not round trip.\nwant=%#v\ngot =%#v", input, bytecode, assembled)
+		}
+	}
+}
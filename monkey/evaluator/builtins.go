@@ -5,10 +5,18 @@ import (
 )
 
 var builtins = map[string]*object.Builtin{
-	"len":   object.GetBuiltinByName("len"),
-	"first": object.GetBuiltinByName("first"),
-	"last":  object.GetBuiltinByName("last"),
-	"rest":  object.GetBuiltinByName("rest"),
-	"push":  object.GetBuiltinByName("push"),
-	"puts":  object.GetBuiltinByName("puts"),
+	"len":         object.GetBuiltinByName("len"),
+	"first":       object.GetBuiltinByName("first"),
+	"last":        object.GetBuiltinByName("last"),
+	"rest":        object.GetBuiltinByName("rest"),
+	"push":        object.GetBuiltinByName("push"),
+	"puts":        object.GetBuiltinByName("puts"),
+	"print":       object.GetBuiltinByName("print"),
+	"gets":        object.GetBuiltinByName("gets"),
+	"readline":    object.GetBuiltinByName("readline"),
+	"args":        object.GetBuiltinByName("args"),
+	"import":      object.GetBuiltinByName("import"),
+	"assert":      object.GetBuiltinByName("assert"),
+	"assertEqual": object.GetBuiltinByName("assertEqual"),
+	"assertError": object.GetBuiltinByName("assertError"),
 }
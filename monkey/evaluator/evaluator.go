@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"monkey/ast"
 	"monkey/object"
+	"monkey/token"
 )
 
 var (
@@ -13,24 +14,31 @@ var (
 )
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	if err := env.Runtime().Step(); err != nil {
+		return newError("%s", err)
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
 		return evalProgram(node, env)
 
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		coverStatement(node.Token, env)
+		return errorAt(Eval(node.Expression, env), node.Token)
 
 	case *ast.ReturnStatement:
+		coverStatement(node.Token, env)
 		val := Eval(node.ReturnValue, env)
 		if isError(val) {
-			return val
+			return errorAt(val, node.Token)
 		}
 		return &object.ReturnValue{Value: val}
 
 	case *ast.LetStatement:
+		coverStatement(node.Token, env)
 		val := Eval(node.Value, env)
 		if isError(val) {
-			return val
+			return errorAt(val, node.Token)
 		}
 
 		return env.Set(node.Name.Value, val)
@@ -63,7 +71,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return evalInfixExpression(node.Operator, left, right, env)
 
 	case *ast.BlockStatement:
 		return evalBlockStatement(node, env)
@@ -74,26 +82,31 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Body: body, Env: env}
+		return allocate(env, &object.Function{Parameters: params, Body: body, Env: env})
 
 	case *ast.CallExpression:
 		function := Eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
+		args, err := evalArguments(node.Function, node.Arguments, env)
+		if err != nil {
+			return err
 		}
 
-		return applyFunction(function, args)
+		result := applyFunction(function, args, env.Runtime())
+		// The error was made before the line was known
+		if isError(result) && object.SetAssertionLine(env.Runtime(), node.Token.Line) {
+			return newError("%s", env.Runtime().Err())
+		}
+		return result
 
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
-		return &object.Array{Elements: elements}
+		return allocate(env, &object.Array{Elements: elements})
 
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
@@ -108,6 +121,13 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return index
 		}
 		return evalIndexExpression(left, index)
+
+	case *ast.MemberExpression:
+		left := Eval(node.Object, env)
+		if isError(left) {
+			return left
+		}
+		return evalIndexExpression(left, &object.String{Value: node.Member.Value})
 	}
 
 	return nil
@@ -182,12 +202,12 @@ func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 	return &object.Integer{Value: -value}
 }
 
-func evalInfixExpression(operator string, left, right object.Object) object.Object {
+func evalInfixExpression(operator string, left, right object.Object, env *object.Environment) object.Object {
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-		return evalStringInfixExpression(operator, left, right)
+		return evalStringInfixExpression(operator, left, right, env)
 	case operator == "==":
 		return nativeBoolToBooleanObject(left == right)
 	case operator == "!=":
@@ -213,6 +233,9 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
 		return &object.Integer{Value: leftVal / rightVal}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
@@ -227,13 +250,13 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	}
 }
 
-func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
+func evalStringInfixExpression(operator string, left, right object.Object, env *object.Environment) object.Object {
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
 
 	switch operator {
 	case "+":
-		return &object.String{Value: leftVal + rightVal}
+		return allocate(env, &object.String{Value: leftVal + rightVal})
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
@@ -249,6 +272,10 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 		return condition
 	}
 
+	if coverage := env.Coverage(); coverage != nil {
+		coverage.Branch(ie.Token.Line, isTruthy(condition))
+	}
+
 	if isTruthy(condition) {
 		return Eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
@@ -258,6 +285,12 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 	}
 }
 
+func coverStatement(tok token.Token, env *object.Environment) {
+	if coverage := env.Coverage(); coverage != nil {
+		coverage.Statement(tok.Line)
+	}
+}
+
 func isTruthy(obj object.Object) bool {
 	switch {
 	case obj == NULL:
@@ -280,6 +313,22 @@ func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
+func allocate(env *object.Environment, obj object.Object) object.Object {
+	if err := env.Runtime().Allocate(obj); err != nil {
+		return newError("%s", err)
+	}
+	return obj
+}
+
+// Records the line of the statement at tok on an error, unless a statement
+// nested in it already did, so the innermost one is kept as the VM does
+func errorAt(obj object.Object, tok token.Token) object.Object {
+	if err, ok := obj.(*object.Error); ok && err.Line == 0 {
+		err.Line = tok.Line
+	}
+	return obj
+}
+
 func isError(obj object.Object) bool {
 	if obj != nil {
 		return obj.Type() == object.ERROR_OBJ
@@ -311,15 +360,75 @@ func evalExpressions(expressions []ast.Expression, env *object.Environment) []ob
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// Evaluates the arguments to a call of callee, returning the error that stopped
+// it if one did. When callee names assertError, an error returned by a builtin
+// called directly in the arguments is kept as a value to check, as the VM's
+// OpTryCall does, while any other error stops it as usual
+func evalArguments(callee ast.Expression, exps []ast.Expression, env *object.Environment) ([]object.Object, object.Object) {
+	if !isBuiltin(callee, "assertError", env) {
+		args := evalExpressions(exps, env)
+		if len(args) == 1 && isError(args[0]) {
+			return nil, args[0]
+		}
+		return args, nil
+	}
+
+	var result []object.Object
+	for _, exp := range exps {
+		call, ok := exp.(*ast.CallExpression)
+		if !ok {
+			evaluated := Eval(exp, env)
+			if isError(evaluated) {
+				return nil, evaluated
+			}
+			result = append(result, evaluated)
+			continue
+		}
+
+		function := Eval(call.Function, env)
+		if isError(function) {
+			return nil, function
+		}
+		args, err := evalArguments(call.Function, call.Arguments, env)
+		if err != nil {
+			return nil, err
+		}
+		evaluated := applyFunction(function, args, env.Runtime())
+		if _, builtin := function.(*object.Builtin); isError(evaluated) && !builtin {
+			return nil, evaluated
+		}
+		result = append(result, evaluated)
+	}
+	return result, nil
+}
+
+// Reports whether exp names the builtin called name, not shadowed by a binding.
+// Going by the name, as the compiler has to, an alias doesn't count
+func isBuiltin(exp ast.Expression, name string, env *object.Environment) bool {
+	ident, ok := exp.(*ast.Identifier)
+	if !ok || ident.Value != name {
+		return false
+	}
+	_, shadowed := env.Get(name)
+	return !shadowed
+}
+
+func applyFunction(fn object.Object, args []object.Object, runtime *object.Runtime) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
+		if len(args) != len(fn.Parameters) {
+			return newError("wrong number of arguments: got=%d, expected=%d", len(args), len(fn.Parameters))
+		}
+		if err := runtime.Enter(); err != nil {
+			return newError("%s", err)
+		}
 		extendedEnv := extendFunctionEnv(fn, args)
 		evaluated := Eval(fn.Body, extendedEnv)
+		runtime.Leave()
 		return unwrapReturnValue(evaluated)
 
 	case *object.Builtin:
-		if result := fn.Fn(args...); result != nil {
+		if result := fn.Fn(runtime, args...); result != nil {
 			return result
 		}
 		return NULL
@@ -345,6 +454,10 @@ func unwrapReturnValue(obj object.Object) object.Object {
 }
 
 func evalIndexExpression(left, index object.Object) object.Object {
+	if holder, ok := left.(object.HasMembers); ok {
+		return evalMemberIndexExpression(holder, index)
+	}
+
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
@@ -355,6 +468,23 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	}
 }
 
+func evalMemberIndexExpression(holder object.HasMembers, index object.Object) object.Object {
+	name, ok := index.(*object.String)
+	if !ok {
+		return newError("unusable as member name: %s", index.Type())
+	}
+
+	member, ok := holder.Member(name.Value)
+	if !ok {
+		return newError("undefined member %s on %s", name.Value, holder.Type())
+	}
+	if member == nil {
+		return NULL
+	}
+
+	return member
+}
+
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrayObject := array.(*object.Array)
 	idx := index.(*object.Integer).Value
@@ -389,7 +519,7 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 		pairs[hashed] = object.HashPair{Key: key, Value: value}
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return allocate(env, &object.Hash{Pairs: pairs})
 }
 
 func evalHashIndexExpression(hash, index object.Object) object.Object {
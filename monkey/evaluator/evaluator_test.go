@@ -1,9 +1,13 @@
 package evaluator
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"strings"
 	"testing"
 )
 
@@ -211,6 +215,10 @@ func TestErrorHandling(t *testing.T) {
 			"-true",
 			"unknown operator: -BOOLEAN",
 		},
+		{
+			"10 / (5 - 5)",
+			"division by zero",
+		},
 		{
 			"true + false;",
 			"unknown operator: BOOLEAN + BOOLEAN",
@@ -266,6 +274,76 @@ if (10 > 1) {
 	}
 }
 
+func TestCallDepth(t *testing.T) {
+	input := `let f = fn(x) { if (x == 0) { 0 } else { 1 + f(x - 1) } };`
+	tests := []struct {
+		call     string
+		expected interface{}
+	}{
+		{"f(1000)", 1000},
+		{"f(2000)", "stack overflow"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(input + tt.call)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok || errObj.Message != expected {
+				t.Errorf("wrong result for %q. want error %q, got=%+v", tt.call, expected, evaluated)
+			}
+		}
+	}
+
+	// Calls that returned no longer count
+	env := object.NewEnvironment()
+	Eval(parser.New(lexer.New(input+"f(2000)")).ParseProgram(), env)
+	testIntegerObject(t, Eval(parser.New(lexer.New("f(1000)")).ParseProgram(), env), 1000)
+}
+
+func TestCallingFunctionsWithWrongArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = fn(x) { x }; f()`, "wrong number of arguments: got=0, expected=1"},
+		{`fn() { 1; }(1);`, "wrong number of arguments: got=1, expected=0"},
+		{`fn(a, b) { a + b; }(1);`, "wrong number of arguments: got=1, expected=2"},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok || errObj.Message != tt.expected {
+			t.Errorf("wrong result for %q. want error %q, got=%+v", tt.input, tt.expected, errObj)
+		}
+	}
+}
+
+func TestErrorLines(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"1;\n-true", 2},
+		{"let f = fn(x) {\n  let y = x + 1;\n  y / 0\n};\nf(1)", 3},
+		{"let a = 1;\nlet b =\n  len(a);", 2},
+		{"if (true) {\n  return missing;\n}", 2},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Line != tt.expected {
+			t.Errorf("wrong line for %q. want=%d, got=%d", tt.input, tt.expected, errObj.Line)
+		}
+	}
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -381,6 +459,8 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`last([1, 2, 3])`, 3},
 		{`last(true)`, "argument to `last` not supported, got BOOLEAN"},
 		{`rest(true)`, "argument to `rest` not supported, got BOOLEAN"},
+		{`gets(1)`, "wrong number of arguments to `gets`. got=1, want=0"},
+		{`readline(1)`, "wrong number of arguments to `readline`. got=1, want=0"},
 	}
 
 	for _, tt := range tests {
@@ -566,3 +646,227 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestHostObjects(t *testing.T) {
+	headers := map[string]string{"X": "forty-two"}
+	requestType := object.NewHostType("REQUEST").
+		Method("header", func(host *object.Host, args ...object.Object) object.Object {
+			name := args[0].(*object.String).Value
+			return &object.String{Value: host.Value.(map[string]string)[name]}
+		})
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`req.header("X")`, "forty-two"},
+		{`let h = req.header; h("Y") == ""`, true},
+		{`req.missing`, "undefined member missing on REQUEST"},
+		{`req[1]`, "unusable as member name: INTEGER"},
+		{`{"a": 1}.a`, 1},
+		{`disguised + 1`, "type mismatch: HOST + INTEGER"},
+		{`len(disguised)`, "argument to `len` not supported, got HOST"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		env := object.NewEnvironment()
+		env.Set("req", requestType.Wrap(headers))
+		env.Set("disguised", &object.Host{Kind: &object.HostType{Name: object.INTEGER_OBJ}})
+
+		evaluated := Eval(program, env)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			switch result := evaluated.(type) {
+			case *object.String:
+				if result.Value != expected {
+					t.Errorf("String has wrong value. want=%q, got=%q", expected, result.Value)
+				}
+			case *object.Error:
+				if result.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, result.Message)
+				}
+			default:
+				t.Errorf("object is not String or Error. got=%T (%+v)", evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestExecutionBudgets(t *testing.T) {
+	fibonacci := `
+	let fibonacci = fn(x) {
+		if (x < 2) { return x; }
+		fibonacci(x - 1) + fibonacci(x - 2);
+	};
+	fibonacci(15);
+	`
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		input    string
+		maxSteps int
+		ctx      context.Context
+		expected error
+	}{
+		{fibonacci, 0, context.Background(), nil},
+		{fibonacci, 100, context.Background(), object.ErrStepLimitExceeded},
+		{fibonacci, 0, cancelled, object.ErrCancelled},
+		{`let f = fn(x) { f(x + 1) }; f(0);`, 1000, context.Background(), object.ErrStepLimitExceeded},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		runtime := object.NewRuntime()
+		runtime.Context = tt.ctx
+		runtime.MaxSteps = tt.maxSteps
+
+		env := object.NewEnvironment()
+		env.SetRuntime(runtime)
+		evaluated := Eval(program, env)
+
+		if !errors.Is(runtime.Err(), tt.expected) {
+			t.Errorf("wrong runtime error: want=%v, got=%v", tt.expected, runtime.Err())
+		}
+
+		if tt.expected == nil {
+			testIntegerObject(t, evaluated, 610)
+			continue
+		}
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != runtime.Err().Error() {
+			t.Errorf("wrong error message. expected=%q, got=%q", runtime.Err(), errObj.Message)
+		}
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	tests := []string{
+		`let grow = fn(s) { grow(s + s) }; grow("monkey");`,
+		`let fill = fn(arr) { fill(push(arr, arr)) }; fill([]);`,
+		`let nest = fn(h) { nest({"h": h, "a": [h, h, h]}) }; nest({});`,
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		runtime := object.NewRuntime()
+		runtime.MaxMemory = 4096
+
+		env := object.NewEnvironment()
+		env.SetRuntime(runtime)
+		evaluated := Eval(program, env)
+
+		if !errors.Is(runtime.Err(), object.ErrMemoryLimit) {
+			t.Errorf("wrong runtime error for %q: want=%v, got=%v", input, object.ErrMemoryLimit, runtime.Err())
+		}
+		if _, ok := evaluated.(*object.Error); !ok {
+			t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+		}
+		if runtime.MemoryStats().Bytes <= runtime.MaxMemory {
+			t.Errorf("memory stats below limit. got=%s", runtime.MemoryStats())
+		}
+	}
+}
+
+func TestScriptIO(t *testing.T) {
+	tests := []struct {
+		input          string
+		stdin          string
+		expected       interface{}
+		expectedOutput string
+	}{
+		{`puts("hello", 1, [1, "two"])`, "", nil, "hello\n1\n[1, two]\n"},
+		{`print("a", 1); print("b")`, "", nil, "a1b"},
+		{`gets()`, "first\nsecond\n", "first", ""},
+		{`gets(); readline()`, "first\nsecond", "second", ""},
+		{`gets(); gets()`, "only\n", nil, ""},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		var stdout bytes.Buffer
+		runtime := object.NewRuntime()
+		runtime.Stdout = &stdout
+		runtime.Stdin = strings.NewReader(tt.stdin)
+
+		env := object.NewEnvironment()
+		env.SetRuntime(runtime)
+		evaluated := Eval(program, env)
+
+		switch expected := tt.expected.(type) {
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			} else if str.Value != expected {
+				t.Errorf("String has wrong value. want=%q, got=%q", expected, str.Value)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+
+		if stdout.String() != tt.expectedOutput {
+			t.Errorf("wrong output. want=%q, got=%q", tt.expectedOutput, stdout.String())
+		}
+	}
+}
+
+func TestAssertions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // Error the runtime was aborted with, if any
+	}{
+		{`assert(true); assert(1 == 1, "equal"); assert(0)`, ""},
+		{`assert(false)`, "assertion failed on line 1: got false"},
+		{"1;\nassert(1 > 2, \"order\")", "assertion failed on line 2: order: got false"},
+		{`assertEqual([1, {"a": "b"}], [1, {"a": "b"}]); assertEqual(if (false) { 1 }, if (false) { 2 })`, ""},
+		{`assertEqual([1, "2"], [1, 2])`, `assertion failed on line 1: expected [1, 2], got [1, "2"]`},
+		{`assertEqual({"a": 1}, {"a": 1, "b": 2}, "hash")`, `assertion failed on line 1: hash: expected {"a": 1, "b": 2}, got {"a": 1}`},
+		{`assertError(len(1)); assertError(first(1), "not supported")`, ""},
+		{`assertError(len([]))`, "assertion failed on line 1: expected an error, got 0"},
+		{`assertError(len(1), "missing")`, "assertion failed on line 1: expected an error containing \"missing\", got \"argument to `len` not supported, got INTEGER\""},
+		{"let check = fn(x) {\n  assertEqual(x, 2);\n};\ncheck(3);", "assertion failed on line 2: expected 2, got 3"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+
+		runtime := object.NewRuntime()
+		env := object.NewEnvironment()
+		env.SetRuntime(runtime)
+		evaluated := Eval(program, env)
+
+		got := ""
+		if runtime.Err() != nil {
+			got = runtime.Err().Error()
+		}
+		if got != tt.expected {
+			t.Errorf("wrong runtime error for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+		if errObj, ok := evaluated.(*object.Error); ok && errObj.Message != got {
+			t.Errorf("wrong error message for %q. want=%q, got=%q", tt.input, got, errObj.Message)
+		}
+	}
+}
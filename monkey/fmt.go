@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"monkey/format"
+	"os"
+	"path/filepath"
+)
+
+const sourceExtension = ".mk"
+
+type fmtOptions struct {
+	list  *bool
+	write *bool
+}
+
+func fmtCommand(args []string) int {
+	flags := newFlagSet("monkey fmt")
+	opts := fmtOptions{
+		list:  flags.Bool("l", false, "list files whose formatting differs instead of printing them"),
+		write: flags.Bool("w", false, "write the result back to the files instead of printing it"),
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		if *opts.list || *opts.write {
+			fmt.Fprintln(os.Stderr, "monkey fmt: -l and -w need files to work on")
+			return 2
+		}
+		err := formatStream(os.Stdin, os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	status := 0
+	for _, path := range flags.Args() {
+		err := formatPath(path, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+		}
+	}
+	return status
+}
+
+func formatStream(in io.Reader, out io.Writer) error {
+	source, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	formatted, err := format.Source(source)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(formatted)
+	return err
+}
+
+// Directories are searched for .mk files, like gofmt does for .go files
+func formatPath(path string, opts fmtOptions) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return formatFile(path, opts)
+	}
+
+	return filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || filepath.Ext(file) != sourceExtension {
+			return nil
+		}
+		err = formatFile(file, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return nil
+	})
+}
+
+func formatFile(path string, opts fmtOptions) error {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	formatted, err := format.Source(source)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+
+	changed := !bytes.Equal(source, formatted)
+	if *opts.list && changed {
+		fmt.Println(path)
+	}
+	if *opts.write && changed {
+		return os.WriteFile(path, formatted, 0o644)
+	}
+	if !*opts.list && !*opts.write {
+		_, err = os.Stdout.Write(formatted)
+	}
+	return err
+}
@@ -0,0 +1,394 @@
+// Package format prints Monkey programs in a canonical layout, the way
+// gofmt does for Go: four space indentation, one statement per line and
+// arrays, hashes and calls broken over several lines when they are too long
+// or hold comments. Formatting a formatted program changes nothing
+package format
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	indentation = "    "
+	width       = 80
+)
+
+// Source formats a whole program, keeping its comments, a leading #! line
+// and single blank lines between statements
+func Source(source []byte) ([]byte, error) {
+	l := lexer.New(string(source))
+	syntax := parser.New(l)
+	program := syntax.ParseProgram()
+	if len(syntax.ErrorList()) > 0 {
+		messages := []string{}
+		for _, err := range syntax.ErrorList() {
+			messages = append(messages, fmt.Sprintf("%d:%d: %s", err.Token.Line, err.Token.Column, err.Message))
+		}
+		return nil, fmt.Errorf("parser errors:\n\t%s", strings.Join(messages, "\n\t"))
+	}
+
+	p := &printer{lines: strings.Split(string(source), "\n"), comments: l.Comments()}
+	if strings.HasPrefix(p.lines[0], "#!") {
+		p.write(strings.TrimRight(p.lines[0], " \t\r"))
+	}
+	p.statements(program.Statements, token.Token{Line: len(p.lines) + 1})
+	if p.out.Len() == 0 {
+		return []byte{}, nil
+	}
+	p.write("\n")
+	return []byte(p.out.String()), nil
+}
+
+type printer struct {
+	out         strings.Builder
+	column      int // Of the next character written, counting from 0
+	indent      int
+	inComment   bool     // The current line ends with a comment
+	lines       []string // Of the source, to find blank lines and trailing comments
+	comments    []token.Token
+	nextComment int
+}
+
+func (p *printer) write(text string) {
+	p.out.WriteString(text)
+	if i := strings.LastIndexByte(text, '\n'); i >= 0 {
+		p.column = utf8.RuneCountInString(text[i+1:])
+		p.inComment = false
+	} else {
+		p.column += utf8.RuneCountInString(text)
+	}
+}
+
+// Starts a new indented line, after a blank one if the source had one before
+// line and we are not just inside brackets
+func (p *printer) newline(line int) {
+	text := strings.TrimRight(p.out.String(), " \n")
+	if text == "" {
+		return
+	}
+
+	blank := line >= 2 && line-2 < len(p.lines) && strings.TrimSpace(p.lines[line-2]) == ""
+	if blank && !strings.ContainsAny(text[len(text)-1:], "{[(") {
+		p.write("\n")
+	}
+	p.write("\n" + strings.Repeat(indentation, p.indent))
+}
+
+func newTrial(p *printer) *printer {
+	return &printer{
+		column:      p.column,
+		indent:      p.indent,
+		lines:       p.lines,
+		comments:    p.comments,
+		nextComment: p.nextComment,
+	}
+}
+
+// Renders what print writes without writing it, to measure it. Writing it
+// with accept then moves past the comments it printed
+func (p *printer) try(print func(trial *printer)) *printer {
+	trial := newTrial(p)
+	print(trial)
+	return trial
+}
+
+func (p *printer) accept(trial *printer) {
+	p.write(trial.out.String())
+	p.nextComment = trial.nextComment
+}
+
+func (p *printer) fits(trial *printer) bool {
+	firstLine, _, _ := strings.Cut(trial.out.String(), "\n")
+	return p.column+utf8.RuneCountInString(firstLine) <= width
+}
+
+// Writes the comments found before pos. Those following code on their line
+// stay at the end of the current line
+func (p *printer) flushComments(pos token.Token) {
+	for ; p.nextComment < len(p.comments); p.nextComment++ {
+		comment := p.comments[p.nextComment]
+		if !before(comment, pos) {
+			return
+		}
+
+		sourceLine := p.lines[comment.Line-1]
+		trailing := strings.TrimSpace(sourceLine[:comment.Column-1]) != ""
+		if trailing && p.out.Len() > 0 && !p.inComment {
+			p.write(" ")
+		} else {
+			p.newline(comment.Line)
+		}
+		p.write(comment.Literal)
+		p.inComment = true
+	}
+}
+
+func (p *printer) hasComments(start, end token.Token) bool {
+	for _, comment := range p.comments[p.nextComment:] {
+		if before(comment, end) && !before(comment, start) {
+			return true
+		}
+	}
+	return false
+}
+
+func before(tok, pos token.Token) bool {
+	return tok.Line < pos.Line || tok.Line == pos.Line && tok.Column < pos.Column
+}
+
+// Writes statements one per line, followed by the comments before end
+func (p *printer) statements(statements []ast.Statement, end token.Token) {
+	for i, statement := range statements {
+		start := ast.Start(statement)
+		p.flushComments(start)
+		p.newline(start.Line)
+		p.statement(statement)
+
+		var next ast.Statement
+		if i+1 < len(statements) {
+			next = statements[i+1]
+		}
+		if needsSemicolon(statement, next) {
+			p.write(";")
+		}
+	}
+	p.flushComments(end)
+}
+
+// An if expression ends with a brace, so a semicolon after it is only needed
+// when the next statement would otherwise continue it, as in `if (x) { f }(1)`
+func needsSemicolon(statement ast.Statement, next ast.Statement) bool {
+	expression, ok := statement.(*ast.ExpressionStatement)
+	if !ok {
+		return true
+	}
+	if _, ok := expression.Expression.(*ast.IfExpression); !ok {
+		return true
+	}
+	if next == nil {
+		return false
+	}
+
+	switch ast.Start(next).Type {
+	case token.LPAREN, token.LBRACKET, token.MINUS:
+		return true
+	}
+	return false
+}
+
+func (p *printer) statement(statement ast.Statement) {
+	switch statement := statement.(type) {
+	case *ast.LetStatement:
+		p.write("let " + statement.Name.Value + " = ")
+		p.expression(statement.Value, parser.LOWEST)
+	case *ast.ReturnStatement:
+		p.write("return ")
+		p.expression(statement.ReturnValue, parser.LOWEST)
+	case *ast.ExpressionStatement:
+		p.expression(statement.Expression, parser.LOWEST)
+	}
+}
+
+// Blocks of a single short statement stay on one line, like `fn(x) { x * 2 }`
+func (p *printer) block(block *ast.BlockStatement) {
+	if !p.hasComments(block.Token, block.End) {
+		switch len(block.Statements) {
+		case 0:
+			p.write("{}")
+			return
+		case 1:
+			statement := block.Statements[0]
+			flat := p.try(func(trial *printer) {
+				trial.write("{ ")
+				trial.statement(statement)
+				if _, ok := statement.(*ast.ExpressionStatement); !ok {
+					trial.write(";") // A return needs one to end
+				}
+				trial.write(" }")
+			})
+			if !strings.Contains(flat.out.String(), "\n") && p.fits(flat) {
+				p.accept(flat)
+				return
+			}
+		}
+	}
+
+	p.write("{")
+	p.indent++
+	p.statements(block.Statements, block.End)
+	p.indent--
+	p.newline(block.End.Line)
+	p.write("}")
+}
+
+// Binding strength of what an expression prints as, to parenthesize it only
+// where the parser would otherwise group it differently
+func precedenceOf(expression ast.Expression) int {
+	switch expression := expression.(type) {
+	case *ast.InfixExpression:
+		return operatorPrecedence[expression.Operator]
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	}
+	return parser.INDEX + 1
+}
+
+var operatorPrecedence = map[string]int{
+	"==": parser.EQUALS,
+	"!=": parser.EQUALS,
+	"<":  parser.LESSGREATER,
+	">":  parser.LESSGREATER,
+	"+":  parser.SUM,
+	"-":  parser.SUM,
+	"*":  parser.PRODUCT,
+	"/":  parser.PRODUCT,
+}
+
+// Writes an expression in a position that binds as tightly as precedence
+func (p *printer) expression(expression ast.Expression, precedence int) {
+	if precedenceOf(expression) < precedence {
+		p.write("(")
+		defer p.write(")")
+	}
+
+	switch expression := expression.(type) {
+	case *ast.Identifier:
+		p.write(expression.Value)
+	case *ast.IntegerLiteral:
+		p.write(expression.Token.Literal)
+	case *ast.BooleanLiteral:
+		p.write(expression.Token.Literal)
+	case *ast.StringLiteral:
+		p.write(`"` + expression.Value + `"`)
+
+	case *ast.PrefixExpression:
+		p.write(expression.Operator)
+		p.expression(expression.Right, parser.PREFIX)
+
+	case *ast.InfixExpression:
+		// Operators are left associative, so only the right side of a chain
+		// of equally strong ones needs parentheses
+		own := operatorPrecedence[expression.Operator]
+		p.expression(expression.Left, own)
+		p.write(" " + expression.Operator + " ")
+		p.expression(expression.Right, own+1)
+
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expression(expression.Condition, parser.LOWEST)
+		p.write(") ")
+		p.block(expression.Consequence)
+		if expression.Alternative != nil {
+			p.write(" else ")
+			p.block(expression.Alternative)
+		}
+
+	case *ast.FunctionLiteral:
+		names := []string{}
+		for _, parameter := range expression.Parameters {
+			names = append(names, parameter.Value)
+		}
+		p.write("fn(" + strings.Join(names, ", ") + ") ")
+		p.block(expression.Body)
+
+	case *ast.CallExpression:
+		p.expression(expression.Function, parser.CALL)
+		p.list("(", ")", expression.Arguments, nil, expression.Token, expression.End)
+
+	case *ast.IndexExpression:
+		p.expression(expression.Left, parser.INDEX)
+		p.write("[")
+		p.expression(expression.Index, parser.LOWEST)
+		p.write("]")
+
+	case *ast.MemberExpression:
+		p.expression(expression.Object, parser.INDEX)
+		p.write("." + expression.Member.Value)
+
+	case *ast.ArrayLiteral:
+		p.list("[", "]", expression.Elements, nil, expression.Token, expression.End)
+
+	case *ast.HashLiteral:
+		// Pairs are kept in the order they were written in
+		keys := []ast.Expression{}
+		for key := range expression.Pairs {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return before(ast.Start(keys[i]), ast.Start(keys[j])) })
+		values := []ast.Expression{}
+		for _, key := range keys {
+			values = append(values, expression.Pairs[key])
+		}
+		p.list("{", "}", keys, values, expression.Token, expression.End)
+	}
+}
+
+// Writes the elements of an array or call, or the pairs of a hash when values
+// are given. On one line only the last element may span several, so that
+// `map(xs, fn(x) { ... })` keeps its shape
+func (p *printer) list(open, close string, elements, values []ast.Expression, start, end token.Token) {
+	if !p.hasListComments(elements, start, end) {
+		multiline := false
+		flat := p.try(func(trial *printer) {
+			trial.write(open)
+			for i := range elements {
+				if i > 0 {
+					trial.write(", ")
+				}
+				written := trial.out.Len()
+				trial.element(elements, values, i)
+				multiline = i < len(elements)-1 && strings.Contains(trial.out.String()[written:], "\n")
+				if multiline || !p.fits(trial) {
+					return // Rendering the rest would be wasted
+				}
+			}
+			trial.write(close)
+		})
+		if !multiline && p.fits(flat) {
+			p.accept(flat)
+			return
+		}
+	}
+
+	p.write(open)
+	p.indent++
+	for i := range elements {
+		if i > 0 {
+			p.write(",")
+		}
+		elementStart := ast.Start(elements[i])
+		p.flushComments(elementStart)
+		p.newline(elementStart.Line)
+		p.element(elements, values, i)
+	}
+	p.flushComments(end)
+	p.indent--
+	p.newline(end.Line)
+	p.write(close)
+}
+
+// Comments keep a list on several lines, unless they are in the body of a
+// function passed last
+func (p *printer) hasListComments(elements []ast.Expression, start, end token.Token) bool {
+	if len(elements) > 0 {
+		if function, ok := elements[len(elements)-1].(*ast.FunctionLiteral); ok {
+			return p.hasComments(start, function.Body.Token) || p.hasComments(function.Body.End, end)
+		}
+	}
+	return p.hasComments(start, end)
+}
+
+func (p *printer) element(elements, values []ast.Expression, i int) {
+	p.expression(elements[i], parser.LOWEST)
+	if values != nil {
+		p.write(": ")
+		p.expression(values[i], parser.LOWEST)
+	}
+}
@@ -0,0 +1,121 @@
+package format
+
+import (
+	"monkey/lexer"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let   x=5", "let x = 5;\n"},
+		{"", ""},
+		{"1 + 2 * 3; (1 + 2) * 3; 1 - (2 - 3); (1 - 2) - 3; -(a + b); !-x;",
+			"1 + 2 * 3;\n(1 + 2) * 3;\n1 - (2 - 3);\n1 - 2 - 3;\n-(a + b);\n!-x;\n"},
+		{"(-a)[0]; -a[0]; (a + b)(c); f(x)[1].y;",
+			"(-a)[0];\n-a[0];\n(a + b)(c);\nf(x)[1].y;\n"},
+		{`let s = "a b";`, "let s = \"a b\";\n"},
+		{"let double = fn(x) { x * 2 }; let nothing = fn() {}; let g = fn(x) { return x; };",
+			"let double = fn(x) { x * 2 };\nlet nothing = fn() {};\nlet g = fn(x) { return x; };\n"},
+		{"let f = fn(a, b) { let c = a + b; c * 2 };",
+			"let f = fn(a, b) {\n    let c = a + b;\n    c * 2;\n};\n"},
+		{"if (x > 1) { a } else { b }\nputs(x)",
+			"if (x > 1) { a } else { b }\nputs(x);\n"},
+		{"if (x) { a }; [1, 2][0];", "if (x) { a };\n[1, 2][0];\n"},
+		{`{"b": 1, "a": [1,2]}`, "{\"b\": 1, \"a\": [1, 2]};\n"},
+		{
+			"let numbers = [100000000, 200000000, 300000000, 400000000, 500000000, 600000000, 7];",
+			"let numbers = [\n    100000000,\n    200000000,\n    300000000,\n    400000000,\n    500000000,\n    600000000,\n    7\n];\n",
+		},
+		{
+			"let h = {\"f\": fn(x) { let y = x; y }, \"g\": 1};",
+			"let h = {\n    \"f\": fn(x) {\n        let y = x;\n        y;\n    },\n    \"g\": 1\n};\n",
+		},
+		{
+			"map(list, fn(x) { let y = x * 2; y + 1 });",
+			"map(list, fn(x) {\n    let y = x * 2;\n    y + 1;\n});\n",
+		},
+		{
+			"#!/usr/bin/env monkey\nputs(1)",
+			"#!/usr/bin/env monkey\nputs(1);\n",
+		},
+		{
+			"let a = 1;\n\n\n\nlet b = 2;\nlet c = 3;",
+			"let a = 1;\n\nlet b = 2;\nlet c = 3;\n",
+		},
+		{
+			"// Header\n\nlet a = 1; // one\n// About b\nlet b = fn() {\n  // inside\n  2\n};\n// The end",
+			"// Header\n\nlet a = 1; // one\n// About b\nlet b = fn() {\n    // inside\n    2;\n};\n// The end\n",
+		},
+		{
+			"let list = [1, // one\n  2];",
+			"let list = [\n    1, // one\n    2\n];\n",
+		},
+		{
+			"let f = fn() { // why\n  1 };",
+			"let f = fn() { // why\n    1;\n};\n",
+		},
+		{
+			"let x = 10 / 2;//half\n",
+			"let x = 10 / 2; //half\n",
+		},
+	}
+
+	for _, tt := range tests {
+		formatted, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("%q: %s", tt.input, err)
+			continue
+		}
+		if string(formatted) != tt.expected {
+			t.Errorf("%q formatted wrong.\nwant=\n%s\ngot=\n%s", tt.input, tt.expected, formatted)
+			continue
+		}
+
+		again, err := Source(formatted)
+		if err != nil || string(again) != string(formatted) {
+			t.Errorf("%q: formatting is not idempotent, got %q (%v)", tt.input, again, err)
+		}
+	}
+}
+
+func TestSourceKeepsMeaning(t *testing.T) {
+	inputs := []string{
+		"let a = (1 + 2) * (3 - (4 - 5)) / -(6 * 7) == !(true != false);",
+		"let f = fn(n) { if (n < 2) { return n; }; f(n - 1) + f(n - 2) }; puts(f(10));",
+		"if (a) { b } else { c }\n-1",
+		"let g = fn() { fn(x) { x } }; g()(1); [fn() { 1 }][0]();",
+		"m.f(1)[2].g; -a[0] * (b.c)(d);",
+	}
+
+	for _, input := range inputs {
+		formatted, err := Source([]byte(input))
+		if err != nil {
+			t.Fatalf("%q: %s", input, err)
+		}
+		if parse(t, input) != parse(t, string(formatted)) {
+			t.Errorf("%q: formatting changed the program.\nwant=%s\ngot =%s\nformatted=\n%s",
+				input, parse(t, input), parse(t, string(formatted)), formatted)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) string {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("%q: %v", input, p.Errors())
+	}
+	return program.String()
+}
+
+func TestSourceErrors(t *testing.T) {
+	_, err := Source([]byte("let x = 1;\nlet = 2;"))
+	if err == nil || !strings.Contains(err.Error(), "2:5: expected next token to be IDENT") {
+		t.Errorf("wrong error %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+// Package jsonrpc reads and writes JSON messages framed by Content-Length
+// headers, as the language server, debug adapter and REPL protocols send them
+package jsonrpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MaxMessageSize is the longest body ReadMessage accepts, so a bad header
+// can't make it allocate without bound
+const MaxMessageSize = 64 << 20
+
+// ReadMessage reads one message, framed by headers like HTTP's of which only
+// Content-Length matters. Header lines must fit in reader's buffer
+func ReadMessage(reader *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		slice, err := reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			return nil, fmt.Errorf("header line over %d bytes", reader.Size())
+		}
+		if err != nil {
+			return nil, err
+		}
+		line := strings.TrimRight(string(slice), "\r\n")
+		if line == "" {
+			break
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || length < 0 {
+				return nil, fmt.Errorf("invalid Content-Length %q", value)
+			}
+		}
+	}
+
+	if length < 0 {
+		return nil, fmt.Errorf("message without Content-Length")
+	}
+	if length > MaxMessageSize {
+		return nil, fmt.Errorf("message of %d bytes is over the %d byte limit", length, MaxMessageSize)
+	}
+	body := make([]byte, length)
+	_, err := io.ReadFull(reader, body)
+	return body, err
+}
+
+// WriteMessage encodes message as JSON and writes it with its header
+func WriteMessage(writer io.Writer, message interface{}) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(writer, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
@@ -0,0 +1,60 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{"Content-Length: 2\r\n\r\n{}", "{}", ""},
+		{"content-length:2\nContent-Type: application/json\n\n[]", "[]", ""},
+		{"Content-Type: application/json\r\n\r\n{}", "", "message without Content-Length"},
+		{"Content-Length: -1\r\n\r\n", "", `invalid Content-Length " -1"`},
+		{"Content-Length: 5\r\n\r\n{}", "", "unexpected EOF"},
+		{"Content-Length: 67108865\r\n\r\n{}", "", "message of 67108865 bytes is over the 67108864 byte limit"},
+		{"Content-Length: 99999999999999999999\r\n\r\n{}", "", `invalid Content-Length " 99999999999999999999"`},
+		{"X-Padding: " + strings.Repeat("a", 5000) + "\r\nContent-Length: 2\r\n\r\n{}", "", "header line over 4096 bytes"},
+	}
+
+	for _, tt := range tests {
+		body, err := ReadMessage(bufio.NewReader(strings.NewReader(tt.input)))
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.err {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.err, got)
+		} else if err == nil && string(body) != tt.expected {
+			t.Errorf("wrong body for %q. want=%q, got=%q", tt.input, tt.expected, body)
+		}
+	}
+}
+
+func TestWriteMessage(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteMessage(&out, map[string]int{"id": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteMessage(&out, []string{"é"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := bufio.NewReader(&out)
+	for _, expected := range []string{`{"id":1}`, `["é"]`} {
+		body, err := ReadMessage(reader)
+		if err != nil || string(body) != expected {
+			t.Errorf("wrong message. want=%q, got=%q (%v)", expected, body, err)
+		}
+	}
+	if _, err := ReadMessage(reader); err != io.EOF {
+		t.Errorf("wrong error at the end. want=%v, got=%v", io.EOF, err)
+	}
+}
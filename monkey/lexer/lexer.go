@@ -2,6 +2,7 @@ package lexer
 
 import (
 	"monkey/token"
+	"strings"
 )
 
 type Lexer struct {
@@ -9,15 +10,36 @@ type Lexer struct {
 	position     int  // current position in input (points to current char)
 	readPosition int  // current reading position in input (after current char)
 	ch           byte // current char under examination
+	line         int  // line of the current char, starting at 1
+	column       int  // column of the current char in bytes, starting at 1
+	comments     []token.Token
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
+	l.skipShebang()
 	return l
 }
 
+// Allows scripts to start with e.g. `#!/usr/bin/env monkey`
+func (lexer *Lexer) skipShebang() {
+	if lexer.ch != '#' || lexer.peekChar() != '!' {
+		return
+	}
+
+	for lexer.ch != '\n' && lexer.ch != 0 {
+		lexer.readChar()
+	}
+}
+
 func (lexer *Lexer) readChar() {
+	if lexer.ch == '\n' {
+		lexer.line += 1
+		lexer.column = 0
+	}
+	lexer.column += 1
+
 	if lexer.readPosition >= len(lexer.input) {
 		lexer.ch = 0
 	} else {
@@ -28,10 +50,18 @@ func (lexer *Lexer) readChar() {
 }
 
 func (lexer *Lexer) NextToken() token.Token {
-	var tok token.Token
-
 	lexer.skipWhitespace()
 
+	line, column := lexer.line, lexer.column
+	tok := lexer.readToken()
+	tok.Line = line
+	tok.Column = column
+	return tok
+}
+
+func (lexer *Lexer) readToken() token.Token {
+	var tok token.Token
+
 	switch lexer.ch {
 	case '=':
 		if lexer.peekChar() == '=' {
@@ -60,6 +90,8 @@ func (lexer *Lexer) NextToken() token.Token {
 		tok = newToken(token.RBRACKET, lexer.ch)
 	case ',':
 		tok = newToken(token.COMMA, lexer.ch)
+	case '.':
+		tok = newToken(token.DOT, lexer.ch)
 	case '+':
 		tok = newToken(token.PLUS, lexer.ch)
 	case '-':
@@ -123,14 +155,37 @@ func (lexer *Lexer) readNumber() string {
 	return lexer.input[position:lexer.position]
 }
 
+// Comments count as whitespace, they run from // to the end of the line
 func (lexer *Lexer) skipWhitespace() {
-	for lexer.ch == ' ' || lexer.ch == '\t' || lexer.ch == '\n' || lexer.ch == '\r' {
+	for {
+		switch {
+		case lexer.ch == ' ' || lexer.ch == '\t' || lexer.ch == '\n' || lexer.ch == '\r':
+			lexer.readChar()
+		case lexer.ch == '/' && lexer.peekChar() == '/':
+			lexer.readComment()
+		default:
+			return
+		}
+	}
+}
+
+func (lexer *Lexer) readComment() {
+	tok := token.Token{Type: token.COMMENT, Line: lexer.line, Column: lexer.column}
+	position := lexer.position
+	for lexer.ch != '\n' && lexer.ch != 0 {
 		lexer.readChar()
 	}
+	tok.Literal = strings.TrimRight(lexer.input[position:lexer.position], " \t\r")
+	lexer.comments = append(lexer.comments, tok)
+}
+
+// Comments returns the comments read so far, in order, with their slashes
+func (lexer *Lexer) Comments() []token.Token {
+	return lexer.comments
 }
 
 func (lexer *Lexer) peekChar() byte {
-	if lexer.readPosition > len(lexer.input) {
+	if lexer.readPosition >= len(lexer.input) {
 		return 0
 	}
 	return lexer.input[lexer.readPosition]
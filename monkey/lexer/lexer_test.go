@@ -204,3 +204,104 @@ func TestNextTokenColonForHash(t *testing.T) {
 	verifyNextToken(t, input, tests)
 
 }
+
+func TestNextTokenDot(t *testing.T) {
+	input := `req.header("X")`
+	tests := []NextTokenTest{
+		{token.IDENT, "req"},
+		{token.DOT, "."},
+		{token.IDENT, "header"},
+		{token.LPAREN, "("},
+		{token.STRING, "X"},
+		{token.RPAREN, ")"},
+		{token.EOF, ""},
+	}
+	verifyNextToken(t, input, tests)
+}
+
+func TestNextTokenShebang(t *testing.T) {
+	input := "#!/usr/bin/env monkey\nlet x = 1;"
+	tests := []NextTokenTest{
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+	verifyNextToken(t, input, tests)
+
+	verifyNextToken(t, "#!", []NextTokenTest{{token.EOF, ""}})
+	verifyNextToken(t, "=", []NextTokenTest{{token.ASSIGN, "="}, {token.EOF, ""}})
+}
+
+func TestNextTokenPositions(t *testing.T) {
+	input := "let x = 1;\n\tputs(\"a\nb\", x)\n"
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"1", 1, 9},
+		{";", 1, 10},
+		{"puts", 2, 2},
+		{"(", 2, 6},
+		{"a\nb", 2, 7},
+		{",", 3, 3},
+		{"x", 3, 5},
+		{")", 3, 6},
+		{"", 4, 1},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - %q position wrong. expected=%d:%d, got=%d:%d",
+				i, tok.Literal, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestNextTokenComments(t *testing.T) {
+	input := "// header\nlet x = 10 / 2; // half  \n//\nx"
+
+	verifyNextToken(t, input, []NextTokenTest{
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "10"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.EOF, ""},
+	})
+
+	l := New(input)
+	for l.NextToken().Type != token.EOF {
+	}
+
+	expected := []token.Token{
+		{Type: token.COMMENT, Literal: "// header", Line: 1, Column: 1},
+		{Type: token.COMMENT, Literal: "// half", Line: 2, Column: 17},
+		{Type: token.COMMENT, Literal: "//", Line: 3, Column: 1},
+	}
+	comments := l.Comments()
+	if len(comments) != len(expected) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d", len(expected), len(comments))
+	}
+	for i, comment := range comments {
+		if comment != expected[i] {
+			t.Errorf("comments[%d] wrong. expected=%+v, got=%+v", i, expected[i], comment)
+		}
+	}
+}
@@ -0,0 +1,420 @@
+// Package lineedit reads lines from a terminal with cursor movement, history,
+// reverse search and tab completion. It talks to the terminal through escape
+// sequences and termios ioctls, without cgo
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// ErrInterrupted is returned by ReadLine when Ctrl-C is pressed
+var ErrInterrupted = errors.New("interrupted")
+
+// Completer returns the candidates for the word before the cursor, all of which
+// start with it
+type Completer func(word string) []string
+
+type Editor struct {
+	History  *History  // Lines read are added to it, nil disables history
+	Complete Completer // Nil disables completion
+
+	in  *bufio.Reader
+	out io.Writer
+	fd  int
+}
+
+// New returns an editor reading keys from in and drawing on out. While reading
+// a line it puts the terminal with file descriptor fd in raw mode, or leaves
+// the mode alone if fd is -1. Reading from in between lines, e.g. for a
+// script's gets, sees what was typed after the line
+func New(in *bufio.Reader, out io.Writer, fd int) *Editor {
+	return &Editor{in: in, out: out, fd: fd}
+}
+
+// Special keys read from escape sequences, which can't be mistaken for runes
+const (
+	keyUnknown rune = -1 - iota
+	keyUp
+	keyDown
+	keyRight
+	keyLeft
+	keyHome
+	keyEnd
+	keyDelete
+)
+
+func ctrl(key rune) rune {
+	return key & 0x1f
+}
+
+const (
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// The line being edited
+type lineState struct {
+	prompt string
+	line   []rune
+	cursor int
+
+	history int    // Index of the history entry shown, len(entries) for the new line
+	edited  []rune // The new line, kept while browsing history
+}
+
+// ReadLine shows prompt and returns the line typed, without its line ending.
+// It returns io.EOF if Ctrl-D is pressed on an empty line or the input ends,
+// and ErrInterrupted if Ctrl-C is pressed
+func (editor *Editor) ReadLine(prompt string) (string, error) {
+	if editor.fd >= 0 {
+		restore, err := makeRaw(editor.fd)
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+	}
+
+	line, err := editor.edit(prompt)
+	switch {
+	case err == ErrInterrupted:
+		io.WriteString(editor.out, "^C\n")
+	case err == nil || err == io.EOF:
+		io.WriteString(editor.out, "\n")
+	}
+	// Failing to save history is no reason to stop reading lines
+	if err == nil && editor.History != nil {
+		editor.History.Add(line)
+	}
+	return line, err
+}
+
+func (editor *Editor) edit(prompt string) (string, error) {
+	state := &lineState{prompt: prompt, history: len(editor.entries())}
+	editor.refresh(state.prompt, state.line, state.cursor)
+
+	var pending rune // A key ending a search, still to be handled
+	for {
+		key := pending
+		pending = 0
+		if key == 0 {
+			var err error
+			key, err = editor.readKey()
+			if err != nil {
+				return "", err
+			}
+		}
+
+		switch key {
+		case ctrl('M'), ctrl('J'):
+			editor.skipNewline(key)
+			return string(state.line), nil
+		case ctrl('C'):
+			return "", ErrInterrupted
+		case ctrl('D'):
+			if len(state.line) == 0 {
+				return "", io.EOF
+			}
+			state.deleteAt(state.cursor)
+		case keyDelete:
+			state.deleteAt(state.cursor)
+		case keyBackspace, ctrl('H'):
+			if state.cursor > 0 {
+				state.cursor--
+				state.deleteAt(state.cursor)
+			}
+		case ctrl('A'), keyHome:
+			state.cursor = 0
+		case ctrl('E'), keyEnd:
+			state.cursor = len(state.line)
+		case ctrl('B'), keyLeft:
+			state.cursor = max(state.cursor-1, 0)
+		case ctrl('F'), keyRight:
+			state.cursor = min(state.cursor+1, len(state.line))
+		case ctrl('K'):
+			state.line = state.line[:state.cursor]
+		case ctrl('U'):
+			state.line = append([]rune{}, state.line[state.cursor:]...)
+			state.cursor = 0
+		case ctrl('W'):
+			start := state.cursor
+			for start > 0 && unicode.IsSpace(state.line[start-1]) {
+				start--
+			}
+			start = wordStart(state.line, start, unicode.IsSpace)
+			state.line = append(state.line[:start], state.line[state.cursor:]...)
+			state.cursor = start
+		case ctrl('P'), keyUp:
+			editor.browse(state, -1)
+		case ctrl('N'), keyDown:
+			editor.browse(state, 1)
+		case ctrl('R'):
+			var done bool
+			var err error
+			done, pending, err = editor.search(state)
+			if err != nil {
+				return "", err
+			}
+			if done {
+				return string(state.line), nil
+			}
+		case ctrl('I'):
+			editor.complete(state)
+		case ctrl('L'):
+			io.WriteString(editor.out, "\x1b[H\x1b[2J")
+		default:
+			if key >= ' ' {
+				state.insert(key)
+			}
+		}
+		editor.refresh(state.prompt, state.line, state.cursor)
+	}
+}
+
+func (state *lineState) insert(key rune) {
+	state.line = append(state.line, 0)
+	copy(state.line[state.cursor+1:], state.line[state.cursor:])
+	state.line[state.cursor] = key
+	state.cursor++
+}
+
+func (state *lineState) deleteAt(i int) {
+	if i < len(state.line) {
+		state.line = append(state.line[:i], state.line[i+1:]...)
+	}
+}
+
+// Terminals send "\r" for Enter, but pasted text may have "\r\n" line endings
+func (editor *Editor) skipNewline(key rune) {
+	if key != ctrl('M') || editor.in.Buffered() == 0 {
+		return
+	}
+	if next, err := editor.in.Peek(1); err == nil && next[0] == '\n' {
+		editor.in.ReadByte()
+	}
+}
+
+// Redraws the line in place and puts the cursor back. Long lines wrap, which
+// the terminal handles as long as the cursor stays on the last row
+func (editor *Editor) refresh(prompt string, line []rune, cursor int) {
+	var out strings.Builder
+	out.WriteString("\r")
+	out.WriteString(prompt)
+	out.WriteString(string(line))
+	out.WriteString("\x1b[K\r")
+	if column := len([]rune(prompt)) + cursor; column > 0 {
+		fmt.Fprintf(&out, "\x1b[%dC", column)
+	}
+	io.WriteString(editor.out, out.String())
+}
+
+func (editor *Editor) readKey() (rune, error) {
+	key, _, err := editor.in.ReadRune()
+	if err != nil || key != keyEscape {
+		return key, err
+	}
+
+	next, _, err := editor.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	switch next {
+	case '[':
+		return editor.readCSI()
+	case 'O':
+		final, _, err := editor.in.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		return finalKey(final, ""), nil
+	}
+	return keyUnknown, nil
+}
+
+// Reads the rest of a control sequence like "\x1b[3~", its parameters up to
+// the final byte
+func (editor *Editor) readCSI() (rune, error) {
+	var parameters strings.Builder
+	for {
+		char, _, err := editor.in.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		if char >= 0x40 && char <= 0x7e {
+			return finalKey(char, parameters.String()), nil
+		}
+		parameters.WriteRune(char)
+	}
+}
+
+func finalKey(final rune, parameters string) rune {
+	switch final {
+	case 'A':
+		return keyUp
+	case 'B':
+		return keyDown
+	case 'C':
+		return keyRight
+	case 'D':
+		return keyLeft
+	case 'H':
+		return keyHome
+	case 'F':
+		return keyEnd
+	case '~':
+		switch parameters {
+		case "1", "7":
+			return keyHome
+		case "4", "8":
+			return keyEnd
+		case "3":
+			return keyDelete
+		}
+	}
+	return keyUnknown
+}
+
+func (editor *Editor) entries() []string {
+	if editor.History == nil {
+		return nil
+	}
+	return editor.History.Entries()
+}
+
+// Moves through history by step, keeping what was typed on the new line
+func (editor *Editor) browse(state *lineState, step int) {
+	entries := editor.entries()
+	target := state.history + step
+	if target < 0 || target > len(entries) {
+		return
+	}
+
+	if state.history == len(entries) {
+		state.edited = append([]rune{}, state.line...)
+	}
+	state.history = target
+	if target == len(entries) {
+		state.line = state.edited
+	} else {
+		state.line = []rune(entries[target])
+	}
+	state.cursor = len(state.line)
+}
+
+// Searches history backwards for lines containing what is typed, as Ctrl-R
+// does in shells. Enter runs the match, Ctrl-R finds the next older one, Ctrl-G
+// or Ctrl-C give up and any other key edits the match, returned as pending
+func (editor *Editor) search(state *lineState) (done bool, pending rune, err error) {
+	entries := editor.entries()
+	original, originalCursor := state.line, state.cursor
+	query := []rune{}
+	match := len(entries) // Nothing found yet
+	position := 0
+	failed := false
+
+	// Looks for the query from entry from back, keeping the last match if
+	// there is none
+	find := func(from int) {
+		for i := from; i >= 0; i-- {
+			if at := strings.Index(entries[i], string(query)); at >= 0 {
+				match = i
+				position = len([]rune(entries[i][:at]))
+				failed = false
+				return
+			}
+		}
+		failed = true
+	}
+
+	for {
+		prompt := fmt.Sprintf("(reverse-i-search)`%s': ", string(query))
+		if failed {
+			prompt = "(failed " + prompt[1:]
+		}
+		shown := []rune{}
+		if match < len(entries) {
+			shown = []rune(entries[match])
+		}
+		editor.refresh(prompt, shown, position)
+
+		key, err := editor.readKey()
+		if err != nil {
+			return false, 0, err
+		}
+
+		switch {
+		case key == ctrl('R'):
+			find(match - 1)
+		case key == keyBackspace || key == ctrl('H'):
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				match, position = len(entries), 0
+				find(len(entries) - 1)
+			}
+		case key == ctrl('G') || key == ctrl('C'):
+			state.line, state.cursor = original, originalCursor
+			return false, 0, nil
+		case key >= ' ':
+			query = append(query, key)
+			find(min(match, len(entries)-1))
+		default:
+			if match < len(entries) {
+				state.line = []rune(entries[match])
+				state.cursor = position
+				state.history = match
+			}
+			if key == ctrl('M') || key == ctrl('J') {
+				editor.skipNewline(key)
+				return true, 0, nil
+			}
+			return false, key, nil
+		}
+	}
+}
+
+// Completes the word before the cursor as far as its candidates agree, and
+// lists them if that adds nothing
+func (editor *Editor) complete(state *lineState) {
+	if editor.Complete == nil {
+		return
+	}
+	start := wordStart(state.line, state.cursor, func(char rune) bool {
+		return !(unicode.IsLetter(char) || unicode.IsDigit(char) || char == '_')
+	})
+	word := string(state.line[start:state.cursor])
+
+	candidates := editor.Complete(word)
+	if len(candidates) == 0 {
+		io.WriteString(editor.out, "\a")
+		return
+	}
+
+	common := candidates[0]
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(candidate, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(common) > len(word) {
+		for _, char := range common[len(word):] {
+			state.insert(char)
+		}
+		return
+	}
+
+	if len(candidates) > 1 {
+		fmt.Fprintf(editor.out, "\n%s\n", strings.Join(candidates, "  "))
+	}
+}
+
+// Returns where the run of characters not matching separator before i starts
+func wordStart(line []rune, i int, separator func(rune) bool) int {
+	for i > 0 && !separator(line[i-1]) {
+		i--
+	}
+	return i
+}
@@ -0,0 +1,191 @@
+package lineedit
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	up        = "\x1b[A"
+	down      = "\x1b[B"
+	left      = "\x1b[D"
+	home      = "\x1b[H"
+	end       = "\x1bOF"
+	del       = "\x1b[3~"
+	backspace = "\x7f"
+)
+
+// Types keys into an editor with the given history, returning the lines read
+// until the keys run out
+func typeKeys(t *testing.T, keys string, history []string, complete Completer) []string {
+	t.Helper()
+
+	var out strings.Builder
+	editor := New(bufio.NewReader(strings.NewReader(keys)), &out, -1)
+	editor.History = NewHistory(100)
+	for _, entry := range history {
+		editor.History.Add(entry)
+	}
+	editor.Complete = complete
+
+	lines := []string{}
+	for {
+		line, err := editor.ReadLine("> ")
+		if err == io.EOF {
+			return lines
+		}
+		if err == ErrInterrupted {
+			lines = append(lines, "^C")
+			continue
+		}
+		if err != nil {
+			t.Fatalf("ReadLine error: %s", err)
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestEditing(t *testing.T) {
+	tests := []struct {
+		keys     string
+		expected []string
+	}{
+		{"let x = 1;\r", []string{"let x = 1;"}},
+		{"one\rtwo\r\nthree\n", []string{"one", "two", "three"}},
+		{"ac" + left + "b\r", []string{"abc"}},
+		{"bc" + home + "a" + end + "d\r", []string{"abcd"}},
+		{"bc\x01a\x05d\r", []string{"abcd"}},
+		{"abcd" + backspace + left + left + del + "\r", []string{"ac"}},
+		{"abc\x02\x02\x0b\r", []string{"a"}},
+		{"abc\x02\x15\r", []string{"c"}},
+		{"let x = 1\x17\x17\r", []string{"let x "}},
+		{"ab\x04\x02\x04\r", []string{"a"}},
+		{"abc\x03def\r", []string{"^C", "def"}},
+		{"\x04ignored\r", []string{}},
+		{"a\x1bxb\r", []string{"ab"}},
+	}
+
+	for _, tt := range tests {
+		lines := typeKeys(t, tt.keys, nil, nil)
+		if !reflect.DeepEqual(lines, tt.expected) {
+			t.Errorf("wrong lines for %q. want=%q, got=%q", tt.keys, tt.expected, lines)
+		}
+	}
+}
+
+func TestHistoryBrowsing(t *testing.T) {
+	history := []string{"first", "second"}
+	tests := []struct {
+		keys     string
+		expected []string
+	}{
+		{up + "\r", []string{"second"}},
+		{up + up + up + "\r", []string{"first"}},
+		{"new" + up + down + "!\r", []string{"new!"}},
+		{up + "!\r" + up + "\r", []string{"second!", "second!"}},
+		{"\x10\x10\x0e\r", []string{"second"}},
+	}
+
+	for _, tt := range tests {
+		lines := typeKeys(t, tt.keys, history, nil)
+		if !reflect.DeepEqual(lines, tt.expected) {
+			t.Errorf("wrong lines for %q. want=%q, got=%q", tt.keys, tt.expected, lines)
+		}
+	}
+}
+
+func TestReverseSearch(t *testing.T) {
+	history := []string{"let apple = 1;", "let banana = 2;", "apple + banana"}
+	tests := []struct {
+		keys     string
+		expected []string
+	}{
+		{"\x12apple\r", []string{"apple + banana"}},
+		{"\x12apple\x12\r", []string{"let apple = 1;"}},
+		{"\x12ban" + backspace + backspace + "pp\r", []string{"apple + banana"}},
+		{"\x12banana =\x05;\r", []string{"let banana = 2;;"}},
+		{"typed\x12apple\x07!\r", []string{"typed!"}},
+		{"\x12cherry\r", []string{""}},
+	}
+
+	for _, tt := range tests {
+		lines := typeKeys(t, tt.keys, history, nil)
+		if !reflect.DeepEqual(lines, tt.expected) {
+			t.Errorf("wrong lines for %q. want=%q, got=%q", tt.keys, tt.expected, lines)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	words := []string{"len", "let", "last", "lengthy"}
+	complete := func(word string) []string {
+		candidates := []string{}
+		for _, candidate := range words {
+			if strings.HasPrefix(candidate, word) {
+				candidates = append(candidates, candidate)
+			}
+		}
+		return candidates
+	}
+
+	tests := []struct {
+		keys     string
+		expected []string
+	}{
+		{"la\t\r", []string{"last"}},
+		{"puts(leng\t)\r", []string{"puts(lengthy)"}},
+		{"le\t\r", []string{"le"}},
+		{"len\t\r", []string{"len"}},
+		{"x\t\r", []string{"x"}},
+		{"(la) + 1" + home + "\x06la\t\r", []string{"(lastla) + 1"}},
+	}
+
+	for _, tt := range tests {
+		lines := typeKeys(t, tt.keys, nil, complete)
+		if !reflect.DeepEqual(lines, tt.expected) {
+			t.Errorf("wrong lines for %q. want=%q, got=%q", tt.keys, tt.expected, lines)
+		}
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	if err := os.WriteFile(path, []byte("one\n\ntwo\nthree\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := LoadHistory(path, 2)
+	if err != nil {
+		t.Fatalf("LoadHistory error: %s", err)
+	}
+	if !reflect.DeepEqual(history.Entries(), []string{"two", "three"}) {
+		t.Errorf("wrong entries. got=%q", history.Entries())
+	}
+
+	for _, line := range []string{"four", "four", "  ", "five"} {
+		if err := history.Add(line); err != nil {
+			t.Fatalf("Add error: %s", err)
+		}
+	}
+	if !reflect.DeepEqual(history.Entries(), []string{"four", "five"}) {
+		t.Errorf("wrong entries. got=%q", history.Entries())
+	}
+
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(saved) != "two\nthree\nfour\nfive\n" {
+		t.Errorf("wrong file. got=%q", saved)
+	}
+
+	missing, err := LoadHistory(filepath.Join(t.TempDir(), "missing"), 10)
+	if err != nil || len(missing.Entries()) != 0 {
+		t.Errorf("missing file not treated as empty history. got=%v, %v", missing, err)
+	}
+}
@@ -0,0 +1,86 @@
+package lineedit
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// History holds the lines entered, oldest first, and appends each new one to
+// its file as it is added so it survives crashes
+type History struct {
+	entries []string
+	path    string
+	max     int
+}
+
+// NewHistory returns a history of at most max entries kept in memory only
+func NewHistory(max int) *History {
+	return &History{max: max}
+}
+
+// LoadHistory reads the history kept in the file at path, which need not exist
+// yet. The file is trimmed to the newest max entries
+func LoadHistory(path string, max int) (*History, error) {
+	history := &History{path: path, max: max}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return history, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			history.entries = append(history.entries, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(history.entries) > max {
+		history.entries = history.entries[len(history.entries)-max:]
+		err := os.WriteFile(path, []byte(strings.Join(history.entries, "\n")+"\n"), 0o600)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return history, nil
+}
+
+func (history *History) Entries() []string {
+	return history.entries
+}
+
+// Add records a line unless it is blank or repeats the last one
+func (history *History) Add(line string) error {
+	if strings.TrimSpace(line) == "" {
+		return nil
+	}
+	if len(history.entries) > 0 && history.entries[len(history.entries)-1] == line {
+		return nil
+	}
+
+	history.entries = append(history.entries, line)
+	if len(history.entries) > history.max {
+		history.entries = history.entries[1:]
+	}
+
+	if history.path == "" {
+		return nil
+	}
+	file, err := os.OpenFile(history.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString(line + "\n")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,8 @@
+package lineedit
+
+import "syscall"
+
+const (
+	getTermios = syscall.TCGETS
+	setTermios = syscall.TCSETS
+)
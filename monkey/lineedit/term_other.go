@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+
+package lineedit
+
+import "errors"
+
+// IsTerminal reports whether fd is a terminal the editor can put in raw mode,
+// which it can't on this platform
+func IsTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (func() error, error) {
+	return nil, errors.New("line editing is not supported on this platform")
+}
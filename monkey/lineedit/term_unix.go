@@ -0,0 +1,54 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package lineedit
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+func getState(fd int) (*syscall.Termios, error) {
+	state := &syscall.Termios{}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), getTermios, uintptr(unsafe.Pointer(state)))
+	if errno != 0 {
+		return nil, errno
+	}
+	return state, nil
+}
+
+func setState(fd int, state *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), setTermios, uintptr(unsafe.Pointer(state)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// IsTerminal reports whether fd is a terminal the editor can put in raw mode
+func IsTerminal(fd int) bool {
+	_, err := getState(fd)
+	return err == nil
+}
+
+// Puts the terminal in raw mode, where every key press is read as it comes
+// without being echoed and Ctrl-C is read rather than interrupting, returning
+// how to put it back. Output processing stays on so "\n" still starts a line
+func makeRaw(fd int) (func() error, error) {
+	old, err := getState(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := *old
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := setState(fd, &raw); err != nil {
+		return nil, err
+	}
+
+	return func() error { return setState(fd, old) }, nil
+}
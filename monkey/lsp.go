@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"monkey/lsp"
+	"os"
+)
+
+// Gives editors diagnostics, navigation and completion, see package lsp
+func lspCommand(args []string) int {
+	flags := newFlagSet("monkey lsp")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	err := lsp.NewServer(os.Stdin, os.Stdout).Serve()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,299 @@
+package lsp
+
+import (
+	"errors"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/token"
+	"reflect"
+	"sort"
+)
+
+// What the server knows about a document, with positions as in tokens: lines
+// and byte columns counting from 1
+type analysis struct {
+	problems   []problem
+	references []*reference // Every resolved identifier, definitions included
+	scopes     []*scope     // The program first, then function bodies
+}
+
+type problem struct {
+	message string
+	token   token.Token
+}
+
+type definition struct {
+	name  string
+	kind  string      // global, local, parameter or builtin
+	token token.Token // Zero for builtins
+}
+
+type reference struct {
+	token       token.Token
+	definition  *definition
+	declaration bool
+}
+
+// The program or a function body, for completion
+type scope struct {
+	start, end  token.Token
+	parent      *scope
+	function    *definition // The name a function refers to itself by
+	definitions []*definition
+}
+
+func analyze(source string) *analysis {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+
+	result := &analysis{}
+	for _, err := range p.ErrorList() {
+		result.problems = append(result.problems, problem{err.Message, err.Token})
+	}
+
+	// A partial tree is still worth resolving, compiling it is not
+	if len(p.Errors()) == 0 {
+		err := compiler.New().Compile(program)
+		var compileErr *compiler.Error
+		if errors.As(err, &compileErr) {
+			result.problems = append(result.problems, problem{compileErr.Message, compileErr.Token})
+		}
+	}
+
+	newResolver(result).resolve(program)
+	sort.Slice(result.references, func(i, j int) bool {
+		a, b := result.references[i].token, result.references[j].token
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return result
+}
+
+// Finds what identifiers refer to by building symbol tables the way the
+// compiler does and mapping the symbols they resolve to back to definitions
+type resolver struct {
+	analysis  *analysis
+	table     *compiler.SymbolTable
+	scope     *scope
+	symbols   map[symbolKey]*definition
+	functions map[*compiler.SymbolTable]*definition // Tables of named functions
+	names     map[*ast.FunctionLiteral]*definition  // Functions bound by let
+	builtins  map[string]*definition
+}
+
+type symbolKey struct {
+	table *compiler.SymbolTable
+	index int
+}
+
+func newResolver(analysis *analysis) *resolver {
+	resolver := &resolver{
+		analysis:  analysis,
+		table:     compiler.NewSymbolTable(),
+		scope:     &scope{end: token.Token{Line: 1 << 30}},
+		symbols:   map[symbolKey]*definition{},
+		functions: map[*compiler.SymbolTable]*definition{},
+		names:     map[*ast.FunctionLiteral]*definition{},
+		builtins:  map[string]*definition{},
+	}
+	for i, builtin := range object.Builtins {
+		resolver.table.DefineBuiltin(i, builtin.Name)
+		resolver.builtins[builtin.Name] = &definition{name: builtin.Name, kind: "builtin"}
+	}
+	analysis.scopes = append(analysis.scopes, resolver.scope)
+	return resolver
+}
+
+func (resolver *resolver) resolve(node ast.Node) {
+	// Trees with syntax errors have holes, some of them typed nil pointers
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, statement := range node.Statements {
+			resolver.resolve(statement)
+		}
+
+	case *ast.BlockStatement:
+		for _, statement := range node.Statements {
+			resolver.resolve(statement)
+		}
+
+	case *ast.LetStatement:
+		kind := "local"
+		if resolver.table.Outer == nil {
+			kind = "global"
+		}
+		def := &definition{name: node.Name.Value, kind: kind, token: node.Name.Token}
+
+		// Like the compiler, the value is resolved before the name is defined
+		if fn, ok := node.Value.(*ast.FunctionLiteral); ok {
+			resolver.names[fn] = def
+		}
+		resolver.resolve(node.Value)
+		resolver.define(def)
+
+	case *ast.ReturnStatement:
+		resolver.resolve(node.ReturnValue)
+
+	case *ast.ExpressionStatement:
+		resolver.resolve(node.Expression)
+
+	case *ast.PrefixExpression:
+		resolver.resolve(node.Right)
+
+	case *ast.InfixExpression:
+		resolver.resolve(node.Left)
+		resolver.resolve(node.Right)
+
+	case *ast.IfExpression:
+		resolver.resolve(node.Condition)
+		resolver.resolve(node.Consequence)
+		resolver.resolve(node.Alternative)
+
+	case *ast.IndexExpression:
+		resolver.resolve(node.Left)
+		resolver.resolve(node.Index)
+
+	case *ast.MemberExpression:
+		resolver.resolve(node.Object) // Members are names of module bindings, not variables
+
+	case *ast.CallExpression:
+		resolver.resolve(node.Function)
+		for _, argument := range node.Arguments {
+			resolver.resolve(argument)
+		}
+
+	case *ast.ArrayLiteral:
+		for _, element := range node.Elements {
+			resolver.resolve(element)
+		}
+
+	case *ast.HashLiteral:
+		for key, value := range node.Pairs {
+			resolver.resolve(key)
+			resolver.resolve(value)
+		}
+
+	case *ast.FunctionLiteral:
+		resolver.resolveFunction(node)
+
+	case *ast.Identifier:
+		symbol, ok := resolver.table.Resolve(node.Value)
+		if !ok {
+			return // Reported by the compiler
+		}
+		if def := resolver.definitionOf(symbol, resolver.table); def != nil {
+			resolver.analysis.references = append(resolver.analysis.references, &reference{token: node.Token, definition: def})
+		}
+	}
+}
+
+func (resolver *resolver) resolveFunction(node *ast.FunctionLiteral) {
+	outerTable, outerScope := resolver.table, resolver.scope
+	resolver.table = compiler.NewEnclosedSymbolTable(outerTable)
+	resolver.scope = &scope{start: node.Token, end: node.Body.End, parent: outerScope}
+	resolver.analysis.scopes = append(resolver.analysis.scopes, resolver.scope)
+
+	if node.Name != "" {
+		resolver.table.DefineFunctionName(node.Name)
+		resolver.functions[resolver.table] = resolver.names[node]
+		resolver.scope.function = resolver.names[node]
+	}
+	for _, parameter := range node.Parameters {
+		resolver.define(&definition{name: parameter.Value, kind: "parameter", token: parameter.Token})
+	}
+	resolver.resolve(node.Body)
+
+	resolver.table, resolver.scope = outerTable, outerScope
+}
+
+func (resolver *resolver) define(def *definition) {
+	symbol := resolver.table.Define(def.name)
+	resolver.symbols[symbolKey{resolver.table, symbol.Index}] = def
+	resolver.scope.definitions = append(resolver.scope.definitions, def)
+	resolver.analysis.references = append(resolver.analysis.references,
+		&reference{token: def.token, definition: def, declaration: true})
+}
+
+// Free symbols are copies of a symbol in the enclosing table, which is where
+// their definition is found
+func (resolver *resolver) definitionOf(symbol compiler.Symbol, table *compiler.SymbolTable) *definition {
+	switch symbol.Scope {
+	case compiler.BuiltinScope:
+		return resolver.builtins[symbol.Name]
+	case compiler.GlobalScope:
+		for table.Outer != nil {
+			table = table.Outer
+		}
+		return resolver.symbols[symbolKey{table, symbol.Index}]
+	case compiler.LocalScope:
+		return resolver.symbols[symbolKey{table, symbol.Index}]
+	case compiler.FreeScope:
+		return resolver.definitionOf(table.FreeSymbols[symbol.Index], table.Outer)
+	case compiler.FunctionScope:
+		return resolver.functions[table]
+	}
+	return nil
+}
+
+// Returns the identifier at a position, the one just before it included so
+// that a cursor right after a name still finds it
+func (analysis *analysis) referenceAt(line, column int) *reference {
+	for _, ref := range analysis.references {
+		start := ref.token.Column
+		end := start + len(ref.token.Literal)
+		if ref.token.Line == line && start <= column && column <= end {
+			return ref
+		}
+	}
+	return nil
+}
+
+func (analysis *analysis) referencesTo(def *definition, includeDeclaration bool) []*reference {
+	references := []*reference{}
+	for _, ref := range analysis.references {
+		if ref.definition == def && (includeDeclaration || !ref.declaration) {
+			references = append(references, ref)
+		}
+	}
+	return references
+}
+
+// Returns the names usable at a position, innermost first. Definitions after
+// the position are left out since the compiler only sees earlier ones
+func (analysis *analysis) visibleAt(line, column int) []*definition {
+	var innermost *scope
+	for _, s := range analysis.scopes {
+		if before(s.start, line, column) && !before(s.end, line, column) {
+			innermost = s // Scopes are listed outside in, the last match is innermost
+		}
+	}
+
+	seen := map[string]bool{}
+	visible := []*definition{}
+	add := func(def *definition) {
+		if def != nil && !seen[def.name] {
+			seen[def.name] = true
+			visible = append(visible, def)
+		}
+	}
+
+	for s := innermost; s != nil; s = s.parent {
+		for i := len(s.definitions) - 1; i >= 0; i-- {
+			if before(s.definitions[i].token, line, column) {
+				add(s.definitions[i])
+			}
+		}
+		add(s.function)
+	}
+	return visible
+}
+
+func before(tok token.Token, line, column int) bool {
+	return tok.Line < line || tok.Line == line && tok.Column < column
+}
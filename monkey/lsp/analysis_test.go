@@ -0,0 +1,127 @@
+package lsp
+
+import (
+	"fmt"
+	"monkey/object"
+	"strings"
+	"testing"
+)
+
+const source = `let count = 10;
+let makeAdder = fn(step) {
+  let total = count + step;
+  fn(x) { x + total + step }
+};
+let loop = fn(n) { if (n == 0) { 0 } else { loop(n - 1) } };
+let count = count + 1;
+puts(makeAdder(1)(count));`
+
+// Describes where each identifier is defined as "line:column -> line:column",
+// with "builtin" for builtins and "decl" for definitions themselves
+func describeReferences(analysis *analysis) []string {
+	described := []string{}
+	for _, ref := range analysis.references {
+		target := fmt.Sprintf("%d:%d", ref.definition.token.Line, ref.definition.token.Column)
+		switch {
+		case ref.declaration:
+			target = "decl"
+		case ref.definition.kind == "builtin":
+			target = "builtin"
+		}
+		described = append(described, fmt.Sprintf("%s %d:%d -> %s", ref.token.Literal, ref.token.Line, ref.token.Column, target))
+	}
+	return described
+}
+
+func TestResolveReferences(t *testing.T) {
+	expected := []string{
+		"count 1:5 -> decl",
+		"makeAdder 2:5 -> decl",
+		"step 2:20 -> decl",
+		"total 3:7 -> decl",
+		"count 3:15 -> 1:5",
+		"step 3:23 -> 2:20",
+		"x 4:6 -> decl",
+		"x 4:11 -> 4:6",
+		"total 4:15 -> 3:7", // Free in the inner function
+		"step 4:23 -> 2:20",
+		"loop 6:5 -> decl",
+		"n 6:15 -> decl",
+		"n 6:24 -> 6:15",
+		"loop 6:45 -> 6:5", // Through the function's own name
+		"n 6:50 -> 6:15",
+		"count 7:5 -> decl",
+		"count 7:13 -> 1:5", // The value still sees the binding it shadows
+		"puts 8:1 -> builtin",
+		"makeAdder 8:6 -> 2:5",
+		"count 8:19 -> 7:5",
+	}
+
+	analysis := analyze(source)
+	if len(analysis.problems) != 0 {
+		t.Fatalf("unexpected problems %v", analysis.problems)
+	}
+
+	got := describeReferences(analysis)
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong references.\nwant=\n%s\ngot=\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestAnalysisProblems(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let a = 1;\nlet b = a + c;", []string{"2:13 undefined variable c"}},
+		{"let = 1;\nlet x = ;", []string{
+			"1:5 expected next token to be IDENT, got = instead",
+			"1:5 No prefix parser function for = found",
+			"2:9 No prefix parser function for ; found",
+		}},
+		{"fn(x) { x }", []string{}},
+	}
+
+	for _, tt := range tests {
+		got := []string{}
+		for _, problem := range analyze(tt.input).problems {
+			got = append(got, fmt.Sprintf("%d:%d %s", problem.token.Line, problem.token.Column, problem.message))
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%q: wrong problems.\nwant=%q\ngot =%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestVisibleNames(t *testing.T) {
+	tests := []struct {
+		line, column int
+		expected     string
+	}{
+		{1, 1, ""},
+		{2, 1, "count"},
+		{3, 3, "step makeAdder count"}, // makeAdder through the function's own name
+		{4, 11, "x total step makeAdder count"},
+		{6, 44, "n loop makeAdder count"},
+		{8, 1, "count loop makeAdder"},
+	}
+
+	analysis := analyze(source)
+	for _, tt := range tests {
+		names := []string{}
+		for _, def := range analysis.visibleAt(tt.line, tt.column) {
+			names = append(names, def.name)
+		}
+		if strings.Join(names, " ") != tt.expected {
+			t.Errorf("%d:%d: wrong names. want=%q, got=%q", tt.line, tt.column, tt.expected, strings.Join(names, " "))
+		}
+	}
+}
+
+func TestBuiltinsAreDocumented(t *testing.T) {
+	for _, builtin := range object.Builtins {
+		if builtinDocs[builtin.Name].doc == "" {
+			t.Errorf("builtin %s has no documentation", builtin.Name)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package lsp
+
+// Shown when hovering over a builtin, every entry of object.Builtins needs one
+var builtinDocs = map[string]struct {
+	signature string
+	doc       string
+}{
+	"len":         {"len(value)", "Returns the number of elements in an array or bytes in a string."},
+	"first":       {"first(array)", "Returns the first element of an array, or null if it is empty."},
+	"last":        {"last(array)", "Returns the last element of an array, or null if it is empty."},
+	"rest":        {"rest(array)", "Returns a new array without the first element, or null if the array is empty."},
+	"push":        {"push(array, value)", "Returns a new array with value appended, the original is left unchanged."},
+	"puts":        {"puts(values...)", "Prints each value on its own line and returns null."},
+	"print":       {"print(values...)", "Prints the values without separators or a trailing newline and returns null."},
+	"gets":        {"gets()", "Reads a line from standard input without its line ending, or returns null at the end of input. Same as readline."},
+	"readline":    {"readline()", "Reads a line from standard input without its line ending, or returns null at the end of input."},
+	"args":        {"args()", "Returns the command line arguments passed to the script as an array of strings."},
+	"import":      {"import(path)", "Runs the module at path, relative to the importing file or a MONKEYPATH directory, once, and returns its exported top-level bindings. The .mk extension may be left out."},
+	"assert":      {"assert(condition, message)", "Fails the test, or stops the script, if condition is false or null. The message is optional."},
+	"assertEqual": {"assertEqual(actual, expected, message)", "Fails the test, or stops the script, unless actual equals expected. Arrays and hashes are compared by their contents. The message is optional."},
+	"assertError": {"assertError(value, text)", "Fails the test, or stops the script, unless value is an error, e.g. assertError(len(1)). If text is given the error's message must contain it."},
+}
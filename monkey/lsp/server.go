@@ -0,0 +1,300 @@
+// Package lsp implements the Language Server Protocol for Monkey, giving
+// editors diagnostics, go to definition, references, hover and completion
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"monkey/jsonrpc"
+	"monkey/object"
+	"monkey/token"
+	"strings"
+	"unicode/utf8"
+)
+
+// Server answers the requests of one editor session, keeping an analysis of
+// every open document. Documents are always sent whole
+type Server struct {
+	in        *bufio.Reader
+	out       io.Writer
+	documents map[string]*document
+	shutdown  bool
+}
+
+type document struct {
+	lines    []string
+	analysis *analysis
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		documents: map[string]*document{},
+	}
+}
+
+// Serve answers requests until the client sends exit or closes the input
+func (server *Server) Serve() error {
+	for {
+		data, err := jsonrpc.ReadMessage(server.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var msg message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue // Without an id there is nobody to answer
+		}
+		if msg.Method == "exit" {
+			if !server.shutdown {
+				return fmt.Errorf("exit before shutdown")
+			}
+			return nil
+		}
+
+		result, err := server.handle(&msg)
+		if msg.ID == nil {
+			continue // Notifications get no response, even failing ones
+		}
+
+		reply := &response{JSONRPC: "2.0", ID: msg.ID, Result: result}
+		if err != nil {
+			rpcErr, ok := err.(*responseError)
+			if !ok {
+				rpcErr = &responseError{codeInvalidParams, err.Error()}
+			}
+			reply.Result, reply.Error = nil, rpcErr
+		}
+		server.send(reply)
+	}
+}
+
+func (server *Server) handle(msg *message) (interface{}, error) {
+	if server.shutdown {
+		return nil, &responseError{codeInvalidRequest, "the server is shut down"}
+	}
+
+	switch msg.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   1, // Full documents
+				"definitionProvider": true,
+				"referencesProvider": true,
+				"hoverProvider":      true,
+				"completionProvider": map[string]interface{}{},
+			},
+			"serverInfo": map[string]string{"name": "monkey"},
+		}, nil
+
+	case "initialized":
+		return nil, nil
+
+	case "shutdown":
+		server.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		params := &didOpenParams{}
+		if err := json.Unmarshal(msg.Params, params); err != nil {
+			return nil, err
+		}
+		server.update(params.TextDocument.URI, params.TextDocument.Text)
+		return nil, nil
+
+	case "textDocument/didChange":
+		params := &didChangeParams{}
+		if err := json.Unmarshal(msg.Params, params); err != nil {
+			return nil, err
+		}
+		if len(params.ContentChanges) > 0 {
+			text := params.ContentChanges[len(params.ContentChanges)-1].Text
+			server.update(params.TextDocument.URI, text)
+		}
+		return nil, nil
+
+	case "textDocument/didClose":
+		params := &didCloseParams{}
+		if err := json.Unmarshal(msg.Params, params); err != nil {
+			return nil, err
+		}
+		delete(server.documents, params.TextDocument.URI)
+		server.notify("textDocument/publishDiagnostics",
+			publishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []diagnostic{}})
+		return nil, nil
+
+	case "textDocument/definition":
+		return server.withPosition(msg, server.definition)
+	case "textDocument/references":
+		return server.withPosition(msg, server.references)
+	case "textDocument/hover":
+		return server.withPosition(msg, server.hover)
+	case "textDocument/completion":
+		return server.withPosition(msg, server.completion)
+	}
+
+	if strings.HasPrefix(msg.Method, "$/") {
+		return nil, nil // Optional notifications, like $/cancelRequest
+	}
+	return nil, &responseError{codeMethodNotFound, fmt.Sprintf("unsupported method %s", msg.Method)}
+}
+
+// Decodes the params of requests about a position in an open document, the
+// handler gets the position as a token line and column
+func (server *Server) withPosition(msg *message,
+	handler func(uri string, document *document, line, column int, params *textDocumentPositionParams) interface{}) (interface{}, error) {
+	params := &textDocumentPositionParams{}
+	if err := json.Unmarshal(msg.Params, params); err != nil {
+		return nil, err
+	}
+
+	uri := params.TextDocument.URI
+	document, ok := server.documents[uri]
+	if !ok {
+		return nil, fmt.Errorf("%s is not open", uri)
+	}
+	line, column := document.column(params.Position)
+	return handler(uri, document, line, column, params), nil
+}
+
+func (server *Server) update(uri string, text string) {
+	document := &document{lines: strings.Split(text, "\n"), analysis: analyze(text)}
+	server.documents[uri] = document
+
+	diagnostics := []diagnostic{}
+	for _, problem := range document.analysis.problems {
+		diagnostics = append(diagnostics, diagnostic{
+			Range:    document.rangeOf(problem.token),
+			Severity: severityError,
+			Source:   "monkey",
+			Message:  problem.message,
+		})
+	}
+	server.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+}
+
+func (server *Server) definition(uri string, document *document, line, column int, _ *textDocumentPositionParams) interface{} {
+	ref := document.analysis.referenceAt(line, column)
+	if ref == nil || ref.definition.kind == "builtin" {
+		return nil
+	}
+	return location{URI: uri, Range: document.rangeOf(ref.definition.token)}
+}
+
+func (server *Server) references(uri string, document *document, line, column int, params *textDocumentPositionParams) interface{} {
+	locations := []location{}
+	ref := document.analysis.referenceAt(line, column)
+	if ref == nil {
+		return locations
+	}
+
+	for _, other := range document.analysis.referencesTo(ref.definition, params.Context.IncludeDeclaration) {
+		locations = append(locations, location{URI: uri, Range: document.rangeOf(other.token)})
+	}
+	return locations
+}
+
+func (server *Server) hover(uri string, document *document, line, column int, _ *textDocumentPositionParams) interface{} {
+	ref := document.analysis.referenceAt(line, column)
+	if ref == nil {
+		return nil
+	}
+
+	def := ref.definition
+	var text string
+	switch def.kind {
+	case "builtin":
+		doc := builtinDocs[def.name]
+		text = fmt.Sprintf("```monkey\n%s\n```\n%s", doc.signature, doc.doc)
+	case "parameter":
+		text = fmt.Sprintf("```monkey\n%s\n```\nParameter, defined on line %d", def.name, def.token.Line)
+	default:
+		text = fmt.Sprintf("```monkey\nlet %s\n```\n%s%s, defined on line %d",
+			def.name, strings.ToUpper(def.kind[:1]), def.kind[1:], def.token.Line)
+	}
+
+	return hover{Contents: markupContent{Kind: "markdown", Value: text}, Range: document.rangeOf(ref.token)}
+}
+
+func (server *Server) completion(uri string, document *document, line, column int, _ *textDocumentPositionParams) interface{} {
+	items := []completionItem{}
+	seen := map[string]bool{}
+
+	for _, def := range document.analysis.visibleAt(line, column) {
+		seen[def.name] = true
+		items = append(items, completionItem{Label: def.name, Kind: completionVariable, Detail: def.kind})
+	}
+	for _, builtin := range object.Builtins {
+		if !seen[builtin.Name] {
+			items = append(items, completionItem{Label: builtin.Name, Kind: completionFunction, Detail: builtinDocs[builtin.Name].signature})
+		}
+	}
+	for _, keyword := range token.Keywords() {
+		items = append(items, completionItem{Label: keyword, Kind: completionKeyword})
+	}
+	return items
+}
+
+// Converts an LSP position, counting UTF-16 code units, to a token line and
+// byte column
+func (document *document) column(p position) (int, int) {
+	if p.Line < 0 || p.Line >= len(document.lines) {
+		return p.Line + 1, 1
+	}
+
+	text := document.lines[p.Line]
+	units := 0
+	for i, r := range text {
+		if units >= p.Character {
+			return p.Line + 1, i + 1
+		}
+		units += utf16Len(r)
+	}
+	return p.Line + 1, len(text) + 1
+}
+
+func (document *document) position(line, column int) position {
+	index := line - 1
+	if index < 0 || index >= len(document.lines) {
+		return position{Line: max(index, 0)}
+	}
+
+	text := document.lines[index]
+	units := 0
+	for i, r := range text {
+		if i >= column-1 {
+			break
+		}
+		units += utf16Len(r)
+	}
+	return position{Line: index, Character: units}
+}
+
+func (document *document) rangeOf(tok token.Token) textRange {
+	return textRange{
+		Start: document.position(tok.Line, tok.Column),
+		End:   document.position(tok.Line, tok.Column+len(tok.Literal)),
+	}
+}
+
+func utf16Len(r rune) int {
+	if r >= 0x10000 && r <= utf8.MaxRune {
+		return 2
+	}
+	return 1
+}
+
+func (server *Server) notify(method string, params interface{}) {
+	server.send(&notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (server *Server) send(message interface{}) {
+	// Nothing can be reported once the client stopped listening
+	jsonrpc.WriteMessage(server.out, message)
+}
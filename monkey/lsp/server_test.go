@@ -0,0 +1,225 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"monkey/jsonrpc"
+	"strings"
+	"testing"
+	"time"
+)
+
+const uri = "file:///project/main.mk"
+
+// A scripted editor talking to a server over pipes
+type client struct {
+	t        *testing.T
+	out      io.Writer
+	messages chan received
+	id       int
+	served   chan error
+}
+
+type received struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+}
+
+func newClient(t *testing.T) *client {
+	t.Helper()
+
+	requests, requestWriter := io.Pipe()
+	responseReader, responses := io.Pipe()
+	c := &client{t: t, out: requestWriter, messages: make(chan received, 100), served: make(chan error, 1)}
+
+	go func() {
+		c.served <- NewServer(requests, responses).Serve()
+		responses.Close()
+	}()
+
+	go func() {
+		reader := bufio.NewReader(responseReader)
+		for {
+			body, err := jsonrpc.ReadMessage(reader)
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			var m received
+			if err := json.Unmarshal(body, &m); err != nil {
+				t.Errorf("invalid message %s: %s", body, err)
+			}
+			c.messages <- m
+		}
+	}()
+
+	t.Cleanup(func() { requestWriter.Close() })
+	return c
+}
+
+func (c *client) next() received {
+	c.t.Helper()
+	select {
+	case m, ok := <-c.messages:
+		if !ok {
+			c.t.Fatal("server closed the connection")
+		}
+		return m
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timed out waiting for the server")
+	}
+	return received{}
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.t.Helper()
+	err := jsonrpc.WriteMessage(c.out, map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+	if err != nil {
+		c.t.Fatalf("writing %s: %s", method, err)
+	}
+}
+
+// Sends a request and decodes the result of its response into result
+func (c *client) request(method string, params interface{}, result interface{}) *responseError {
+	c.t.Helper()
+	c.id++
+	err := jsonrpc.WriteMessage(c.out, map[string]interface{}{"jsonrpc": "2.0", "id": c.id, "method": method, "params": params})
+	if err != nil {
+		c.t.Fatalf("writing %s: %s", method, err)
+	}
+
+	m := c.next()
+	if m.ID == nil || *m.ID != c.id {
+		c.t.Fatalf("expected the response to %s, got %+v", method, m)
+	}
+	if m.Error == nil && result != nil {
+		if err := json.Unmarshal(m.Result, result); err != nil {
+			c.t.Fatalf("invalid %s result %s: %s", method, m.Result, err)
+		}
+	}
+	return m.Error
+}
+
+func (c *client) expectDiagnostics(expected ...string) {
+	c.t.Helper()
+	m := c.next()
+	if m.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("expected diagnostics, got %+v", m)
+	}
+
+	params := publishDiagnosticsParams{}
+	json.Unmarshal(m.Params, &params)
+	got := []string{}
+	for _, d := range params.Diagnostics {
+		got = append(got, formatRange(d.Range)+" "+d.Message)
+	}
+	if params.URI != uri || strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		c.t.Fatalf("wrong diagnostics for %s.\nwant=%q\ngot =%q", params.URI, expected, got)
+	}
+}
+
+func formatRange(r textRange) string {
+	return fmt.Sprintf("%d:%d-%d:%d", r.Start.Line, r.Start.Character, r.End.Line, r.End.Character)
+}
+
+func at(line, character int) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]string{"uri": uri},
+		"position":     position{line, character},
+		"context":      map[string]bool{"includeDeclaration": true},
+	}
+}
+
+func TestLanguageServerSession(t *testing.T) {
+	c := newClient(t)
+
+	result := struct {
+		Capabilities map[string]interface{}
+	}{}
+	c.request("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}}, &result)
+	if result.Capabilities["definitionProvider"] != true || result.Capabilities["hoverProvider"] != true {
+		t.Fatalf("wrong capabilities %v", result.Capabilities)
+	}
+	c.notify("initialized", map[string]interface{}{})
+
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "languageId": "monkey", "version": 1, "text": source},
+	})
+	c.expectDiagnostics()
+
+	// makeAdder in `puts(makeAdder(1)(count))`
+	var definition location
+	c.request("textDocument/definition", at(7, 7), &definition)
+	if definition.URI != uri || formatRange(definition.Range) != "1:4-1:13" {
+		t.Errorf("wrong definition %+v", definition)
+	}
+
+	var locations []location
+	c.request("textDocument/references", at(1, 20), &locations) // The step parameter
+	got := []string{}
+	for _, l := range locations {
+		got = append(got, formatRange(l.Range))
+	}
+	if strings.Join(got, " ") != "1:19-1:23 2:22-2:26 3:22-3:26" {
+		t.Errorf("wrong references %v", got)
+	}
+
+	var hovered hover
+	c.request("textDocument/hover", at(7, 1), &hovered)
+	if !strings.Contains(hovered.Contents.Value, "puts(values...)") || formatRange(hovered.Range) != "7:0-7:4" {
+		t.Errorf("wrong builtin hover %+v", hovered)
+	}
+	c.request("textDocument/hover", at(2, 8), &hovered)
+	if hovered.Contents.Value != "```monkey\nlet total\n```\nLocal, defined on line 3" {
+		t.Errorf("wrong hover %q", hovered.Contents.Value)
+	}
+
+	var items []completionItem
+	c.request("textDocument/completion", at(3, 10), &items)
+	labels := map[string]int{}
+	for _, item := range items {
+		labels[item.Label] = item.Kind
+	}
+	if labels["x"] != completionVariable || labels["count"] != completionVariable ||
+		labels["len"] != completionFunction || labels["fn"] != completionKeyword {
+		t.Errorf("wrong completion items %v", labels)
+	}
+	if _, ok := labels["loop"]; ok {
+		t.Errorf("loop is defined later and should not be completed")
+	}
+
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": uri, "version": 2},
+		"contentChanges": []map[string]string{{"text": "let a = 1;\nlet b = \"é\" + c;"}},
+	})
+	c.expectDiagnostics("1:14-1:15 undefined variable c") // é counts once in UTF-16
+
+	if err := c.request("textDocument/rename", at(0, 0), nil); err == nil || err.Code != codeMethodNotFound {
+		t.Errorf("expected method not found, got %+v", err)
+	}
+	if err := c.request("textDocument/hover", map[string]interface{}{
+		"textDocument": map[string]string{"uri": "file:///closed.mk"},
+		"position":     position{0, 0},
+	}, nil); err == nil {
+		t.Errorf("expected an error for a document that is not open")
+	}
+
+	c.notify("textDocument/didClose", map[string]interface{}{"textDocument": map[string]string{"uri": uri}})
+	c.expectDiagnostics()
+
+	c.request("shutdown", nil, nil)
+	c.notify("exit", nil)
+	select {
+	case err := <-c.served:
+		if err != nil {
+			t.Fatalf("Serve returned an error: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after exit")
+	}
+}
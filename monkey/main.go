@@ -3,21 +3,134 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"monkey/repl"
 	"os"
 	"os/user"
 )
 
-var useVM = flag.Bool("useVM", true, "Set to use bytecode VM for better performance")
+const usage = `Usage:
+  monkey [flags]                      start the REPL
+  monkey [flags] file.mk [args...]    run a script, or the one piped to stdin if file is -
+  monkey [flags] -e expression        evaluate an expression and print the result
+  monkey repl [-engine e] [-json]     start the REPL, or serve it as JSON on stdio for editors
+  monkey run [flags] file.mk [args...]
+  monkey build [-o file.mkc] file.mk  compile a script to bytecode that run can execute
+  monkey disasm file.mk               print the bytecode compiled from a script or .mkc file
+  monkey debug file.mk [args...]      step through a script on the vm, type help for commands
+  monkey dap                          serve the Debug Adapter Protocol on stdio for editors
+  monkey lsp                          serve the Language Server Protocol on stdio for editors
+  monkey fmt [-l] [-w] [path...]      format scripts, or stdin, in the canonical layout
+  monkey test [flags] [path...]       run the test_ functions of *_test.mk files
+  monkey serve [-addr host:port]      serve a playground page that runs code on the server
+
+Flags:
+`
+
+var commands = map[string]func(args []string) int{
+	"run":    runCommand,
+	"repl":   replCommand,
+	"build":  buildCommand,
+	"disasm": disasmCommand,
+	"debug":  debugCommand,
+	"dap":    dapCommand,
+	"lsp":    lspCommand,
+	"fmt":    fmtCommand,
+	"test":   testCommand,
+	"serve":  serveCommand,
+}
 
 func main() {
-	flag.Parse()
+	args := os.Args[1:]
 
-	curUser, err := user.Current()
-	if err != nil {
-		panic(err)
+	if len(args) > 0 {
+		if command, ok := commands[args[0]]; ok {
+			os.Exit(command(args[1:]))
+		}
 	}
-	fmt.Printf("Hello %s, this is the Monkey programming language\n", curUser)
+
+	os.Exit(defaultCommand(args))
+}
+
+// Without a subcommand we run whatever script or expression we're given,
+// e.g. from a `#!/usr/bin/env monkey` line, and fall back to the REPL
+func defaultCommand(args []string) int {
+	flags := newFlagSet("monkey")
+	opts := addRunFlags(flags)
+	useVM := flags.Bool("useVM", true, "Set to use bytecode VM for better performance")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	// -useVM predates -engine and is kept for existing scripts
+	engineSet := false
+	flags.Visit(func(f *flag.Flag) { engineSet = engineSet || f.Name == "engine" })
+	if !engineSet && !*useVM {
+		*opts.engine = "eval"
+	}
+
+	if *opts.expression != "" || flags.NArg() > 0 {
+		return runScript(opts, flags.Args())
+	}
+
+	if !isTerminal(os.Stdin) {
+		return runScript(opts, []string{"-"})
+	}
+
+	fmt.Printf("Hello %s, this is the Monkey programming language\n", greetingName())
 	fmt.Printf("Feel free to start typing commands\n")
-	repl.Start(os.Stdin, os.Stdout, *useVM)
+	repl.Start(os.Stdin, os.Stdout, *opts.engine == "vm")
+	return 0
+}
+
+// Starts the REPL even when stdin isn't a terminal, or with -json drives it
+// by requests so editors and notebooks can run code in a session
+func replCommand(args []string) int {
+	flags := newFlagSet("monkey repl")
+	engine := flags.String("engine", "vm", "use 'vm' or 'eval'")
+	useJSON := flags.Bool("json", false, "read requests and write responses as JSON framed by Content-Length headers")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *engine != "vm" && *engine != "eval" {
+		fmt.Fprintf(os.Stderr, "unknown engine %q, use 'vm' or 'eval'\n", *engine)
+		return 2
+	}
+
+	if *useJSON {
+		if err := repl.ServeJSON(os.Stdin, os.Stdout, *engine == "vm"); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	repl.Start(os.Stdin, os.Stdout, *engine == "vm")
+	return 0
+}
+
+func greetingName() string {
+	curUser, err := user.Current()
+	if err != nil || curUser.Username == "" {
+		return "there"
+	}
+	return curUser.Username
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		printUsage(flags.Output(), flags)
+	}
+	return flags
+}
+
+func printUsage(out io.Writer, flags *flag.FlagSet) {
+	fmt.Fprint(out, usage)
+	flags.PrintDefaults()
 }
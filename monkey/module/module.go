@@ -0,0 +1,173 @@
+package module
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/vm"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const Extension = ".mk"
+
+// Loader resolves, runs and caches the modules imported by one program. Each
+// module runs once in its own global namespace with the importer's engine and
+// runtime, and exports its top-level bindings not starting with an underscore
+type Loader struct {
+	Engine     string   // "vm" or "eval"
+	SearchPath []string // Directories tried after the importing file's own
+
+	// Coverage, if set, gives what records the coverage of each module run, or
+	// nil to leave it out
+	Coverage func(file string, source string, program *ast.Program) object.Coverage
+
+	modules map[string]*object.Module
+	loading []string // Modules currently being loaded, innermost last
+	dir     string   // Directory of the file currently being run
+}
+
+// NewLoader resolves imports made by the main program relative to dir, then
+// to the directories listed in MONKEYPATH
+func NewLoader(engine string, dir string) *Loader {
+	return &Loader{
+		Engine:     engine,
+		SearchPath: filepath.SplitList(os.Getenv("MONKEYPATH")),
+		modules:    make(map[string]*object.Module),
+		dir:        dir,
+	}
+}
+
+func (loader *Loader) Import(runtime *object.Runtime, path string) (*object.Module, error) {
+	file, err := loader.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if module, ok := loader.modules[file]; ok {
+		return module, nil
+	}
+
+	for i, loading := range loader.loading {
+		if loading == file {
+			cycle := append(append([]string{}, loader.loading[i:]...), file)
+			return nil, fmt.Errorf("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot import %q: %s", path, err)
+	}
+
+	outerDir := loader.dir
+	loader.dir = filepath.Dir(file)
+	loader.loading = append(loader.loading, file)
+	defer func() {
+		loader.dir = outerDir
+		loader.loading = loader.loading[:len(loader.loading)-1]
+	}()
+
+	exports, err := loader.run(runtime, file, string(source))
+	if err != nil {
+		// Failed nested imports and exceeded limits already abort the runtime
+		// with a descriptive error
+		if runtime.Err() != nil {
+			return nil, runtime.Err()
+		}
+		return nil, fmt.Errorf("in module %q: %s", path, err)
+	}
+
+	module := &object.Module{Name: path, Exports: exports}
+	loader.modules[file] = module
+	return module, nil
+}
+
+func (loader *Loader) resolve(path string) (string, error) {
+	if filepath.Ext(path) == "" {
+		path += Extension
+	}
+
+	if filepath.IsAbs(path) {
+		return path, nil
+	}
+
+	dirs := append([]string{loader.dir}, loader.SearchPath...)
+	for _, dir := range dirs {
+		candidate, err := filepath.Abs(filepath.Join(dir, path))
+		if err != nil {
+			continue
+		}
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+	}
+
+	return "", fmt.Errorf("cannot import %q: module not found in %s", path, strings.Join(dirs, ", "))
+}
+
+func (loader *Loader) run(runtime *object.Runtime, file string, source string) (map[string]object.Object, error) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, fmt.Errorf("parser errors:\n\t%s", strings.Join(p.Errors(), "\n\t"))
+	}
+
+	var coverage object.Coverage
+	if loader.Coverage != nil {
+		coverage = loader.Coverage(file, source, program)
+	}
+
+	exports := make(map[string]object.Object)
+
+	if loader.Engine == "eval" {
+		env := object.NewEnvironment()
+		env.SetRuntime(runtime)
+		env.SetCoverage(coverage)
+
+		result := evaluator.Eval(program, env)
+		if errObj, ok := result.(*object.Error); ok {
+			return nil, fmt.Errorf("%s", errObj.Message)
+		}
+
+		for _, name := range env.Names() {
+			if isExported(name) {
+				exports[name], _ = env.Get(name)
+			}
+		}
+		return exports, nil
+	}
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		return nil, err
+	}
+
+	globals := make([]object.Object, vm.GlobalsSize)
+	machine := vm.NewWithGlobalsStore(comp.Bytecode(), globals)
+	machine.SetRuntime(runtime)
+	if coverage != nil {
+		machine.SetCoverage(coverage)
+	}
+	err = machine.Run()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, symbol := range comp.SymbolTable().Symbols() {
+		if symbol.Scope == compiler.GlobalScope && isExported(symbol.Name) {
+			exports[symbol.Name] = globals[symbol.Index]
+		}
+	}
+	return exports, nil
+}
+
+func isExported(name string) bool {
+	return !strings.HasPrefix(name, "_")
+}
@@ -0,0 +1,164 @@
+package module
+
+import (
+	"bytes"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/vm"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// Runs input as the main program with the given engine, returning the result
+// and everything the program wrote
+func run(t *testing.T, engine string, loader *Loader, input string) (object.Object, string) {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	var stdout bytes.Buffer
+	runtime := object.NewRuntime()
+	runtime.Stdout = &stdout
+	if loader != nil {
+		runtime.Importer = loader
+	}
+
+	if engine == "eval" {
+		env := object.NewEnvironment()
+		env.SetRuntime(runtime)
+		return evaluator.Eval(program, env), stdout.String()
+	}
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := vm.New(comp.Bytecode())
+	machine.SetRuntime(runtime)
+	err = machine.Run()
+	if err != nil {
+		return &object.Error{Message: err.Error()}, stdout.String()
+	}
+	return machine.LastPoppedStackElem(), stdout.String()
+}
+
+var files = map[string]string{
+	"lib/math.mk": `
+        let helpers = import("helpers");
+        let _secret = 42;
+        let offset = 1;
+        let square = fn(x) { helpers.twice(x) * x / 2 + offset - 1 };
+        puts("loading math");
+    `,
+	"lib/helpers.mk": `let twice = fn(x) { x * 2 };`,
+	"path/util.mk":   `let greet = fn(name) { "hi " + name };`,
+	"cycle/a.mk":     `let b = import("b");`,
+	"cycle/b.mk":     `let a = import("a");`,
+}
+
+func TestImports(t *testing.T) {
+	dir := writeFiles(t, files)
+
+	tests := []struct {
+		input          string
+		expected       interface{}
+		expectedOutput string
+	}{
+		{`import("lib/math").square(4)`, int64(16), "loading math\n"},
+		{`let m = import("lib/math"); let n = import("lib/math.mk"); m == n`, true, "loading math\n"},
+		{`import("util").greet("monkey")`, "hi monkey", ""},
+		{`let offset = 100; import("lib/math").offset + offset`, int64(101), "loading math\n"},
+		{`import("lib/math")._secret`, "undefined member _secret on MODULE", "loading math\n"},
+		{`import("lib/math").helpers.twice(3)`, int64(6), "loading math\n"},
+		{`import("missing")`, "cannot import \"missing.mk\": module not found", ""},
+		{`import("cycle/a")`, "import cycle: ", ""},
+	}
+
+	for _, engine := range []string{"vm", "eval"} {
+		for _, tt := range tests {
+			loader := NewLoader(engine, dir)
+			loader.SearchPath = []string{filepath.Join(dir, "path")}
+
+			result, output := run(t, engine, loader, tt.input)
+
+			switch expected := tt.expected.(type) {
+			case int64:
+				integer, ok := result.(*object.Integer)
+				if !ok || integer.Value != expected {
+					t.Errorf("[%s] %s: wrong result. want=%d, got=%s", engine, tt.input, expected, result.Inspect())
+				}
+			case bool:
+				boolean, ok := result.(*object.Boolean)
+				if !ok || boolean.Value != expected {
+					t.Errorf("[%s] %s: wrong result. want=%t, got=%s", engine, tt.input, expected, result.Inspect())
+				}
+			case string:
+				switch result := result.(type) {
+				case *object.String:
+					if result.Value != expected {
+						t.Errorf("[%s] %s: wrong result. want=%q, got=%q", engine, tt.input, expected, result.Value)
+					}
+				case *object.Error:
+					if !strings.HasPrefix(result.Message, expected) {
+						t.Errorf("[%s] %s: wrong error. want prefix %q, got=%q", engine, tt.input, expected, result.Message)
+					}
+				default:
+					t.Errorf("[%s] %s: wrong result. want=%q, got=%s", engine, tt.input, expected, result.Inspect())
+				}
+			}
+
+			if output != tt.expectedOutput {
+				t.Errorf("[%s] %s: wrong output. want=%q, got=%q", engine, tt.input, tt.expectedOutput, output)
+			}
+		}
+	}
+}
+
+func TestImportCycleError(t *testing.T) {
+	dir := writeFiles(t, files)
+
+	result, _ := run(t, "vm", NewLoader("vm", dir), `import("cycle/a")`)
+
+	a := filepath.Join(dir, "cycle", "a.mk")
+	b := filepath.Join(dir, "cycle", "b.mk")
+	expected := "import cycle: " + a + " -> " + b + " -> " + a
+	if !strings.HasSuffix(result.Inspect(), expected) {
+		t.Errorf("wrong error. want suffix %q, got=%q", expected, result.Inspect())
+	}
+}
+
+func TestImportsDisabled(t *testing.T) {
+	result, _ := run(t, "vm", nil, `import("anything")`)
+
+	expected := `cannot import "anything": imports are not enabled`
+	if result.Inspect() != "ERROR: "+expected {
+		t.Errorf("wrong error. want=%q, got=%q", expected, result.Inspect())
+	}
+}
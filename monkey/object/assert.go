@@ -0,0 +1,203 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AssertionError aborts the runtime when an assert builtin fails, so the rest
+// of a test doesn't run. Line is that of the failing call, once an engine has
+// recorded it
+type AssertionError struct {
+	Message string
+	Line    int
+}
+
+func (ae *AssertionError) Error() string {
+	if ae.Line == 0 {
+		return "assertion failed: " + ae.Message
+	}
+	return fmt.Sprintf("assertion failed on line %d: %s", ae.Line, ae.Message)
+}
+
+// SetAssertionLine records line on the assertion that aborted runtime, if that
+// is why it stopped and no line was recorded yet, and reports whether it did.
+// Engines call it after a builtin returns an error, so the innermost call is
+// the one recorded
+func SetAssertionLine(runtime *Runtime, line int) bool {
+	var failure *AssertionError
+	if errors.As(runtime.Err(), &failure) && failure.Line == 0 {
+		failure.Line = line
+		return true
+	}
+	return false
+}
+
+// Fails unless the condition is neither false nor null, which the engines agree
+// on whatever else they consider truthy
+var assert = &Builtin{
+	Fn: func(runtime *Runtime, args ...Object) Object {
+		if len(args) != 1 && len(args) != 2 {
+			return newError("wrong number of arguments to `assert`. got=%d, want=1 or 2", len(args))
+		}
+
+		message, err := assertionMessage("assert", args, 1)
+		if err != nil {
+			return err
+		}
+
+		switch condition := args[0].(type) {
+		case nil, *Null:
+			return fail(runtime, message, "got null")
+		case *Boolean:
+			if !condition.Value {
+				return fail(runtime, message, "got false")
+			}
+		}
+		return nil
+	},
+}
+
+var assertEqual = &Builtin{
+	Fn: func(runtime *Runtime, args ...Object) Object {
+		if len(args) != 2 && len(args) != 3 {
+			return newError("wrong number of arguments to `assertEqual`. got=%d, want=2 or 3", len(args))
+		}
+
+		message, err := assertionMessage("assertEqual", args, 2)
+		if err != nil {
+			return err
+		}
+
+		if !Equal(args[0], args[1]) {
+			return fail(runtime, message, fmt.Sprintf("expected %s, got %s", describe(args[1]), describe(args[0])))
+		}
+		return nil
+	},
+}
+
+// Both engines pass assertError the error returned by a builtin called directly
+// in its arguments, rather than stopping at it
+var assertError = &Builtin{
+	Fn: func(runtime *Runtime, args ...Object) Object {
+		if len(args) != 1 && len(args) != 2 {
+			return newError("wrong number of arguments to `assertError`. got=%d, want=1 or 2", len(args))
+		}
+
+		// An aborted runtime also hands out errors, but they are not for
+		// scripts to handle
+		if runtime.Err() != nil {
+			return &Error{Message: runtime.Err().Error()}
+		}
+
+		err, ok := args[0].(*Error)
+		if !ok {
+			return fail(runtime, "", fmt.Sprintf("expected an error, got %s", describe(args[0])))
+		}
+		if len(args) == 2 {
+			part, ok := args[1].(*String)
+			if !ok {
+				return newError("second argument to `assertError` must be STRING, got %s", args[1].Type())
+			}
+			if !strings.Contains(err.Message, part.Value) {
+				return fail(runtime, "", fmt.Sprintf("expected an error containing %q, got %q", part.Value, err.Message))
+			}
+		}
+		return nil
+	},
+}
+
+// An optional message argument at index i is put before what went wrong
+func assertionMessage(name string, args []Object, i int) (string, *Error) {
+	if len(args) <= i {
+		return "", nil
+	}
+	message, ok := args[i].(*String)
+	if !ok {
+		return "", newError("message given to `%s` must be STRING, got %s", name, args[i].Type())
+	}
+	return message.Value, nil
+}
+
+func fail(runtime *Runtime, message string, problem string) Object {
+	if message != "" {
+		problem = message + ": " + problem
+	}
+	return abort(runtime, &AssertionError{Message: problem})
+}
+
+// Strings are quoted so "1" can be told from 1, and hash pairs sorted so
+// messages don't change between runs
+func describe(obj Object) string {
+	switch obj := obj.(type) {
+	case nil:
+		return "null"
+	case *String:
+		return strconv.Quote(obj.Value)
+	case *Array:
+		elements := make([]string, len(obj.Elements))
+		for i, element := range obj.Elements {
+			elements[i] = describe(element)
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *Hash:
+		pairs := make([]string, 0, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			pairs = append(pairs, describe(pair.Key)+": "+describe(pair.Value))
+		}
+		sort.Strings(pairs)
+		return "{" + strings.Join(pairs, ", ") + "}"
+	}
+	return obj.Inspect()
+}
+
+// Equal compares values the way assertEqual does: arrays and hashes by their
+// contents, functions and other objects by identity
+func Equal(a, b Object) bool {
+	if _, ok := a.(*Null); ok || a == nil {
+		_, ok := b.(*Null)
+		return ok || b == nil
+	}
+
+	switch a := a.(type) {
+	case *Integer:
+		b, ok := b.(*Integer)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Error:
+		b, ok := b.(*Error)
+		return ok && a.Message == b.Message
+	case *Array:
+		b, ok := b.(*Array)
+		if !ok || len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		for i := range a.Elements {
+			if !Equal(a.Elements[i], b.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		b, ok := b.(*Hash)
+		if !ok || len(a.Pairs) != len(b.Pairs) {
+			return false
+		}
+		for key, pair := range a.Pairs {
+			other, ok := b.Pairs[key]
+			if !ok || !Equal(pair.Value, other.Value) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
@@ -1,14 +1,19 @@
 package object
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+)
 
+// Builtins is shared by every runtime and must not be modified. Builtins keep no
+// state of their own, anything per-execution lives on the Runtime they are given
 var Builtins = []struct {
 	Name    string
 	Builtin *Builtin
 }{
 	{
 		"len",
-		&Builtin{Fn: func(args ...Object) Object {
+		&Builtin{Fn: func(runtime *Runtime, args ...Object) Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments to `len`. got=%d, want=1",
 					len(args))
@@ -29,7 +34,7 @@ var Builtins = []struct {
 	{
 		"first",
 		&Builtin{
-			Fn: func(args ...Object) Object {
+			Fn: func(runtime *Runtime, args ...Object) Object {
 				if len(args) != 1 {
 					return newError("wrong number of arguments to `first`. got=%d, want=1", len(args))
 				}
@@ -50,7 +55,7 @@ var Builtins = []struct {
 	{
 		"last",
 		&Builtin{
-			Fn: func(args ...Object) Object {
+			Fn: func(runtime *Runtime, args ...Object) Object {
 				if len(args) != 1 {
 					return newError("wrong number of arguments to `last`. got=%d, want=1", len(args))
 				}
@@ -72,7 +77,7 @@ var Builtins = []struct {
 	},
 	{"rest",
 		&Builtin{
-			Fn: func(args ...Object) Object {
+			Fn: func(runtime *Runtime, args ...Object) Object {
 				if len(args) != 1 {
 					return newError("wrong number of arguments to `rest`. got=%d, want=1", len(args))
 				}
@@ -86,7 +91,7 @@ var Builtins = []struct {
 					}
 					newElements := make([]Object, length-1, length-1)
 					copy(newElements, arr.Elements[1:])
-					return &Array{Elements: newElements}
+					return allocate(runtime, &Array{Elements: newElements})
 				default:
 					return newError("argument to `rest` not supported, got %s", args[0].Type())
 				}
@@ -95,7 +100,7 @@ var Builtins = []struct {
 	},
 	{
 		"push",
-		&Builtin{Fn: func(args ...Object) Object {
+		&Builtin{Fn: func(runtime *Runtime, args ...Object) Object {
 			if len(args) != 2 {
 				return newError("wrong number of arguments. got=%d, want=2",
 					len(args))
@@ -112,28 +117,124 @@ var Builtins = []struct {
 			copy(newElements, arr.Elements)
 			newElements[length] = args[1]
 
-			return &Array{Elements: newElements}
+			return allocate(runtime, &Array{Elements: newElements})
 		},
 		},
 	},
 	{
 		"puts",
 		&Builtin{
-			Fn: func(args ...Object) Object {
+			Fn: func(runtime *Runtime, args ...Object) Object {
 				for _, arg := range args {
-					fmt.Println(arg)
+					_, err := fmt.Fprintln(runtime.Stdout, arg.Inspect())
+					if err != nil {
+						return newError("could not write output: %s", err)
+					}
+				}
+
+				return nil
+			},
+		},
+	},
+	{
+		"print",
+		&Builtin{
+			Fn: func(runtime *Runtime, args ...Object) Object {
+				for _, arg := range args {
+					_, err := io.WriteString(runtime.Stdout, arg.Inspect())
+					if err != nil {
+						return newError("could not write output: %s", err)
+					}
 				}
 
 				return nil
 			},
 		},
 	},
+	{"gets", readLine("gets")},
+	{"readline", readLine("readline")},
+	{
+		"args",
+		&Builtin{
+			Fn: func(runtime *Runtime, args ...Object) Object {
+				if len(args) != 0 {
+					return newError("wrong number of arguments to `args`. got=%d, want=0", len(args))
+				}
+
+				elements := make([]Object, len(runtime.Args))
+				for i, arg := range runtime.Args {
+					elements[i] = &String{Value: arg}
+				}
+				return allocate(runtime, &Array{Elements: elements})
+			},
+		},
+	},
+	{
+		"import",
+		&Builtin{
+			Fn: func(runtime *Runtime, args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `import`. got=%d, want=1", len(args))
+				}
+
+				path, ok := args[0].(*String)
+				if !ok {
+					return newError("argument to `import` must be STRING, got %s", args[0].Type())
+				}
+
+				if runtime.Importer == nil {
+					return abort(runtime, fmt.Errorf("cannot import %q: imports are not enabled", path.Value))
+				}
+
+				module, err := runtime.Importer.Import(runtime, path.Value)
+				if err != nil {
+					return abort(runtime, err)
+				}
+				return module
+			},
+		},
+	},
+	{"assert", assert},
+	{"assertEqual", assertEqual},
+	{"assertError", assertError},
+}
+
+// Returns the next line of input, or null once input is exhausted. Errors use
+// name, the one of the two builtins that was called
+func readLine(name string) *Builtin {
+	return &Builtin{Fn: func(runtime *Runtime, args ...Object) Object {
+		if len(args) != 0 {
+			return newError("wrong number of arguments to `%s`. got=%d, want=0", name, len(args))
+		}
+
+		line, err := runtime.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return newError("could not read input: %s", err)
+		}
+
+		return allocate(runtime, &String{Value: line})
+	}}
 }
 
 func newError(format string, a ...interface{}) *Error {
 	return &Error{Message: fmt.Sprintf(format, a...)}
 }
 
+func abort(runtime *Runtime, err error) Object {
+	runtime.Abort(err)
+	return &Error{Message: err.Error()}
+}
+
+func allocate(runtime *Runtime, obj Object) Object {
+	if err := runtime.Allocate(obj); err != nil {
+		return &Error{Message: err.Error()}
+	}
+	return obj
+}
+
 func GetBuiltinByName(name string) *Builtin {
 	for _, def := range Builtins {
 		if def.Name == name {
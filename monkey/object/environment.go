@@ -3,11 +3,23 @@ package object
 import (
 	"bytes"
 	"fmt"
+	"maps"
+	"sort"
 )
 
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store    map[string]Object
+	outer    *Environment
+	runtime  *Runtime // Only set on the outermost environment
+	coverage Coverage // Likewise, and only when recording coverage
+}
+
+// Coverage is told which statements and if expressions of a script run, see
+// package cover. Each engine reports lines its own way, the evaluator every
+// statement and the VM every line it enters
+type Coverage interface {
+	Statement(line int)
+	Branch(line int, taken bool) // Whether the if on line ran its consequence
 }
 
 func NewEnvironment() *Environment {
@@ -21,6 +33,41 @@ func NewEnclosedEnvironment(outer *Environment) *Environment {
 	return env
 }
 
+func (e *Environment) Runtime() *Runtime {
+	if e.outer != nil {
+		return e.outer.Runtime()
+	}
+	if e.runtime == nil {
+		e.runtime = NewRuntime()
+	}
+	return e.runtime
+}
+
+func (e *Environment) SetRuntime(runtime *Runtime) {
+	if e.outer != nil {
+		e.outer.SetRuntime(runtime)
+		return
+	}
+	e.runtime = runtime
+}
+
+// Coverage returns what records the coverage of code run in e, or nil. Code
+// from modules runs in environments of its own and is not recorded
+func (e *Environment) Coverage() Coverage {
+	if e.outer != nil {
+		return e.outer.Coverage()
+	}
+	return e.coverage
+}
+
+func (e *Environment) SetCoverage(coverage Coverage) {
+	if e.outer != nil {
+		e.outer.SetCoverage(coverage)
+		return
+	}
+	e.coverage = coverage
+}
+
 func (e *Environment) Get(name string) (Object, bool) {
 	obj, ok := e.store[name]
 	if !ok && e.outer != nil {
@@ -34,6 +81,25 @@ func (e *Environment) Set(name string, value Object) Object {
 	return value
 }
 
+// Snapshot copies the bindings made directly in e, for Restore to put back
+func (e *Environment) Snapshot() map[string]Object {
+	return maps.Clone(e.store)
+}
+
+func (e *Environment) Restore(snapshot map[string]Object) {
+	e.store = maps.Clone(snapshot)
+}
+
+// Names lists the bindings made directly in this environment, in sorted order
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (e *Environment) String() string {
 	var out bytes.Buffer
 
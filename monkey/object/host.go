@@ -0,0 +1,101 @@
+package object
+
+import "fmt"
+
+const HOST_OBJ = "HOST"
+
+// Implemented by objects whose members scripts can reach with `value.member`
+type HasMembers interface {
+	Object
+	Member(name string) (Object, bool)
+}
+
+type HostMethod func(host *Host, args ...Object) Object
+type HostProperty func(host *Host) Object
+
+// HostType describes a kind of Go value handed to scripts: its name, the
+// methods and properties scripts can reach with `value.member`, and how it prints
+type HostType struct {
+	Name       ObjectType
+	Methods    map[string]HostMethod
+	Properties map[string]HostProperty
+	InspectFn  func(host *Host) string
+}
+
+// The engines convert objects of these types to their Go type once they have
+// checked Type, so a host type can't take one of them as its name
+var builtinTypes = map[ObjectType]bool{
+	INTEGER_OBJ: true, BOOLEAN_OBJ: true, STRING_OBJ: true, NULL_OBJ: true,
+	RETURN_VALUE_OBJ: true, ERROR_OBJ: true, FUNCTION_OBJ: true,
+	COMPILED_FUNCTION_OBJ: true, CLOSURE_OBJ: true, BUILTIN_OBJ: true,
+	ARRAY_OBJ: true, HASH_OBJ: true, MODULE_OBJ: true,
+}
+
+// NewHostType panics if name is that of a built-in type
+func NewHostType(name ObjectType) *HostType {
+	if builtinTypes[name] {
+		panic(fmt.Sprintf("host type name %q is taken by a built-in type", name))
+	}
+	return &HostType{
+		Name:       name,
+		Methods:    make(map[string]HostMethod),
+		Properties: make(map[string]HostProperty),
+	}
+}
+
+func (hostType *HostType) Method(name string, fn HostMethod) *HostType {
+	hostType.Methods[name] = fn
+	return hostType
+}
+
+func (hostType *HostType) Property(name string, fn HostProperty) *HostType {
+	hostType.Properties[name] = fn
+	return hostType
+}
+
+func (hostType *HostType) Wrap(value interface{}) *Host {
+	return &Host{Value: value, Kind: hostType}
+}
+
+// Host is an opaque handle on a live Go value. Scripts can only interact with
+// it through the members registered on its Kind
+type Host struct {
+	Value interface{}
+	Kind  *HostType
+}
+
+// A kind made without NewHostType and named like a built-in type is still HOST
+func (h *Host) Type() ObjectType {
+	if h.Kind == nil || h.Kind.Name == "" || builtinTypes[h.Kind.Name] {
+		return HOST_OBJ
+	}
+	return h.Kind.Name
+}
+
+func (h *Host) Inspect() string {
+	if h.Kind != nil && h.Kind.InspectFn != nil {
+		return h.Kind.InspectFn(h)
+	}
+	return fmt.Sprintf("%s [%v]", h.Type(), h.Value)
+}
+
+// Member resolves a property to its current value, or a method to a builtin
+// bound to this host so it can be called like any other function.
+// Like builtins, a property may produce nil which engines turn into their null
+func (h *Host) Member(name string) (Object, bool) {
+	if h.Kind == nil {
+		return nil, false
+	}
+
+	if property, ok := h.Kind.Properties[name]; ok {
+		return property(h), true
+	}
+
+	if method, ok := h.Kind.Methods[name]; ok {
+		return &Builtin{Fn: func(runtime *Runtime, args ...Object) Object {
+			return method(h, args...)
+		}}, true
+	}
+
+	return nil, false
+}
@@ -10,7 +10,7 @@ import (
 )
 
 type ObjectType string
-type BuiltinFunction func(args ...Object) Object
+type BuiltinFunction func(runtime *Runtime, args ...Object) Object
 
 const (
 	INTEGER_OBJ           = "INTEGER"
@@ -25,6 +25,7 @@ const (
 	BUILTIN_OBJ           = "BUILTIN"
 	ARRAY_OBJ             = "ARRAY"
 	HASH_OBJ              = "HASH"
+	MODULE_OBJ            = "MODULE"
 )
 
 type Object interface {
@@ -72,21 +73,13 @@ type String struct {
 	Value string
 }
 
-var strHashKeyMemo = make(map[string]HashKey)
-
 func (s *String) Type() ObjectType { return STRING_OBJ }
 func (s *String) Inspect() string  { return fmt.Sprintf("%s", s.Value) }
 func (s *String) HashKey() HashKey {
-	if hashKey, ok := strHashKeyMemo[s.Value]; ok {
-		return hashKey
-	}
-
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
-	hashKey := HashKey{Type: s.Type(), Value: h.Sum64()} // Can result in hash collision, but low probability, extra credit to fix
 
-	strHashKeyMemo[s.Value] = hashKey
-	return hashKey
+	return HashKey{Type: s.Type(), Value: h.Sum64()} // Can result in hash collision, but low probability, extra credit to fix
 }
 
 type Null struct{}
@@ -101,8 +94,11 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+// Error is a runtime error as a value. Line is that of the statement it came
+// from, once the evaluator has recorded it
 type Error struct {
 	Message string
+	Line    int
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
@@ -136,6 +132,12 @@ type CompiledFunction struct {
 	Instructions  code.Instructions
 	NumLocals     int
 	NumParameters int
+	Name          string // Binding the function literal was assigned to, if any
+
+	// Debug information
+	Lines      code.LineTable
+	LocalNames []string // Indexed like the locals, empty for shadowed ones
+	FreeNames  []string
 }
 
 func (c *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
@@ -150,6 +152,11 @@ type Builtin struct {
 type Closure struct {
 	Fn   *CompiledFunction
 	Free []Object // Semantically equivalent to Env field on regular function objects
+
+	// Constant pool and globals of the program that created the closure, so
+	// closures exported by imported modules keep running against their own
+	Constants []Object
+	Globals   []Object
 }
 
 func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
@@ -204,3 +211,15 @@ func (h *Hash) Inspect() string {
 
 	return out.String()
 }
+
+type Module struct {
+	Name    string
+	Exports map[string]Object
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return fmt.Sprintf("module %q", m.Name) }
+func (m *Module) Member(name string) (Object, bool) {
+	export, ok := m.Exports[name]
+	return export, ok
+}
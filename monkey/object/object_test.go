@@ -20,3 +20,70 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestHostMembers(t *testing.T) {
+	headers := map[string]string{"X": "forty-two"}
+	requestType := NewHostType("REQUEST").
+		Method("header", func(host *Host, args ...Object) Object {
+			name := args[0].(*String).Value
+			return &String{Value: host.Value.(map[string]string)[name]}
+		}).
+		Property("count", func(host *Host) Object {
+			return &Integer{Value: int64(len(host.Value.(map[string]string)))}
+		})
+	requestType.InspectFn = func(host *Host) string { return "request" }
+
+	req := requestType.Wrap(headers)
+
+	if req.Type() != "REQUEST" {
+		t.Errorf("host has wrong type. want=%q, got=%q", "REQUEST", req.Type())
+	}
+
+	if req.Inspect() != "request" {
+		t.Errorf("host has wrong Inspect. want=%q, got=%q", "request", req.Inspect())
+	}
+
+	count, ok := req.Member("count")
+	if !ok {
+		t.Fatalf("property count not found")
+	}
+	if count.(*Integer).Value != 1 {
+		t.Errorf("property has wrong value. want=1, got=%d", count.(*Integer).Value)
+	}
+
+	method, ok := req.Member("header")
+	if !ok {
+		t.Fatalf("method header not found")
+	}
+	result := method.(*Builtin).Fn(NewRuntime(), &String{Value: "X"})
+	if result.(*String).Value != "forty-two" {
+		t.Errorf("method returned wrong value. want=%q, got=%q", "forty-two", result.Inspect())
+	}
+
+	if _, ok := req.Member("missing"); ok {
+		t.Errorf("undefined member was found")
+	}
+
+	plain := &Host{Value: 1}
+	if plain.Type() != HOST_OBJ {
+		t.Errorf("host without kind has wrong type. want=%q, got=%q", HOST_OBJ, plain.Type())
+	}
+}
+
+func TestHostTypeNames(t *testing.T) {
+	for _, name := range []ObjectType{INTEGER_OBJ, STRING_OBJ, ARRAY_OBJ, HASH_OBJ} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewHostType(%q) did not panic", name)
+				}
+			}()
+			NewHostType(name)
+		}()
+
+		disguised := &Host{Value: 1, Kind: &HostType{Name: name}}
+		if disguised.Type() != HOST_OBJ {
+			t.Errorf("host named %q has wrong type. want=%q, got=%q", name, HOST_OBJ, disguised.Type())
+		}
+	}
+}
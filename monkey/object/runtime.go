@@ -0,0 +1,220 @@
+package object
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var (
+	ErrStepLimitExceeded = errors.New("step limit exceeded")
+	ErrCancelled         = errors.New("execution cancelled")
+	ErrMemoryLimit       = errors.New("memory limit exceeded")
+	ErrStackOverflow     = errors.New("stack overflow")
+)
+
+// How deep calls may nest, the number of frames the VM has room for
+const MaxCallDepth = 1024
+
+// Checking a context is slow compared to executing an instruction, so it is only
+// done every so many steps
+const contextCheckInterval = 1024
+
+// Runtime holds the per-execution state shared by an engine and the builtins it
+// calls. A zero MaxSteps or MaxMemory means there is no limit. MaxMemory caps the
+// approximate number of bytes allocated over the whole run, not the live heap
+type Runtime struct {
+	Context   context.Context
+	MaxSteps  int
+	MaxMemory int64
+	Stdout    io.Writer
+	Stdin     io.Reader
+	Args      []string // Command line arguments passed to the script
+	Importer  Importer
+
+	stdin      *bufio.Reader
+	steps      int
+	checkpoint int // Step count at which limits and the context are next checked
+	memory     MemoryStats
+	err        error
+	depth      int // Calls under way in the evaluator
+	coverage   map[*CompiledFunction]Coverage
+}
+
+// Importer loads the module behind an import("path") call using the same engine
+// as the importing script
+type Importer interface {
+	Import(runtime *Runtime, path string) (*Module, error)
+}
+
+type MemoryStats struct {
+	Bytes   int64
+	Objects int
+}
+
+func (ms MemoryStats) String() string {
+	return fmt.Sprintf("allocated %d bytes in %d objects", ms.Bytes, ms.Objects)
+}
+
+func NewRuntime() *Runtime {
+	return &Runtime{
+		Context: context.Background(),
+		Stdout:  os.Stdout,
+		Stdin:   os.Stdin,
+	}
+}
+
+// Step is called by the engines once per instruction or evaluated node. It is
+// kept small enough to be inlined, with the limit and context checks done only
+// when the step count reaches the next checkpoint. Once it fails, every later
+// call fails with the same error so execution unwinds
+func (rt *Runtime) Step() error {
+	rt.steps++
+	if rt.steps < rt.checkpoint {
+		return nil
+	}
+	return rt.check()
+}
+
+func (rt *Runtime) check() error {
+	if rt.err != nil {
+		return rt.err
+	}
+
+	if rt.MaxSteps > 0 && rt.steps > rt.MaxSteps {
+		rt.err = fmt.Errorf("%w (%d)", ErrStepLimitExceeded, rt.MaxSteps)
+		rt.checkpoint = 0
+		return rt.err
+	}
+
+	if rt.Context != nil {
+		if err := rt.Context.Err(); err != nil {
+			rt.err = fmt.Errorf("%w: %w", ErrCancelled, err)
+			rt.checkpoint = 0
+			return rt.err
+		}
+	}
+
+	rt.checkpoint = rt.steps + contextCheckInterval
+	if rt.MaxSteps > 0 && rt.checkpoint > rt.MaxSteps+1 {
+		rt.checkpoint = rt.MaxSteps + 1
+	}
+	return nil
+}
+
+// Allocate accounts for an array, hash, string or function created during
+// execution. Like a failed Step, exceeding the limit aborts the run
+func (rt *Runtime) Allocate(obj Object) error {
+	rt.memory.Bytes += sizeOf(obj)
+	rt.memory.Objects++
+
+	if rt.err != nil {
+		return rt.err
+	}
+
+	if rt.MaxMemory > 0 && rt.memory.Bytes > rt.MaxMemory {
+		rt.err = fmt.Errorf("%w (%d bytes)", ErrMemoryLimit, rt.MaxMemory)
+		rt.checkpoint = 0
+	}
+
+	return rt.err
+}
+
+func (rt *Runtime) MemoryStats() MemoryStats {
+	return rt.memory
+}
+
+// Rough sizes on a 64-bit platform: interface values and slice elements take 16
+// bytes, hash entries hold a HashKey and a HashPair
+func sizeOf(obj Object) int64 {
+	switch obj := obj.(type) {
+	case *String:
+		return 16 + int64(len(obj.Value))
+	case *Array:
+		return 24 + 16*int64(len(obj.Elements))
+	case *Hash:
+		return 48 + 56*int64(len(obj.Pairs))
+	case *Closure:
+		return 80 + 16*int64(len(obj.Free))
+	case *Function:
+		return 48
+	default:
+		return 16
+	}
+}
+
+// ReadLine returns the next line from Stdin without its line ending. Pass a
+// *bufio.Reader as Stdin to share buffered input with the host, e.g. the REPL
+func (rt *Runtime) ReadLine() (string, error) {
+	if rt.stdin == nil {
+		rt.stdin = bufio.NewReader(rt.Stdin)
+	}
+
+	line, err := rt.stdin.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// Abort stops execution as if a limit was hit, for failures a builtin can't
+// express as a value the script might ignore
+func (rt *Runtime) Abort(err error) {
+	if rt.err == nil {
+		rt.err = err
+		rt.checkpoint = 0
+	}
+}
+
+// Enter is called by the evaluator before each call, failing once MaxCallDepth
+// calls are under way so deep recursion ends before Go's stack does. Leave is
+// called once the call returns
+func (rt *Runtime) Enter() error {
+	if rt.depth >= MaxCallDepth {
+		return ErrStackOverflow
+	}
+	rt.depth++
+	return nil
+}
+
+func (rt *Runtime) Leave() {
+	rt.depth--
+}
+
+func (rt *Runtime) Steps() int {
+	return rt.steps
+}
+
+// SetCoverage records that coverage is told about the lines fn runs, for every
+// VM sharing the runtime. A module's functions are run by the VM of the code
+// calling them, not the one that compiled them
+func (rt *Runtime) SetCoverage(fn *CompiledFunction, coverage Coverage) {
+	if rt.coverage == nil {
+		rt.coverage = make(map[*CompiledFunction]Coverage)
+	}
+	rt.coverage[fn] = coverage
+}
+
+// Coverage returns what records the coverage of fn, or nil
+func (rt *Runtime) Coverage(fn *CompiledFunction) Coverage {
+	return rt.coverage[fn]
+}
+
+// Err reports why execution was aborted, or nil if it was not
+func (rt *Runtime) Err() error {
+	return rt.err
+}
+
+// Reset clears the step count, memory statistics and abort state so the runtime
+// can be reused, e.g. for the next line entered in the REPL
+func (rt *Runtime) Reset() {
+	rt.steps = 0
+	rt.checkpoint = 0
+	rt.memory = MemoryStats{}
+	rt.err = nil
+	rt.depth = 0
+}
@@ -0,0 +1,56 @@
+package object
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRuntimeStepLimit(t *testing.T) {
+	runtime := NewRuntime()
+	runtime.MaxSteps = 3
+
+	for i := 0; i < 3; i++ {
+		if err := runtime.Step(); err != nil {
+			t.Fatalf("step %d failed: %s", i, err)
+		}
+	}
+
+	if err := runtime.Step(); !errors.Is(err, ErrStepLimitExceeded) {
+		t.Fatalf("wrong error. want=%v, got=%v", ErrStepLimitExceeded, err)
+	}
+	if err := runtime.Step(); !errors.Is(err, ErrStepLimitExceeded) {
+		t.Fatalf("error is not sticky. got=%v", err)
+	}
+
+	runtime.Reset()
+	if err := runtime.Step(); err != nil {
+		t.Fatalf("step after reset failed: %s", err)
+	}
+}
+
+func TestRuntimeContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	runtime := NewRuntime()
+	runtime.Context = ctx
+
+	for i := 0; i < contextCheckInterval*2; i++ {
+		if err := runtime.Step(); err != nil {
+			t.Fatalf("step %d failed: %s", i, err)
+		}
+	}
+
+	cancel()
+
+	var err error
+	for i := 0; i <= contextCheckInterval && err == nil; i++ {
+		err = runtime.Step()
+	}
+
+	if !errors.Is(err, ErrCancelled) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("wrong error. want=%v, got=%v", context.Canceled, err)
+	}
+	if runtime.Err() != err {
+		t.Fatalf("runtime.Err() does not report abort reason. got=%v", runtime.Err())
+	}
+}
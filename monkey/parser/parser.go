@@ -17,7 +17,7 @@ const (
 	PRODUCT     // *
 	PREFIX      // -n or !n
 	CALL        // function(x)
-	INDEX       // array[index]
+	INDEX       // array[index] or object.member
 )
 
 var precedenceMap = map[token.TokenType]int{
@@ -31,6 +31,7 @@ var precedenceMap = map[token.TokenType]int{
 	token.SLASH:    PRODUCT,
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
+	token.DOT:      INDEX,
 }
 
 func getPrecedence(tokenType token.TokenType) int {
@@ -42,7 +43,7 @@ func getPrecedence(tokenType token.TokenType) int {
 
 type Parser struct {
 	lexer  *lexer.Lexer
-	errors []string
+	errors []Error
 
 	curToken  token.Token
 	peekToken token.Token
@@ -57,7 +58,7 @@ type (
 )
 
 func New(lexer *lexer.Lexer) *Parser {
-	parser := &Parser{lexer: lexer, errors: []string{}}
+	parser := &Parser{lexer: lexer, errors: []Error{}}
 
 	// Set curToken and peekToken
 	parser.nextToken()
@@ -88,6 +89,7 @@ func New(lexer *lexer.Lexer) *Parser {
 	parser.registerInfixFn(token.SLASH, parser.parseInfixExpression)
 	parser.registerInfixFn(token.LPAREN, parser.parseCallExpression)
 	parser.registerInfixFn(token.LBRACKET, parser.parseIndexExpression)
+	parser.registerInfixFn(token.DOT, parser.parseMemberExpression)
 
 	return parser
 }
@@ -175,13 +177,31 @@ func (parser *Parser) expectPeek(tt token.TokenType) bool {
 	return false
 }
 
+// Error is a syntax error at the token the parser could not make sense of
+type Error struct {
+	Message string
+	Token   token.Token
+}
+
 func (parser *Parser) Errors() []string {
+	messages := make([]string, len(parser.errors))
+	for i, err := range parser.errors {
+		messages[i] = err.Message
+	}
+	return messages
+}
+
+// ErrorList returns the errors along with where they were found
+func (parser *Parser) ErrorList() []Error {
 	return parser.errors
 }
 
+func (parser *Parser) addError(tok token.Token, format string, a ...interface{}) {
+	parser.errors = append(parser.errors, Error{Message: fmt.Sprintf(format, a...), Token: tok})
+}
+
 func (parser *Parser) peekError(tt token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead", tt, parser.peekToken.Type)
-	parser.errors = append(parser.errors, msg)
+	parser.addError(parser.peekToken, "expected next token to be %s, got %s instead", tt, parser.peekToken.Type)
 }
 
 func (parser *Parser) parseReturnStatement() *ast.ReturnStatement {
@@ -191,6 +211,10 @@ func (parser *Parser) parseReturnStatement() *ast.ReturnStatement {
 	statement.ReturnValue = parser.parseExpression(LOWEST)
 
 	for !parser.curTokenIs(token.SEMICOLON) {
+		if parser.peekTokenIs(token.EOF) {
+			parser.peekError(token.SEMICOLON)
+			break
+		}
 		parser.nextToken()
 	}
 
@@ -232,8 +256,7 @@ func (parser *Parser) parseExpression(precedence int) ast.Expression {
 }
 
 func (parser *Parser) noPrefixParserFnError(tt token.TokenType) {
-	msg := fmt.Sprintf("No prefix parser function for %s found", tt)
-	parser.errors = append(parser.errors, msg)
+	parser.addError(parser.curToken, "No prefix parser function for %s found", tt)
 }
 
 func (parser *Parser) parseIdentifier() ast.Expression {
@@ -245,8 +268,7 @@ func (parser *Parser) parseIntegerLiteral() ast.Expression {
 
 	value, err := strconv.ParseInt(parser.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", parser.curToken.Literal)
-		parser.errors = append(parser.errors, msg)
+		parser.addError(parser.curToken, "could not parse %q as integer", parser.curToken.Literal)
 		return nil
 	}
 
@@ -348,6 +370,7 @@ func (parser *Parser) parseBlockStatement() *ast.BlockStatement {
 		}
 		parser.nextToken()
 	}
+	block.End = parser.curToken
 
 	return block
 }
@@ -399,12 +422,14 @@ func (parser *Parser) parseFunctionParameters() []*ast.Identifier {
 func (parser *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	expression := &ast.CallExpression{Token: parser.curToken, Function: function}
 	expression.Arguments = parser.parseExpressionList(token.RPAREN)
+	expression.End = parser.curToken
 	return expression
 }
 
 func (parser *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: parser.curToken}
 	array.Elements = parser.parseExpressionList(token.RBRACKET)
+	array.End = parser.curToken
 	return array
 }
 
@@ -445,6 +470,17 @@ func (parser *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+func (parser *Parser) parseMemberExpression(object ast.Expression) ast.Expression {
+	expression := &ast.MemberExpression{Token: parser.curToken, Object: object}
+
+	if !parser.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	expression.Member = &ast.Identifier{Token: parser.curToken, Value: parser.curToken.Literal}
+	return expression
+}
+
 func (parser *Parser) parseHashLiteral() ast.Expression {
 	hash := &ast.HashLiteral{Token: parser.curToken}
 	hash.Pairs = make(map[ast.Expression]ast.Expression)
@@ -469,6 +505,7 @@ func (parser *Parser) parseHashLiteral() ast.Expression {
 	if !parser.expectPeek(token.RBRACE) {
 		return nil
 	}
+	hash.End = parser.curToken
 
 	return hash
 }
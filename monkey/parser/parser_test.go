@@ -459,6 +459,10 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"-a.b.c(d) * e",
+			"((-((a.b).c)(d)) * e)",
+		},
 	}
 
 	for _, tt := range tests {
@@ -837,6 +841,29 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingMemberExpressions(t *testing.T) {
+	input := "req.header"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	memberExp, ok := stmt.Expression.(*ast.MemberExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.MemberExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, memberExp.Object, "req") {
+		return
+	}
+
+	if !testIdentifier(t, memberExp.Member, "header") {
+		return
+	}
+}
+
 func TestParsingHashLiteralsStringKeys(t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3}`
 
@@ -938,3 +965,89 @@ func TestParsingEmptyHashLiteral(t *testing.T) {
 		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
 	}
 }
+
+func TestErrorPositions(t *testing.T) {
+	input := `let x = 5;
+let = 10;
+let y = fn(a {
+  a
+};`
+
+	p := New(lexer.New(input))
+	p.ParseProgram()
+
+	expected := []struct {
+		message string
+		line    int
+		column  int
+	}{
+		{"expected next token to be IDENT, got = instead", 2, 5},
+		{"No prefix parser function for = found", 2, 5},
+		{"expected next token to be ), got { instead", 3, 14},
+	}
+
+	errors := p.ErrorList()
+	if len(errors) < len(expected) {
+		t.Fatalf("expected at least %d errors, got %v", len(expected), p.Errors())
+	}
+	for i, want := range expected {
+		got := errors[i]
+		if got.Message != want.message || got.Token.Line != want.line || got.Token.Column != want.column {
+			t.Errorf("errors[%d] wrong. want=%q at %d:%d, got=%q at %d:%d", i,
+				want.message, want.line, want.column, got.Message, got.Token.Line, got.Token.Column)
+		}
+	}
+}
+
+// A return statement runs to its semicolon, which must come before the input ends
+func TestReturnStatementAtEOF(t *testing.T) {
+	p := New(lexer.New("return 5"))
+	p.ParseProgram()
+
+	errors := p.ErrorList()
+	if len(errors) != 1 || errors[0].Message != "expected next token to be ;, got EOF instead" || errors[0].Token.Type != token.EOF {
+		t.Errorf("wrong errors. got=%+v", errors)
+	}
+}
+
+func TestBlockStatementEnd(t *testing.T) {
+	input := "if (x) {\n  y\n}"
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	block := stmt.Expression.(*ast.IfExpression).Consequence
+	if block.End.Type != token.RBRACE || block.End.Line != 3 || block.End.Column != 1 {
+		t.Errorf("block.End wrong. got=%+v", block.End)
+	}
+}
+
+func TestListEnds(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected token.Token
+		end      func(ast.Expression) token.Token
+	}{
+		{"[1,\n 2]", token.Token{Type: token.RBRACKET, Literal: "]", Line: 2, Column: 3},
+			func(e ast.Expression) token.Token { return e.(*ast.ArrayLiteral).End }},
+		{"{1: 2 }", token.Token{Type: token.RBRACE, Literal: "}", Line: 1, Column: 7},
+			func(e ast.Expression) token.Token { return e.(*ast.HashLiteral).End }},
+		{"f(a, b)", token.Token{Type: token.RPAREN, Literal: ")", Line: 1, Column: 7},
+			func(e ast.Expression) token.Token { return e.(*ast.CallExpression).End }},
+		{"f()", token.Token{Type: token.RPAREN, Literal: ")", Line: 1, Column: 3},
+			func(e ast.Expression) token.Token { return e.(*ast.CallExpression).End }},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if end := tt.end(stmt.Expression); end != tt.expected {
+			t.Errorf("%q: end wrong. expected=%+v, got=%+v", tt.input, tt.expected, end)
+		}
+	}
+}
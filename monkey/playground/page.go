@@ -0,0 +1,108 @@
+package playground
+
+// The editor posts the code to /run and shows the response, Ctrl-Enter runs it
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Monkey playground</title>
+<style>
+body { font-family: sans-serif; margin: 2em; max-width: 60em; }
+textarea, pre { font-family: monospace; font-size: 14px; width: 100%; box-sizing: border-box; }
+textarea { height: 20em; tab-size: 4; }
+pre { background: #f4f4f4; padding: 0.5em; min-height: 2em; white-space: pre-wrap; }
+.error { color: #b00020; }
+.result { color: #1b5e20; }
+.meta { color: #666; font-size: small; }
+</style>
+</head>
+<body>
+<h1>Monkey playground</h1>
+<textarea id="code" spellcheck="false">let fibonacci = fn(x) {
+	if (x < 2) { return x; }
+	fibonacci(x - 1) + fibonacci(x - 2)
+};
+
+puts("fibonacci(15) is", fibonacci(15));
+</textarea>
+<p>
+<button id="run">Run</button>
+<select id="engine">
+<option value="vm">vm</option>
+<option value="eval">eval</option>
+</select>
+<label><input type="checkbox" id="ast"> syntax tree</label>
+<label><input type="checkbox" id="disasm"> bytecode</label>
+<span class="meta" id="meta"></span>
+</p>
+<pre id="output"></pre>
+<pre id="ast-output" hidden></pre>
+<pre id="disasm-output" hidden></pre>
+<script>
+const $ = (id) => document.getElementById(id);
+
+function show(id, text) {
+	$(id).textContent = text || "";
+	$(id).hidden = !text;
+}
+
+async function run() {
+	$("run").disabled = true;
+	$("meta").textContent = "running...";
+	try {
+		const response = await fetch("/run", {
+			method: "POST",
+			headers: {"Content-Type": "application/json"},
+			body: JSON.stringify({
+				code: $("code").value,
+				engine: $("engine").value,
+				ast: $("ast").checked,
+				disasm: $("disasm").checked,
+			}),
+		});
+		if (!response.ok) {
+			throw new Error(await response.text());
+		}
+		const result = await response.json();
+
+		const output = $("output");
+		output.textContent = result.output;
+		for (const error of result.errors || []) {
+			const span = document.createElement("span");
+			span.className = "error";
+			const position = error.line ? " on line " + error.line + (error.column ? ":" + error.column : "") : "";
+			span.textContent = error.stage + " error" + position + ": " + error.message + "\n";
+			output.appendChild(span);
+		}
+		if (result.type) {
+			const span = document.createElement("span");
+			span.className = "result";
+			span.textContent = result.result + "\n";
+			output.appendChild(span);
+		}
+		show("ast-output", result.ast);
+		show("disasm-output", result.disassembly);
+		$("meta").textContent = result.steps + " steps in " + result.duration;
+	} catch (error) {
+		$("output").textContent = error.message;
+		$("meta").textContent = "";
+	} finally {
+		$("run").disabled = false;
+	}
+}
+
+$("run").addEventListener("click", run);
+$("code").addEventListener("keydown", (event) => {
+	if (event.key === "Enter" && (event.ctrlKey || event.metaKey)) {
+		event.preventDefault();
+		run();
+	}
+	if (event.key === "Tab") {
+		event.preventDefault();
+		document.execCommand("insertText", false, "\t");
+	}
+});
+</script>
+</body>
+</html>
+`
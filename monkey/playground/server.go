@@ -0,0 +1,239 @@
+// Package playground serves a web page for writing and running Monkey code,
+// backed by a JSON endpoint that runs it under limits so the server can be
+// shared
+package playground
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/disasm"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/vm"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var ErrOutputLimit = errors.New("output limit exceeded")
+
+// Limits bound what a single run may use. Zero means no limit
+type Limits struct {
+	Timeout   time.Duration
+	MaxSteps  int
+	MaxMemory int64 // Bytes allocated over the whole run
+	MaxOutput int   // Bytes printed, the run is aborted once it prints more
+	MaxCode   int64 // Bytes of a request
+	MaxRuns   int   // Runs at once, requests for more are refused with 503
+}
+
+var DefaultLimits = Limits{
+	Timeout:   5 * time.Second,
+	MaxSteps:  10_000_000,
+	MaxMemory: 64 << 20,
+	MaxOutput: 64 << 10,
+	MaxCode:   64 << 10,
+	MaxRuns:   16,
+}
+
+type runRequest struct {
+	Code   string `json:"code"`
+	Engine string `json:"engine"` // vm or eval, vm if empty
+	AST    bool   `json:"ast"`    // Return the syntax tree
+	Disasm bool   `json:"disasm"` // Return the bytecode, whichever engine runs the code
+}
+
+type runResponse struct {
+	Output      string  `json:"output"`
+	Result      string  `json:"result,omitempty"`
+	Type        string  `json:"type,omitempty"`
+	Errors      []Error `json:"errors,omitempty"`
+	AST         string  `json:"ast,omitempty"`
+	Disassembly string  `json:"disassembly,omitempty"`
+	Steps       int     `json:"steps"`
+	Duration    string  `json:"duration"`
+}
+
+// Error tells why code didn't run, found at the given stage: parse, compile or
+// runtime. Line and Column are 0 where the position isn't known
+type Error struct {
+	Stage   string `json:"stage"`
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+}
+
+// Server answers GET / with the editor page and POST /run with the outcome of
+// running the code it is sent. Runs can't import modules or read input
+type Server struct {
+	limits Limits
+	mux    *http.ServeMux
+	runs   chan struct{} // Holds a token for each run under way, nil without MaxRuns
+}
+
+func NewServer(limits Limits) *Server {
+	server := &Server{limits: limits, mux: http.NewServeMux()}
+	if limits.MaxRuns > 0 {
+		server.runs = make(chan struct{}, limits.MaxRuns)
+	}
+	server.mux.HandleFunc("GET /{$}", server.page)
+	server.mux.HandleFunc("POST /run", server.run)
+	return server
+}
+
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.mux.ServeHTTP(w, r)
+}
+
+func (server *Server) page(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.WriteString(w, page)
+}
+
+func (server *Server) run(w http.ResponseWriter, r *http.Request) {
+	body := io.Reader(r.Body)
+	if server.limits.MaxCode > 0 {
+		body = http.MaxBytesReader(w, r.Body, server.limits.MaxCode)
+	}
+
+	request := &runRequest{}
+	if err := json.NewDecoder(body).Decode(request); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %s", err), http.StatusBadRequest)
+		return
+	}
+	switch request.Engine {
+	case "":
+		request.Engine = "vm"
+	case "vm", "eval":
+	default:
+		http.Error(w, fmt.Sprintf("unknown engine %q, use 'vm' or 'eval'", request.Engine), http.StatusBadRequest)
+		return
+	}
+
+	if server.runs != nil {
+		select {
+		case server.runs <- struct{}{}:
+			defer func() { <-server.runs }()
+		default:
+			http.Error(w, "too many runs at once, try again later", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	if server.limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, server.limits.Timeout)
+		defer cancel()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(server.execute(ctx, request))
+}
+
+// Runs the code of request, collecting everything asked for on the way
+func (server *Server) execute(ctx context.Context, request *runRequest) *runResponse {
+	start := time.Now()
+	response := &runResponse{}
+
+	runtime := object.NewRuntime()
+	runtime.Context = ctx
+	runtime.MaxSteps = server.limits.MaxSteps
+	runtime.MaxMemory = server.limits.MaxMemory
+	runtime.Stdin = strings.NewReader("")
+	output := &limitedOutput{max: server.limits.MaxOutput, runtime: runtime}
+	runtime.Stdout = output
+
+	defer func() {
+		response.Output = output.String()
+		response.Steps = runtime.Steps()
+		response.Duration = time.Since(start).String()
+	}()
+
+	p := parser.New(lexer.New(request.Code))
+	program := p.ParseProgram()
+	if parseErrors := p.ErrorList(); len(parseErrors) > 0 {
+		for _, err := range parseErrors {
+			response.Errors = append(response.Errors, Error{"parse", err.Message, err.Token.Line, err.Token.Column})
+		}
+		return response
+	}
+
+	if request.AST {
+		var tree strings.Builder
+		ast.Fprint(&tree, program)
+		response.AST = tree.String()
+	}
+
+	var bytecode *compiler.Bytecode
+	if request.Engine == "vm" || request.Disasm {
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil && request.Engine == "vm" {
+			compileErr := Error{Stage: "compile", Message: err.Error()}
+			if tokenErr, ok := err.(*compiler.Error); ok {
+				compileErr.Line, compileErr.Column = tokenErr.Token.Line, tokenErr.Token.Column
+			}
+			response.Errors = append(response.Errors, compileErr)
+			return response
+		}
+		// The evaluator reports what the compiler rejects once it runs
+		if err == nil {
+			bytecode = comp.Bytecode()
+		}
+	}
+	if request.Disasm && bytecode != nil {
+		var listing strings.Builder
+		disasm.Fprint(&listing, bytecode, nil, request.Code)
+		response.Disassembly = listing.String()
+	}
+
+	var result object.Object
+	if request.Engine == "eval" {
+		env := object.NewEnvironment()
+		env.SetRuntime(runtime)
+		result = evaluator.Eval(program, env)
+		if errObj, ok := result.(*object.Error); ok {
+			response.Errors = append(response.Errors, Error{Stage: "runtime", Message: errObj.Message, Line: errObj.Line})
+			return response
+		}
+	} else {
+		machine := vm.New(bytecode)
+		machine.SetRuntime(runtime)
+		if err := machine.Run(); err != nil {
+			response.Errors = append(response.Errors, Error{Stage: "runtime", Message: err.Error(), Line: machine.Line()})
+			return response
+		}
+		result = machine.LastPoppedStackElem()
+	}
+
+	if result != nil {
+		response.Result, response.Type = result.Inspect(), string(result.Type())
+	}
+	return response
+}
+
+// Keeps what a run prints up to max bytes and aborts the run once it prints
+// more, since a loop printing the same string allocates nothing
+type limitedOutput struct {
+	strings.Builder
+	max     int
+	runtime *object.Runtime
+}
+
+func (output *limitedOutput) Write(p []byte) (int, error) {
+	if output.max > 0 && output.Len()+len(p) > output.max {
+		n, _ := output.Builder.Write(p[:output.max-output.Len()])
+		err := fmt.Errorf("%w (%d bytes)", ErrOutputLimit, output.max)
+		output.runtime.Abort(err)
+		return n, err
+	}
+	return output.Builder.Write(p)
+}
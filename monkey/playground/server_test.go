@@ -0,0 +1,189 @@
+package playground
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Posts body to /run, returning the status and the response if there is one
+func post(t *testing.T, limits Limits, body string) (int, *runResponse) {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	NewServer(limits).ServeHTTP(recorder, httptest.NewRequest("POST", "/run", strings.NewReader(body)))
+	if recorder.Code != http.StatusOK {
+		return recorder.Code, nil
+	}
+
+	response := &runResponse{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), response); err != nil {
+		t.Fatalf("invalid response %s: %s", recorder.Body, err)
+	}
+	return recorder.Code, response
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		request  runRequest
+		output   string
+		result   string
+		typ      string
+		expected []Error
+	}{
+		{runRequest{Code: `puts("hello"); 1 + 2`}, "hello\n", "3", "INTEGER", nil},
+		{runRequest{Code: `puts("hello"); 1 + 2`, Engine: "eval"}, "hello\n", "3", "INTEGER", nil},
+		{runRequest{Code: "let x = 1;\nlet y = x +;"}, "", "", "",
+			[]Error{{"parse", "No prefix parser function for ; found", 2, 12}}},
+		{runRequest{Code: "puts(1);\n  z"}, "", "", "",
+			[]Error{{"compile", "undefined variable z", 2, 3}}},
+		{runRequest{Code: "puts(1);\n  z", Engine: "eval"}, "1\n", "", "",
+			[]Error{{Stage: "runtime", Message: "identifier not found: z", Line: 2}}},
+		{runRequest{Code: "puts(1);\nlet f = fn() { 1 + \"a\" };\nf()"}, "1\n", "", "",
+			[]Error{{Stage: "runtime", Message: "unsupported types for binary operation: INTEGER STRING", Line: 2}}},
+		{runRequest{Code: `gets()`}, "", "null", "NULL", nil},
+		{runRequest{Code: "let f = fn(x) { x };\nf()", Engine: "eval"}, "", "", "",
+			[]Error{{Stage: "runtime", Message: "wrong number of arguments: got=0, expected=1", Line: 2}}},
+		{runRequest{Code: "let f = fn(x) { x };\nf()"}, "", "", "",
+			[]Error{{Stage: "runtime", Message: "wrong number of arguments: got=0, expected=1", Line: 2}}},
+		{runRequest{Code: `import("lib")`, Engine: "eval"}, "", "", "",
+			[]Error{{Stage: "runtime", Message: `cannot import "lib": imports are not enabled`, Line: 1}}},
+	}
+
+	for _, tt := range tests {
+		body, _ := json.Marshal(tt.request)
+		_, response := post(t, DefaultLimits, string(body))
+		if response == nil {
+			t.Fatalf("no response for %q", tt.request.Code)
+		}
+		if response.Output != tt.output || response.Result != tt.result || response.Type != tt.typ {
+			t.Errorf("wrong outcome for %q. want=%q, %q, %q, got=%q, %q, %q", tt.request.Code,
+				tt.output, tt.result, tt.typ, response.Output, response.Result, response.Type)
+		}
+		if !reflect.DeepEqual(response.Errors, tt.expected) {
+			t.Errorf("wrong errors for %q. want=%+v, got=%+v", tt.request.Code, tt.expected, response.Errors)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	// Would take minutes
+	fib := "let fib = fn(x) { if (x < 2) { x } else { fib(x - 1) + fib(x - 2) } }; fib(40)"
+	tests := []struct {
+		limits  Limits
+		code    string
+		message string
+	}{
+		{Limits{MaxSteps: 1000}, fib, "step limit exceeded (1000)"},
+		{Limits{Timeout: 10 * time.Millisecond}, fib, "execution cancelled: context deadline exceeded"},
+		{Limits{MaxMemory: 1000}, `let f = fn(s) { f(s + "aaaaaaaaaa") }; f("")`, "memory limit exceeded (1000 bytes)"},
+		{Limits{MaxOutput: 10, MaxSteps: 100000}, `let f = fn() { puts("abcd"); f() }; f()`, "output limit exceeded (10 bytes)"},
+		// The VM runs out of frames and the evaluator of call depth, either way
+		// before the server's stack
+		{DefaultLimits, `let f = fn(x) { f(x + 1) }; f(0)`, "overflow"},
+	}
+
+	for _, tt := range tests {
+		for _, engine := range []string{"vm", "eval"} {
+			body, _ := json.Marshal(runRequest{Code: tt.code, Engine: engine})
+			_, response := post(t, tt.limits, string(body))
+			if response == nil || len(response.Errors) != 1 || !strings.HasSuffix(response.Errors[0].Message, tt.message) {
+				t.Errorf("%s: wrong errors for %q. want %q, got=%+v", engine, tt.code, tt.message, response)
+			}
+		}
+	}
+
+	_, response := post(t, Limits{MaxOutput: 10, MaxSteps: 100000}, `{"code": "let f = fn() { puts(\"abcd\"); f() }; f()"}`)
+	if response.Output != "abcd\nabcd\n" {
+		t.Errorf("wrong output kept. got=%q", response.Output)
+	}
+
+	code, _ := post(t, Limits{MaxCode: 10}, `{"code": "1 + 2 + 3 + 4"}`)
+	if code != http.StatusBadRequest {
+		t.Errorf("request over MaxCode not refused. got status %d", code)
+	}
+}
+
+func TestMaxRuns(t *testing.T) {
+	server := NewServer(Limits{MaxRuns: 1})
+	send := func(ctx context.Context, body string) int {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest("POST", "/run", strings.NewReader(body)).WithContext(ctx)
+		server.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	// Runs until cancelled, holding the only slot
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int)
+	go func() {
+		done <- send(ctx, `{"code": "let fib = fn(x) { if (x < 2) { x } else { fib(x - 1) + fib(x - 2) } }; fib(40)"}`)
+	}()
+	for len(server.runs) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if code := send(context.Background(), `{"code": "1"}`); code != http.StatusServiceUnavailable {
+		t.Errorf("run over MaxRuns not refused. got status %d", code)
+	}
+	cancel()
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("wrong status for the cancelled run. got %d", code)
+	}
+	if code := send(context.Background(), `{"code": "1"}`); code != http.StatusOK {
+		t.Errorf("run after the slot was freed refused. got status %d", code)
+	}
+}
+
+func TestTeaching(t *testing.T) {
+	body := `{"code": "let x = 1;\nx + 2", "engine": "eval", "ast": true, "disasm": true}`
+	_, response := post(t, DefaultLimits, body)
+
+	expectedAST := "Program\n  LetStatement x\n    IntegerLiteral 1\n  ExpressionStatement\n    InfixExpression +\n      Identifier x\n      IntegerLiteral 2\n"
+	if response.AST != expectedAST {
+		t.Errorf("wrong ast.\nwant=%q\ngot=%q", expectedAST, response.AST)
+	}
+	for _, expected := range []string{"OpSetGlobal 0", "OpGetGlobal 0", "OpAdd", "2| x + 2"} {
+		if !strings.Contains(response.Disassembly, expected) {
+			t.Errorf("disassembly has no %q.\ngot=%q", expected, response.Disassembly)
+		}
+	}
+	if response.Result != "3" {
+		t.Errorf("wrong result. got=%q", response.Result)
+	}
+}
+
+func TestRequests(t *testing.T) {
+	server := NewServer(DefaultLimits)
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"GET", "/", "", http.StatusOK},
+		{"GET", "/run", "", http.StatusMethodNotAllowed},
+		{"GET", "/missing", "", http.StatusNotFound},
+		{"POST", "/run", "{", http.StatusBadRequest},
+		{"POST", "/run", `{"code": "1", "engine": "js"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		if recorder.Code != tt.status {
+			t.Errorf("%s %s: wrong status. want=%d, got=%d", tt.method, tt.path, tt.status, recorder.Code)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(recorder.Body.String(), `fetch("/run"`) {
+		t.Errorf("page doesn't post to /run")
+	}
+}
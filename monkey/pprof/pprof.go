@@ -0,0 +1,259 @@
+// Package pprof writes profiles in the format read by `go tool pprof`: a
+// gzipped protocol buffer, described in
+// https://github.com/google/pprof/blob/main/proto/profile.proto
+package pprof
+
+import (
+	"compress/gzip"
+	"io"
+	"time"
+)
+
+type Profile struct {
+	SampleTypes []ValueType // What each of a sample's values measures
+	Samples     []Sample
+	DefaultType string // The sample type pprof shows unless asked otherwise
+	PeriodType  ValueType
+	Period      int64
+	Start       time.Time
+	Duration    time.Duration
+}
+
+type ValueType struct {
+	Type string // e.g. samples, time or calls
+	Unit string // e.g. count or nanoseconds
+}
+
+type Sample struct {
+	Stack  []Frame // Innermost first
+	Values []int64 // One for each of the profile's sample types
+}
+
+type Frame struct {
+	Function  string
+	File      string
+	StartLine int // Where the function is defined
+	Line      int
+}
+
+// Field numbers of the messages in profile.proto
+const (
+	profileSampleType    = 1
+	profileSample        = 2
+	profileLocation      = 4
+	profileFunction      = 5
+	profileStringTable   = 6
+	profileTimeNanos     = 9
+	profileDurationNanos = 10
+	profilePeriodType    = 11
+	profilePeriod        = 12
+	profileDefaultType   = 14
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	locationID   = 1
+	locationLine = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+	functionFilename   = 4
+	functionStartLine  = 5
+)
+
+// Write encodes the profile, compressed as pprof expects it
+func (profile *Profile) Write(out io.Writer) error {
+	zipped := gzip.NewWriter(out)
+	_, err := zipped.Write(profile.encode())
+	if err != nil {
+		return err
+	}
+	return zipped.Close()
+}
+
+type functionKey struct {
+	name, file string
+	startLine  int
+}
+
+type locationKey struct {
+	function uint64
+	line     int
+}
+
+// Functions and locations are stored once and referred to by id, strings by
+// their index in the string table
+type encoder struct {
+	message   buffer
+	strings   map[string]int64
+	functions map[functionKey]uint64
+	locations map[locationKey]uint64
+	tables    buffer // Functions and locations, written after the samples
+	names     []string
+}
+
+func (profile *Profile) encode() []byte {
+	encoder := &encoder{
+		strings:   map[string]int64{},
+		functions: map[functionKey]uint64{},
+		locations: map[locationKey]uint64{},
+	}
+	encoder.string("") // Index 0 is always the empty string
+
+	for _, sampleType := range profile.SampleTypes {
+		encoder.message.bytes(profileSampleType, encoder.valueType(sampleType))
+	}
+
+	for _, sample := range profile.Samples {
+		ids := make([]uint64, len(sample.Stack))
+		for i, frame := range sample.Stack {
+			ids[i] = encoder.location(frame)
+		}
+
+		var message buffer
+		message.packedUint64(sampleLocationID, ids)
+		message.packedInt64(sampleValue, sample.Values)
+		encoder.message.bytes(profileSample, message)
+	}
+
+	periodType := encoder.valueType(profile.PeriodType)
+	defaultType := encoder.string(profile.DefaultType)
+
+	// Every string is known by now
+	encoder.message = append(encoder.message, encoder.tables...)
+	for _, name := range encoder.names {
+		encoder.message.string(profileStringTable, name)
+	}
+
+	encoder.message.int64(profileTimeNanos, profile.Start.UnixNano())
+	encoder.message.int64(profileDurationNanos, profile.Duration.Nanoseconds())
+	encoder.message.bytes(profilePeriodType, periodType)
+	encoder.message.int64(profilePeriod, profile.Period)
+	encoder.message.int64(profileDefaultType, defaultType)
+	return encoder.message
+}
+
+func (encoder *encoder) string(s string) int64 {
+	index, ok := encoder.strings[s]
+	if !ok {
+		index = int64(len(encoder.names))
+		encoder.strings[s] = index
+		encoder.names = append(encoder.names, s)
+	}
+	return index
+}
+
+func (encoder *encoder) valueType(valueType ValueType) buffer {
+	var message buffer
+	message.int64(valueTypeType, encoder.string(valueType.Type))
+	message.int64(valueTypeUnit, encoder.string(valueType.Unit))
+	return message
+}
+
+func (encoder *encoder) function(frame Frame) uint64 {
+	key := functionKey{frame.Function, frame.File, frame.StartLine}
+	id, ok := encoder.functions[key]
+	if ok {
+		return id
+	}
+
+	id = uint64(len(encoder.functions) + 1)
+	encoder.functions[key] = id
+	var message buffer
+	message.uint64(functionID, id)
+	message.int64(functionName, encoder.string(frame.Function))
+	message.int64(functionSystemName, encoder.string(frame.Function))
+	message.int64(functionFilename, encoder.string(frame.File))
+	message.int64(functionStartLine, int64(frame.StartLine))
+	encoder.tables.bytes(profileFunction, message)
+	return id
+}
+
+func (encoder *encoder) location(frame Frame) uint64 {
+	function := encoder.function(frame)
+	key := locationKey{function, frame.Line}
+	id, ok := encoder.locations[key]
+	if ok {
+		return id
+	}
+
+	id = uint64(len(encoder.locations) + 1)
+	encoder.locations[key] = id
+	var line buffer
+	line.uint64(lineFunctionID, function)
+	line.int64(lineLine, int64(frame.Line))
+
+	var message buffer
+	message.uint64(locationID, id)
+	message.bytes(locationLine, line)
+	encoder.tables.bytes(profileLocation, message)
+	return id
+}
+
+// The protocol buffer wire format, of which profiles only need varints and
+// length delimited fields
+type buffer []byte
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (b *buffer) varint(x uint64) {
+	for x >= 0x80 {
+		*b = append(*b, byte(x)|0x80)
+		x >>= 7
+	}
+	*b = append(*b, byte(x))
+}
+
+func (b *buffer) key(field int, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+// Zero values are the default and left out
+func (b *buffer) uint64(field int, x uint64) {
+	if x != 0 {
+		b.key(field, wireVarint)
+		b.varint(x)
+	}
+}
+
+func (b *buffer) int64(field int, x int64) {
+	b.uint64(field, uint64(x))
+}
+
+func (b *buffer) bytes(field int, message []byte) {
+	b.key(field, wireBytes)
+	b.varint(uint64(len(message)))
+	*b = append(*b, message...)
+}
+
+// Strings of the string table are written even when empty, their position
+// is their index
+func (b *buffer) string(field int, s string) {
+	b.bytes(field, []byte(s))
+}
+
+func (b *buffer) packedUint64(field int, xs []uint64) {
+	var packed buffer
+	for _, x := range xs {
+		packed.varint(x)
+	}
+	b.bytes(field, packed)
+}
+
+func (b *buffer) packedInt64(field int, xs []int64) {
+	var packed buffer
+	for _, x := range xs {
+		packed.varint(uint64(x))
+	}
+	b.bytes(field, packed)
+}
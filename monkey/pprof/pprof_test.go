@@ -0,0 +1,110 @@
+package pprof
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+	"time"
+)
+
+// Splits a message into its fields, by number, as raw varints or bytes
+func decode(t *testing.T, message []byte) map[int][]interface{} {
+	t.Helper()
+	fields := map[int][]interface{}{}
+	for len(message) > 0 {
+		key, n := readVarint(message)
+		message = message[n:]
+		switch key & 7 {
+		case wireVarint:
+			value, n := readVarint(message)
+			message = message[n:]
+			fields[int(key>>3)] = append(fields[int(key>>3)], value)
+		case wireBytes:
+			length, n := readVarint(message)
+			message = message[n:]
+			fields[int(key>>3)] = append(fields[int(key>>3)], message[:length])
+			message = message[length:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return fields
+}
+
+func readVarint(data []byte) (uint64, int) {
+	var x uint64
+	for i, b := range data {
+		x |= uint64(b&0x7f) << (7 * i)
+		if b < 0x80 {
+			return x, i + 1
+		}
+	}
+	return x, len(data)
+}
+
+func TestWrite(t *testing.T) {
+	frame := func(function string, line int) Frame {
+		return Frame{Function: function, File: "main.mk", StartLine: 1, Line: line}
+	}
+	profile := &Profile{
+		SampleTypes: []ValueType{{"samples", "count"}, {"time", "nanoseconds"}},
+		Samples: []Sample{
+			{Stack: []Frame{frame("fib", 3), frame("main", 9)}, Values: []int64{2, 2000}},
+			{Stack: []Frame{frame("fib", 4), frame("fib", 3), frame("main", 9)}, Values: []int64{1, 1000}},
+		},
+		DefaultType: "time",
+		PeriodType:  ValueType{"time", "nanoseconds"},
+		Period:      1000,
+		Start:       time.Unix(10, 0),
+		Duration:    3 * time.Microsecond,
+	}
+
+	var out bytes.Buffer
+	if err := profile.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatalf("profile is not gzipped: %s", err)
+	}
+	data, _ := io.ReadAll(reader)
+	fields := decode(t, data)
+
+	names := []string{}
+	for _, s := range fields[profileStringTable] {
+		names = append(names, string(s.([]byte)))
+	}
+	expectedNames := []string{"", "samples", "count", "time", "nanoseconds", "fib", "main.mk", "main"}
+	if len(names) != len(expectedNames) {
+		t.Fatalf("wrong string table. want=%q, got=%q", expectedNames, names)
+	}
+	for i := range names {
+		if names[i] != expectedNames[i] {
+			t.Fatalf("wrong string table. want=%q, got=%q", expectedNames, names)
+		}
+	}
+
+	// fib:3, main:9 and fib:4 are three locations in two functions
+	if len(fields[profileSample]) != 2 || len(fields[profileLocation]) != 3 || len(fields[profileFunction]) != 2 {
+		t.Errorf("wrong number of samples, locations or functions: %d, %d, %d",
+			len(fields[profileSample]), len(fields[profileLocation]), len(fields[profileFunction]))
+	}
+
+	second := decode(t, fields[profileSample][1].([]byte))
+	ids := []uint64{}
+	packed := second[sampleLocationID][0].([]byte)
+	for len(packed) > 0 {
+		id, n := readVarint(packed)
+		ids = append(ids, id)
+		packed = packed[n:]
+	}
+	if len(ids) != 3 || ids[0] != 3 || ids[1] != 1 || ids[2] != 2 {
+		t.Errorf("wrong locations of the second sample %v", ids)
+	}
+
+	if fields[profilePeriod][0].(uint64) != 1000 || fields[profileDurationNanos][0].(uint64) != 3000 ||
+		fields[profileTimeNanos][0].(uint64) != 10e9 || names[fields[profileDefaultType][0].(uint64)] != "time" {
+		t.Errorf("wrong period, duration, time or default type %v", fields)
+	}
+}
@@ -0,0 +1,220 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/disasm"
+	"monkey/object"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A command typed after a colon at the prompt
+type command struct {
+	usage    string
+	help     string
+	argument bool // Without one the usage is printed instead
+	code     bool // The argument is code, which may continue over lines
+	run      func(session *session, argument string)
+}
+
+var commands = map[string]command{
+	":ast": {
+		usage:    ":ast <code>",
+		help:     "print the syntax tree of code without running it",
+		argument: true,
+		code:     true,
+		run:      (*session).printAST,
+	},
+	":bytecode": {
+		usage:    ":bytecode <code>",
+		help:     "print the bytecode of code without running it",
+		argument: true,
+		code:     true,
+		run:      (*session).printBytecode,
+	},
+	":disasm": {
+		usage: ":disasm",
+		help:  "toggle printing the bytecode of every input before the vm runs it",
+		run:   (*session).toggleBytecode,
+	},
+	":env": {
+		usage: ":env",
+		help:  "list the globals defined so far with their values",
+		run:   (*session).printEnv,
+	},
+	":reset": {
+		usage: ":reset",
+		help:  "forget everything defined so far",
+		run:   (*session).resetCommand,
+	},
+	":load": {
+		usage:    ":load <file>",
+		help:     "run the code in file as if it was typed",
+		argument: true,
+		run:      (*session).load,
+	},
+	":save": {
+		usage:    ":save <file>",
+		help:     "write the inputs that ran without errors to file",
+		argument: true,
+		run:      (*session).save,
+	},
+	":engine": {
+		usage:    ":engine vm|eval",
+		help:     "switch engines, running the inputs so far again on the new one",
+		argument: true,
+		run:      (*session).switchEngine,
+	},
+	":time": {
+		usage:    ":time <code>",
+		help:     "run code and print how long it took",
+		argument: true,
+		code:     true,
+		run:      (*session).time,
+	},
+}
+
+func (session *session) help() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(session.out, "%-18s %s\n", commands[name].usage, commands[name].help)
+	}
+	fmt.Fprintf(session.out, "%-18s %s\n", ":help", "list these commands")
+}
+
+func (session *session) printAST(code string) {
+	program, ok := session.parse(code)
+	if !ok {
+		return
+	}
+	ast.Fprint(session.out, program)
+}
+
+// Code is compiled against copies of the session's symbols, so it can refer to
+// the globals defined so far without defining any of its own
+func (session *session) printBytecode(code string) {
+	program, ok := session.parse(code)
+	if !ok {
+		return
+	}
+
+	var symbolTable *compiler.SymbolTable
+	if session.useVM {
+		symbolTable = session.symbolTable.Copy()
+	} else {
+		symbolTable = compiler.NewSymbolTable()
+		for idx, builtin := range object.Builtins {
+			symbolTable.DefineBuiltin(idx, builtin.Name)
+		}
+		for _, name := range session.env.Names() {
+			symbolTable.Define(name)
+		}
+	}
+
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	if err := comp.Compile(program); err != nil {
+		fmt.Fprintf(session.out, "Whoops, compile error:\n %s\n", err)
+		return
+	}
+	disasm.Fprint(session.out, comp.Bytecode(), symbolTable, code)
+}
+
+func (session *session) toggleBytecode(string) {
+	session.showBytecode = !session.showBytecode
+	fmt.Fprintf(session.out, "disassembly %s\n", map[bool]string{true: "on", false: "off"}[session.showBytecode])
+}
+
+func (session *session) printEnv(string) {
+	names := session.globalNames()
+	sort.Strings(names)
+
+	for _, name := range names {
+		if value, ok := session.global(name); ok {
+			fmt.Fprintf(session.out, "%s = %s\n", name, value.Inspect())
+		}
+	}
+}
+
+func (session *session) resetCommand(string) {
+	session.reset()
+	fmt.Fprintln(session.out, "session reset")
+}
+
+func (session *session) load(path string) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(session.out, "could not load %s: %s\n", path, err)
+		return
+	}
+	session.run(string(source))
+}
+
+func (session *session) save(path string) {
+	var source strings.Builder
+	for _, input := range session.inputs {
+		source.WriteString(input)
+		source.WriteString("\n")
+	}
+	if err := os.WriteFile(path, []byte(source.String()), 0o644); err != nil {
+		fmt.Fprintf(session.out, "could not save %s: %s\n", path, err)
+		return
+	}
+	fmt.Fprintf(session.out, "saved %d inputs to %s\n", len(session.inputs), path)
+}
+
+// The new engine starts from scratch and runs the inputs again without
+// printing anything or reading the REPL's input. Those that fail on it are
+// dropped
+func (session *session) switchEngine(engine string) {
+	switch engine {
+	case "vm":
+		session.useVM = true
+	case "eval":
+		session.useVM = false
+	default:
+		fmt.Fprintln(session.out, "usage: :engine vm|eval")
+		return
+	}
+
+	inputs := session.inputs
+	out := session.out
+	session.out = io.Discard
+	session.reset()
+	session.runtime.Stdin = bufio.NewReader(strings.NewReader(""))
+
+	failed := 0
+	for _, input := range inputs {
+		if !session.run(input) {
+			failed++
+		}
+	}
+
+	session.out = out
+	session.runtime.Stdout = out
+	session.runtime.Stdin = session.in
+
+	fmt.Fprintf(out, "switched to %s, replayed %d inputs", engine, len(inputs))
+	if failed > 0 {
+		fmt.Fprintf(out, ", %d failed", failed)
+	}
+	fmt.Fprintln(out)
+}
+
+func (session *session) time(code string) {
+	start := time.Now()
+	if !session.run(code) {
+		return
+	}
+	fmt.Fprintf(session.out, "took %s, %d steps\n", time.Since(start), session.runtime.Steps())
+}
@@ -0,0 +1,116 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"monkey/jsonrpc"
+	"strings"
+)
+
+// Messages of the JSON protocol ServeJSON speaks, each framed by a
+// Content-Length header as in the Language Server Protocol
+
+type request struct {
+	ID      int    `json:"id"`
+	Command string `json:"command"` // eval, complete, inspect or reset
+	Code    string `json:"code"`    // For eval
+	Stdin   string `json:"stdin"`   // What gets and readline read during eval
+	Word    string `json:"word"`    // For complete
+	Name    string `json:"name"`    // For inspect, empty for every global
+}
+
+type response struct {
+	ID         int          `json:"id"`
+	Success    bool         `json:"success"`
+	Value      string       `json:"value,omitempty"`
+	Type       string       `json:"type,omitempty"`
+	Stdout     string       `json:"stdout,omitempty"`
+	Errors     []inputError `json:"errors,omitempty"`
+	Candidates []string     `json:"candidates,omitempty"`
+	Globals    []global     `json:"globals,omitempty"`
+}
+
+type global struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Type  string `json:"type"`
+}
+
+// ServeJSON runs a REPL session for editors and notebooks, answering each
+// request with a response carrying the same id until the input ends. Requests
+// that can't be answered get a response with an error at the request stage
+func ServeJSON(in io.Reader, out io.Writer, useVM bool) error {
+	reader := bufio.NewReader(in)
+	// The protocol owns the input, scripts read the stdin sent with eval
+	session := newSession(bufio.NewReader(strings.NewReader("")), io.Discard, useVM)
+
+	for {
+		message, err := jsonrpc.ReadMessage(reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		request := &request{}
+		var resp *response
+		if err := json.Unmarshal(message, request); err != nil {
+			resp = failure(request, fmt.Sprintf("invalid request: %s", err))
+		} else {
+			resp = session.handle(request)
+		}
+		if err := jsonrpc.WriteMessage(out, resp); err != nil {
+			return err
+		}
+	}
+}
+
+func (session *session) handle(request *request) *response {
+	switch request.Command {
+	case "eval":
+		var stdout bytes.Buffer
+		session.runtime.Stdout = &stdout
+		session.runtime.Stdin = bufio.NewReader(strings.NewReader(request.Stdin))
+
+		value, errors := session.execute(request.Code)
+		resp := &response{ID: request.ID, Success: len(errors) == 0, Stdout: stdout.String(), Errors: errors}
+		if len(errors) == 0 {
+			session.inputs = append(session.inputs, request.Code)
+			if value != nil {
+				resp.Value, resp.Type = value.Inspect(), string(value.Type())
+			}
+		}
+		return resp
+
+	case "complete":
+		return &response{ID: request.ID, Success: true, Candidates: complete(request.Word, session.globalNames())}
+
+	case "inspect":
+		names := session.globalNames()
+		if request.Name != "" {
+			names = []string{request.Name}
+		}
+		resp := &response{ID: request.ID, Success: true, Globals: []global{}}
+		for _, name := range names {
+			value, ok := session.global(name)
+			if !ok {
+				return failure(request, fmt.Sprintf("undefined variable %s", name))
+			}
+			resp.Globals = append(resp.Globals, global{name, value.Inspect(), string(value.Type())})
+		}
+		return resp
+
+	case "reset":
+		session.reset()
+		return &response{ID: request.ID, Success: true}
+	}
+	return failure(request, fmt.Sprintf("unknown command %q", request.Command))
+}
+
+func failure(request *request, message string) *response {
+	return &response{ID: request.ID, Errors: []inputError{{Stage: "request", Message: message}}}
+}
@@ -0,0 +1,135 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"monkey/jsonrpc"
+	"reflect"
+	"testing"
+)
+
+// Sends requests to a JSON session and returns its responses. Strings are sent
+// as they are, anything else is encoded first
+func serveJSON(t *testing.T, useVM bool, requests ...interface{}) []response {
+	t.Helper()
+
+	var in, out bytes.Buffer
+	for _, r := range requests {
+		if raw, ok := r.(string); ok {
+			fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(raw), raw)
+		} else if err := jsonrpc.WriteMessage(&in, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ServeJSON(&in, &out, useVM); err != nil {
+		t.Fatalf("ServeJSON error: %s", err)
+	}
+
+	responses := []response{}
+	reader := bufio.NewReader(&out)
+	for {
+		body, err := jsonrpc.ReadMessage(reader)
+		if err == io.EOF {
+			return responses
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp response
+		if err := json.Unmarshal(body, &resp); err != nil {
+			t.Fatalf("invalid response %s: %s", body, err)
+		}
+		responses = append(responses, resp)
+	}
+}
+
+func TestJSONSession(t *testing.T) {
+	requests := []interface{}{
+		request{ID: 1, Command: "eval", Code: "let x = 2;\nputs(x, gets());\nx * 3", Stdin: "hi\n"},
+		request{ID: 2, Command: "eval", Code: "let y =\n  x +;"},
+		request{ID: 3, Command: "complete", Word: "x"},
+		request{ID: 4, Command: "inspect", Name: "x"},
+		request{ID: 5, Command: "inspect", Name: "y"},
+		request{ID: 6, Command: "reset"},
+		request{ID: 7, Command: "inspect"},
+		request{ID: 8, Command: "jump"},
+		`{"id": 9, "command": `,
+	}
+	expected := []response{
+		{ID: 1, Success: true, Value: "6", Type: "INTEGER", Stdout: "2\nhi\n"},
+		{ID: 2, Errors: []inputError{{"parse", "No prefix parser function for ; found", 2, 6}}},
+		{ID: 3, Success: true, Candidates: []string{"x"}},
+		{ID: 4, Success: true, Globals: []global{{"x", "2", "INTEGER"}}},
+		{ID: 5, Errors: []inputError{{Stage: "request", Message: "undefined variable y"}}},
+		{ID: 6, Success: true},
+		{ID: 7, Success: true},
+		{ID: 8, Errors: []inputError{{Stage: "request", Message: `unknown command "jump"`}}},
+		{Errors: []inputError{{Stage: "request", Message: "invalid request: unexpected end of JSON input"}}},
+	}
+
+	for _, useVM := range []bool{true, false} {
+		responses := serveJSON(t, useVM, requests...)
+		if !reflect.DeepEqual(responses, expected) {
+			t.Errorf("useVM=%t: wrong responses.\nwant=%+v\ngot=%+v", useVM, expected, responses)
+		}
+	}
+}
+
+func TestJSONFailedEvalDefinesNothing(t *testing.T) {
+	requests := []interface{}{
+		request{ID: 1, Command: "eval", Code: "let a = 1;"},
+		request{ID: 2, Command: "eval", Code: "let a = 2; let b = 1;\nb / 0"},
+		request{ID: 3, Command: "inspect"},
+		request{ID: 4, Command: "eval", Code: "let z = len(1);"},
+		request{ID: 5, Command: "inspect", Name: "z"},
+	}
+	expected := []response{
+		{ID: 1, Success: true, Value: "1", Type: "INTEGER"},
+		{ID: 2, Errors: []inputError{{Stage: "runtime", Message: "division by zero", Line: 2}}},
+		{ID: 3, Success: true, Globals: []global{{"a", "1", "INTEGER"}}},
+		{ID: 4, Errors: []inputError{{Stage: "runtime", Message: "argument to `len` not supported, got INTEGER", Line: 1}}},
+		{ID: 5, Errors: []inputError{{Stage: "request", Message: "undefined variable z"}}},
+	}
+
+	for _, useVM := range []bool{true, false} {
+		responses := serveJSON(t, useVM, requests...)
+		if !reflect.DeepEqual(responses, expected) {
+			t.Errorf("useVM=%t: wrong responses.\nwant=%+v\ngot=%+v", useVM, expected, responses)
+		}
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	tests := []struct {
+		code    string
+		useVM   bool
+		stdout  string
+		errorAt inputError
+	}{
+		{"puts(1);\nlet f = fn() { 1 + \"a\" };\nf()", true, "1\n",
+			inputError{"runtime", "unsupported types for binary operation: INTEGER STRING", 2, 0}},
+		{"puts(1);\nlet f = fn() { 1 + \"a\" };\nf()", false, "1\n",
+			inputError{"runtime", "type mismatch: INTEGER + STRING", 2, 0}},
+		{"1;\n  z", true, "",
+			inputError{"compile", "undefined variable z", 2, 3}},
+		{"assert(1 > 2)", true, "",
+			inputError{"runtime", "assertion failed on line 1: got false", 1, 0}},
+		{"assert(1 > 2)", false, "",
+			inputError{"runtime", "assertion failed on line 1: got false", 1, 0}},
+		{"1;\nlen(1)", true, "",
+			inputError{"runtime", "argument to `len` not supported, got INTEGER", 2, 0}},
+		{"1;\nlen(1)", false, "",
+			inputError{"runtime", "argument to `len` not supported, got INTEGER", 2, 0}},
+	}
+
+	for _, tt := range tests {
+		responses := serveJSON(t, tt.useVM, request{ID: 1, Command: "eval", Code: tt.code})
+		expected := []response{{ID: 1, Stdout: tt.stdout, Errors: []inputError{tt.errorAt}}}
+		if !reflect.DeepEqual(responses, expected) {
+			t.Errorf("useVM=%t: wrong response for %q.\nwant=%+v\ngot=%+v", tt.useVM, tt.code, expected, responses)
+		}
+	}
+}
@@ -4,15 +4,29 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"monkey/ast"
 	"monkey/compiler"
+	"monkey/disasm"
 	"monkey/evaluator"
 	"monkey/lexer"
+	"monkey/lineedit"
+	"monkey/module"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/token"
 	"monkey/vm"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 )
 
 const PROMPT = ">>"
+const CONTINUATION_PROMPT = ".."
+
+// Kept in the home directory when the REPL runs in a terminal
+const HISTORY_FILE = ".monkey_history"
+const HISTORY_SIZE = 1000
 const MONKEY_FACE = `            __,__
    .--.  .-"     "-.  .--.
   / .. \/  .-. .-.  \/ .. \
@@ -26,66 +40,330 @@ const MONKEY_FACE = `            __,__
            '-----'
 `
 
+// Start reads inputs from in and runs them, keeping what they define for the
+// next. Lines starting with a colon are commands, see :help
 func Start(in io.Reader, out io.Writer, useVM bool) {
-	scanner := bufio.NewScanner(in)
+	// Scripts calling gets read from the same buffered input as the prompt
+	reader := bufio.NewReader(in)
+	session := newSession(reader, out, useVM)
+
+	readLine := func(prompt string) (string, error) {
+		fmt.Fprint(out, prompt)
+		return session.runtime.ReadLine()
+	}
+	if file, ok := in.(*os.File); ok && lineedit.IsTerminal(int(file.Fd())) {
+		editor := lineedit.New(reader, out, int(file.Fd()))
+		editor.History = loadHistory()
+		editor.Complete = func(word string) []string {
+			return complete(word, session.globalNames())
+		}
+		readLine = editor.ReadLine
+	}
+
+	for {
+		line, err := readLine(PROMPT)
+		if err == lineedit.ErrInterrupted {
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		if strings.HasPrefix(strings.TrimSpace(line), ":") {
+			name, argument, _ := strings.Cut(strings.TrimSpace(line), " ")
+			command, ok := commands[name]
+			if name == ":help" {
+				session.help()
+				continue
+			}
+			if !ok {
+				fmt.Fprintf(out, "unknown command %s, type :help for a list\n", name)
+				continue
+			}
+			if command.argument && strings.TrimSpace(argument) == "" {
+				fmt.Fprintf(out, "usage: %s\n", command.usage)
+				continue
+			}
+			if command.code {
+				argument, err = readContinuation(readLine, argument)
+				if err == lineedit.ErrInterrupted {
+					continue
+				}
+			}
+			command.run(session, strings.TrimSpace(argument))
+			continue
+		}
+
+		input, err := readContinuation(readLine, line)
+		if err == lineedit.ErrInterrupted {
+			continue
+		}
+		session.run(input)
+	}
+}
+
+// The state kept between inputs, for whichever engine runs them
+type session struct {
+	in    *bufio.Reader
+	out   io.Writer
+	useVM bool
+
+	runtime *object.Runtime
 
 	// Tree walking interpreter
-	env := object.NewEnvironment()
+	env *object.Environment
 
 	// Bytecode VM
-	constants := []object.Object{}
-	globals := make([]object.Object, vm.GlobalsSize)
+	constants    []object.Object
+	globals      []object.Object
+	symbolTable  *compiler.SymbolTable
+	showBytecode bool
+
+	inputs []string // That ran without errors, for :save and :engine
+}
 
-	symbolTable := compiler.NewSymbolTable()
+func newSession(in *bufio.Reader, out io.Writer, useVM bool) *session {
+	session := &session{in: in, out: out, useVM: useVM}
+	session.reset()
+	return session
+}
+
+// Forgets everything defined so far
+func (session *session) reset() {
+	session.runtime = object.NewRuntime()
+	session.runtime.Stdout = session.out
+	session.runtime.Stdin = session.in
+	session.runtime.Importer = module.NewLoader(session.engine(), ".")
+
+	session.env = object.NewEnvironment()
+	session.env.SetRuntime(session.runtime)
+
+	session.constants = []object.Object{}
+	session.globals = make([]object.Object, vm.GlobalsSize)
+	session.symbolTable = compiler.NewSymbolTable()
 	for idx, builtin := range object.Builtins {
-		symbolTable.DefineBuiltin(idx, builtin.Name)
+		session.symbolTable.DefineBuiltin(idx, builtin.Name)
 	}
 
-	for {
-		fmt.Fprint(out, PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
-			return
+	session.inputs = nil
+}
+
+func (session *session) engine() string {
+	if session.useVM {
+		return "vm"
+	}
+	return "eval"
+}
+
+// What kept an input from running, found at the given stage: parse, compile
+// or runtime. Line and Column are 0 where the position isn't known
+type inputError struct {
+	Stage   string `json:"stage"`
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+}
+
+// Runs input, returning its value and why it failed if it did. Failing input
+// leaves the globals as they were, and the evaluator returns its error as the
+// value
+func (session *session) execute(input string) (object.Object, []inputError) {
+	session.runtime.Reset()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errors := p.ErrorList(); len(errors) > 0 {
+		inputErrors := make([]inputError, len(errors))
+		for i, err := range errors {
+			inputErrors[i] = inputError{"parse", err.Message, err.Token.Line, err.Token.Column}
 		}
+		return nil, inputErrors
+	}
 
-		line := scanner.Text()
-		lex := lexer.New(line)
-		parse := parser.New(lex)
+	if !session.useVM {
+		snapshot := session.env.Snapshot()
+		evaluated := evaluator.Eval(program, session.env)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			session.env.Restore(snapshot)
+			return evaluated, []inputError{{Stage: "runtime", Message: errObj.Message, Line: errObj.Line}}
+		}
+		return evaluated, nil
+	}
 
-		program := parse.ParseProgram()
-		if len(parse.Errors()) > 0 {
-			printParserErrors(out, parse.Errors())
-			continue
+	// Input is compiled against copies, kept only once it has run, so that
+	// failing input doesn't leave globals defined that were never set
+	symbolTable := session.symbolTable.Copy()
+	constants := session.constants[:len(session.constants):len(session.constants)]
+
+	comp := compiler.NewWithState(symbolTable, constants)
+	if err := comp.Compile(program); err != nil {
+		inputErr := inputError{Stage: "compile", Message: err.Error()}
+		if compileErr, ok := err.(*compiler.Error); ok {
+			inputErr.Line, inputErr.Column = compileErr.Token.Line, compileErr.Token.Column
 		}
+		return nil, []inputError{inputErr}
+	}
 
-		if useVM {
-			comp := compiler.NewWithState(symbolTable, constants)
-			err := comp.Compile(program)
-			if err != nil {
-				fmt.Fprintf(out, "Whoops, compile error:\n %s\n", err)
-				continue
-			}
+	if session.showBytecode {
+		disasm.Fprint(session.out, comp.Bytecode(), symbolTable, input)
+	}
 
-			machine := vm.NewWithGlobalsStore(comp.Bytecode(), globals)
-			err = machine.Run()
-			if err != nil {
-				fmt.Fprintf(out, "Woops! Executing bytecode failed:\n %s\n", err)
-				continue
-			}
+	machine := vm.NewWithGlobalsStore(comp.Bytecode(), session.globals)
+	machine.SetRuntime(session.runtime)
+	if err := machine.Run(); err != nil {
+		return nil, []inputError{{Stage: "runtime", Message: err.Error(), Line: machine.Line()}}
+	}
+	// Like the evaluator's, an error left as the value is a failure
+	value := machine.LastPoppedStackElem()
+	if errObj, ok := value.(*object.Error); ok {
+		return nil, []inputError{{Stage: "runtime", Message: errObj.Message, Line: machine.Line()}}
+	}
 
-			lastPoppedElem := machine.LastPoppedStackElem()
-			io.WriteString(out, lastPoppedElem.Inspect())
-			io.WriteString(out, "\n")
+	session.symbolTable = symbolTable
+	session.constants = comp.Bytecode().Constants
+	return value, nil
+}
+
+func (session *session) parse(input string) (*ast.Program, bool) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		printParserErrors(session.out, p.Errors())
+		return nil, false
+	}
+	return program, true
+}
 
-		} else {
-			evaluated := evaluator.Eval(program, env)
-			if evaluated != nil {
-				io.WriteString(out, evaluated.Inspect())
-				io.WriteString(out, "\n")
+// Runs input and prints its value or what went wrong, reporting whether it ran
+// without errors
+func (session *session) run(input string) bool {
+	value, errors := session.execute(input)
+	if len(errors) > 0 {
+		switch {
+		case errors[0].Stage == "parse":
+			messages := make([]string, len(errors))
+			for i, err := range errors {
+				messages[i] = err.Message
 			}
+			printParserErrors(session.out, messages)
+		case errors[0].Stage == "compile":
+			fmt.Fprintf(session.out, "Whoops, compile error:\n %s\n", errors[0].Message)
+		case session.useVM:
+			fmt.Fprintf(session.out, "Woops! Executing bytecode failed:\n %s\n", errors[0].Message)
 		}
+	}
+
+	if value != nil {
+		io.WriteString(session.out, value.Inspect())
+		io.WriteString(session.out, "\n")
+	}
+	if len(errors) > 0 {
+		return false
+	}
+
+	session.inputs = append(session.inputs, input)
+	return true
+}
+
+// Names of the globals defined so far
+func (session *session) globalNames() []string {
+	if !session.useVM {
+		return session.env.Names()
+	}
 
+	names := []string{}
+	for _, symbol := range session.symbolTable.Symbols() {
+		if symbol.Scope == compiler.GlobalScope {
+			names = append(names, symbol.Name)
+		}
+	}
+	return names
+}
+
+// The value of a global defined so far
+func (session *session) global(name string) (object.Object, bool) {
+	if !session.useVM {
+		return session.env.Get(name)
+	}
+	symbol, ok := session.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope || session.globals[symbol.Index] == nil {
+		return nil, false
+	}
+	return session.globals[symbol.Index], true
+}
+
+// Keeps reading lines after the first while the input is incomplete. At the end
+// of input what was read is returned for its errors to be reported, Ctrl-C
+// in the line editor abandons it
+func readContinuation(readLine func(prompt string) (string, error), line string) (string, error) {
+	input := line
+	for incomplete(input) {
+		next, err := readLine(CONTINUATION_PROMPT)
+		if err == lineedit.ErrInterrupted {
+			return "", err
+		}
+		if err != nil {
+			break
+		}
+		input += "\n" + next
+	}
+	return input, nil
+}
+
+// Input is incomplete while it opens more parentheses, braces or brackets than
+// it closes, or the parser's first complaint is that it ended, e.g. after
+// `let x =`
+func incomplete(input string) bool {
+	depth := 0
+	lex := lexer.New(input)
+	for tok := lex.NextToken(); tok.Type != token.EOF; tok = lex.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth--
+		}
+	}
+	if depth != 0 {
+		return depth > 0
+	}
+
+	p := parser.New(lexer.New(input))
+	p.ParseProgram()
+	errors := p.ErrorList()
+	return len(errors) > 0 && errors[0].Token.Type == token.EOF
+}
+
+// History is kept in memory only if there is no home directory to save it in
+func loadHistory() *lineedit.History {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return lineedit.NewHistory(HISTORY_SIZE)
+	}
+	history, err := lineedit.LoadHistory(filepath.Join(home, HISTORY_FILE), HISTORY_SIZE)
+	if err != nil {
+		return lineedit.NewHistory(HISTORY_SIZE)
+	}
+	return history
+}
+
+// Keywords, builtins and globals starting with word, sorted
+func complete(word string, globals []string) []string {
+	names := append(token.Keywords(), globals...)
+	for _, builtin := range object.Builtins {
+		names = append(names, builtin.Name)
+	}
+
+	seen := map[string]bool{}
+	candidates := []string{}
+	for _, name := range names {
+		if strings.HasPrefix(name, word) && !seen[name] {
+			seen[name] = true
+			candidates = append(candidates, name)
+		}
 	}
+	sort.Strings(candidates)
+	return candidates
 }
 
 func printParserErrors(out io.Writer, errors []string) {
@@ -0,0 +1,173 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestMultiLineInput(t *testing.T) {
+	input := `fn(a,
+  b) {
+  a + b
+}(1,
+2)
+let x =
+5;
+[x,
+x * 2]
+`
+	// Lines aren't echoed, so the prompts run together
+	expected := ">>........3\n>>..5\n>>..[5, 10]\n>>"
+
+	for _, useVM := range []bool{true, false} {
+		var out bytes.Buffer
+		Start(strings.NewReader(input), &out, useVM)
+
+		if out.String() != expected {
+			t.Errorf("useVM=%t: wrong output.\nwant=%q\ngot=%q", useVM, expected, out.String())
+		}
+	}
+}
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"let x = 5;", false},
+		{"let f = fn(x) {", true},
+		{"[1, 2,", true},
+		{"puts((1 + 2)", true},
+		{"let x =", true},
+		{"if (x) { 1 } else", true},
+		{"let x = 5; }", false},
+		{"let = 5; let y =", false},
+	}
+
+	for _, tt := range tests {
+		if got := incomplete(tt.input); got != tt.expected {
+			t.Errorf("incomplete(%q) wrong. want=%t, got=%t", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// Runs input on both engines, returning the output of each
+func runREPL(t *testing.T, input string) map[bool]string {
+	t.Helper()
+	outputs := map[bool]string{}
+	for _, useVM := range []bool{true, false} {
+		var out bytes.Buffer
+		Start(strings.NewReader(input), &out, useVM)
+		outputs[useVM] = out.String()
+	}
+	return outputs
+}
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let x = 5;\nlet y = [x, \"a\"];\n:env\n",
+			">>5\n>>[5, a]\n>>x = 5\ny = [5, a]\n>>",
+		},
+		{
+			":ast let x = -1 +\n2;\n",
+			">>..Program\n  LetStatement x\n    InfixExpression +\n      PrefixExpression -\n        IntegerLiteral 1\n      IntegerLiteral 2\n>>",
+		},
+		{
+			"let x = 1;\n:reset\n:env\nlet x = 2;\n:env\n",
+			">>1\n>>session reset\n>>>>2\n>>x = 2\n>>",
+		},
+		{
+			"let x = 2;\nx * 3\n:engine vm\n:env\n:engine eval\nx\n",
+			">>2\n>>6\n>>switched to vm, replayed 2 inputs\n>>x = 2\n>>switched to eval, replayed 2 inputs\n>>2\n>>",
+		},
+		{
+			":disasm\n:disasm\n",
+			">>disassembly on\n>>disassembly off\n>>",
+		},
+		{
+			":load\n:engine\n:engine js\n:nope\n",
+			">>usage: :load <file>\n>>usage: :engine vm|eval\n>>usage: :engine vm|eval\n>>unknown command :nope, type :help for a list\n>>",
+		},
+	}
+
+	for _, tt := range tests {
+		for useVM, output := range runREPL(t, tt.input) {
+			if output != tt.expected {
+				t.Errorf("useVM=%t: wrong output for %q.\nwant=%q\ngot=%q", useVM, tt.input, tt.expected, output)
+			}
+		}
+	}
+}
+
+func TestBytecodeCommand(t *testing.T) {
+	input := "let x = 1;\n:bytecode let y = x + 2;\n:env\n"
+	for useVM, output := range runREPL(t, input) {
+		for _, expected := range []string{"OpGetGlobal 0", "; x", "OpSetGlobal 1", "; y"} {
+			if !strings.Contains(output, expected) {
+				t.Errorf("useVM=%t: output has no %q.\ngot=%q", useVM, expected, output)
+			}
+		}
+		if !strings.HasSuffix(output, ">>x = 1\n>>") {
+			t.Errorf("useVM=%t: :bytecode defined globals.\ngot=%q", useVM, output)
+		}
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.mk")
+	input := "let x = 1;\nlet y = z;\nlet f = fn(a) { a + x };\nf(1)\n:save " + path + "\n"
+	for useVM, output := range runREPL(t, input) {
+		if !strings.HasSuffix(output, ">>saved 3 inputs to "+path+"\n>>") {
+			t.Errorf("useVM=%t: wrong output.\ngot=%q", useVM, output)
+		}
+
+		saved, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := "let x = 1;\nlet f = fn(a) { a + x };\nf(1)\n"
+		if string(saved) != expected {
+			t.Errorf("useVM=%t: wrong file.\nwant=%q\ngot=%q", useVM, expected, saved)
+		}
+	}
+
+	for useVM, output := range runREPL(t, ":load "+path+"\nf(x + 1)\n:load missing.mk\n") {
+		expected := ">>2\n>>3\n>>could not load missing.mk: open missing.mk: no such file or directory\n>>"
+		if output != expected {
+			t.Errorf("useVM=%t: wrong output.\nwant=%q\ngot=%q", useVM, expected, output)
+		}
+	}
+}
+
+func TestTimeCommand(t *testing.T) {
+	for useVM, output := range runREPL(t, ":time let x = 5;\n:time x\n") {
+		if !regexp.MustCompile(`^>>5\ntook \S+, \d+ steps\n>>5\ntook \S+, \d+ steps\n>>$`).MatchString(output) {
+			t.Errorf("useVM=%t: wrong output.\ngot=%q", useVM, output)
+		}
+	}
+}
+
+func TestFailedInputDefinesNothing(t *testing.T) {
+	input := "let a = 1; let b = c;\na\nlet d = 1 + \"s\";\nd\nlet z = len(1);\nz\nlet d = 2;\nd\n"
+	expected := ">>Whoops, compile error:\n undefined variable c\n" +
+		">>Whoops, compile error:\n undefined variable a\n" +
+		">>Woops! Executing bytecode failed:\n unsupported types for binary operation: INTEGER STRING\n" +
+		">>Whoops, compile error:\n undefined variable d\n" +
+		">>Woops! Executing bytecode failed:\n argument to `len` not supported, got INTEGER\n" +
+		">>Whoops, compile error:\n undefined variable z\n" +
+		">>2\n>>2\n>>"
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out, true)
+	if out.String() != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot=%q", expected, out.String())
+	}
+}
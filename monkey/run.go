@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/cover"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/module"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/vm"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type runOptions struct {
+	engine     *string
+	expression *string
+	profile    *string
+	trace      *bool
+	cover      *bool
+	coverHTML  *string
+}
+
+func addRunFlags(flags *flag.FlagSet) runOptions {
+	return runOptions{
+		engine:     flags.String("engine", "vm", "use 'vm' or 'eval'"),
+		expression: flags.String("e", "", "evaluate the given expression instead of a file"),
+		profile:    flags.String("profile", "", "write a pprof profile of the script's functions and lines to this file (vm engine only)"),
+		trace:      flags.Bool("trace", false, "write every instruction the vm runs to stderr, with the top of its stack"),
+		cover:      flags.Bool("cover", false, "write which lines and branches of the script ran to stderr"),
+		coverHTML:  flags.String("coverhtml", "", "write the script's source annotated with coverage to this HTML file"),
+	}
+}
+
+func runCommand(args []string) int {
+	flags := newFlagSet("monkey run")
+	opts := addRunFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *opts.expression == "" && flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "monkey run: no file or -e expression given")
+		flags.Usage()
+		return 2
+	}
+
+	return runScript(opts, flags.Args())
+}
+
+// With -e every positional argument is passed to the script, otherwise the
+// first one names the file to run
+func runScript(opts runOptions, args []string) int {
+	if *opts.engine != "vm" && *opts.engine != "eval" {
+		fmt.Fprintf(os.Stderr, "unknown engine %q, use 'vm' or 'eval'\n", *opts.engine)
+		return 2
+	}
+	if (*opts.profile != "" || *opts.trace) && *opts.engine != "vm" {
+		fmt.Fprintln(os.Stderr, "profiling and tracing need the vm engine")
+		return 2
+	}
+	covering := *opts.cover || *opts.coverHTML != ""
+	if *opts.profile != "" && *opts.trace || covering && (*opts.profile != "" || *opts.trace) {
+		fmt.Fprintln(os.Stderr, "only one of profiling, tracing and coverage can be used at once")
+		return 2
+	}
+
+	input := []byte(*opts.expression)
+	script := "-e"
+	dir := "."
+	if *opts.expression == "" {
+		source, err := readSource(args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		input = source
+		script = args[0]
+		if args[0] != "-" {
+			dir = filepath.Dir(args[0])
+		}
+		args = args[1:]
+	}
+
+	runtime := object.NewRuntime()
+	runtime.Args = args
+	runtime.Importer = module.NewLoader(*opts.engine, dir)
+
+	var result object.Object
+	var err error
+	if compiler.IsPrecompiled(input) {
+		result, err = executeBytecode(input, script, opts, runtime)
+	} else {
+		result, err = execute(string(input), script, opts, runtime)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *opts.expression != "" && result != nil && result.Type() != object.NULL_OBJ {
+		fmt.Println(result.Inspect())
+	}
+
+	return 0
+}
+
+func readSource(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+func parse(input string) (*ast.Program, error) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, fmt.Errorf("parser errors:\n\t%s", strings.Join(p.Errors(), "\n\t"))
+	}
+	return program, nil
+}
+
+// Runs a whole program with the named engine, returning the value of its last
+// expression statement
+func execute(input string, script string, opts runOptions, runtime *object.Runtime) (object.Object, error) {
+	program, err := parse(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var profile *cover.Profile
+	if *opts.cover || *opts.coverHTML != "" {
+		profile = cover.New(script, input, program)
+	}
+
+	var result object.Object
+	if *opts.engine == "eval" {
+		env := object.NewEnvironment()
+		env.SetRuntime(runtime)
+		if profile != nil {
+			env.SetCoverage(profile)
+		}
+
+		result = evaluator.Eval(program, env)
+		if errObj, ok := result.(*object.Error); ok {
+			err = fmt.Errorf("runtime error: %s", errObj.Message)
+		}
+	} else {
+		comp := compiler.New()
+		err = comp.Compile(program)
+		if err != nil {
+			return nil, fmt.Errorf("compile error: %s", err)
+		}
+		result, err = runVM(comp.Bytecode(), script, opts, runtime, profile)
+	}
+
+	// As with profiles, the coverage of a failing script is still reported
+	if profile != nil {
+		if coverErr := writeCoverage(opts, profile); coverErr != nil && err == nil {
+			err = coverErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Runs a program precompiled by `monkey build`, which only the VM understands
+func executeBytecode(data []byte, script string, opts runOptions, runtime *object.Runtime) (object.Object, error) {
+	if *opts.engine != "vm" {
+		return nil, fmt.Errorf("precompiled bytecode can only run on the vm engine")
+	}
+	if *opts.cover || *opts.coverHTML != "" {
+		return nil, fmt.Errorf("coverage needs the script's source, not precompiled bytecode")
+	}
+
+	bytecode := &compiler.Bytecode{}
+	err := bytecode.UnmarshalBinary(data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = vm.Verify(bytecode)
+	if err != nil {
+		return nil, err
+	}
+
+	return runVM(bytecode, script, opts, runtime, nil)
+}
+
+func runVM(bytecode *compiler.Bytecode, script string, opts runOptions, runtime *object.Runtime, coverage *cover.Profile) (object.Object, error) {
+	machine := vm.New(bytecode)
+	machine.SetRuntime(runtime)
+	if coverage != nil {
+		machine.SetCoverage(coverage)
+	}
+
+	var profiler *vm.Profiler
+	if *opts.profile != "" {
+		profiler = vm.NewProfiler(machine, script, profilePeriod)
+		profiler.Start()
+	}
+	if *opts.trace {
+		trace := bufio.NewWriter(os.Stderr)
+		defer trace.Flush()
+		machine.SetTracer(vm.NewTraceWriter(trace))
+	}
+
+	err := machine.Run()
+
+	// A profile of a failing script is still worth having
+	if profiler != nil {
+		profiler.Stop()
+		if err := writeProfile(*opts.profile, profiler); err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("runtime error: %s", err)
+	}
+
+	return machine.LastPoppedStackElem(), nil
+}
+
+const profilePeriod = time.Millisecond
+
+func writeProfile(path string, profiler *vm.Profiler) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = profiler.Profile().Write(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func writeCoverage(opts runOptions, profile *cover.Profile) error {
+	if *opts.cover {
+		if err := profile.WriteText(os.Stderr); err != nil {
+			return err
+		}
+	}
+	if *opts.coverHTML == "" {
+		return nil
+	}
+	return writeCoverageHTML(*opts.coverHTML, []*cover.Profile{profile})
+}
+
+func writeCoverageHTML(path string, profiles []*cover.Profile) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = cover.WriteHTML(file, profiles)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
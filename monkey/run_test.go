@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunExitCode(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "script.mk")
+	if err := os.WriteFile(script, []byte("let f = fn() { first(1) };\nf();\nputs(2);\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args     []string
+		expected int
+	}{
+		{[]string{"-e", "1 + 2"}, 0},
+		{[]string{"-e", "assertError(len(1))"}, 0},
+		{[]string{"-e", `let check = assertError; check(len(1)); "passed"`}, 1},
+		{[]string{"-e", "len(1)"}, 1},
+		{[]string{"-e", "1 +"}, 1},
+		{[]string{"-e", "1 / 0"}, 1},
+		{[]string{script}, 1},
+	}
+
+	for _, tt := range tests {
+		for _, engine := range []string{"vm", "eval"} {
+			args := append([]string{"-engine", engine}, tt.args...)
+			if code := runCommand(args); code != tt.expected {
+				t.Errorf("monkey run %v: wrong exit code. want=%d, got=%d", args, tt.expected, code)
+			}
+		}
+	}
+}
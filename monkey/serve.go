@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"monkey/playground"
+	"net/http"
+	"os"
+)
+
+// Serves the playground, an editor page running code on the server under the
+// limits given
+func serveCommand(args []string) int {
+	flags := newFlagSet("monkey serve")
+	addr := flags.String("addr", "localhost:8080", "address to listen on, e.g. :8080 for every interface")
+	timeout := flags.Duration("timeout", playground.DefaultLimits.Timeout, "longest a run may take")
+	steps := flags.Int("steps", playground.DefaultLimits.MaxSteps, "most instructions or evaluated nodes a run may take, 0 for no limit")
+	memory := flags.Int64("memory", playground.DefaultLimits.MaxMemory, "most bytes a run may allocate, 0 for no limit")
+	runs := flags.Int("runs", playground.DefaultLimits.MaxRuns, "most runs at once, 0 for no limit")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	limits := playground.DefaultLimits
+	limits.Timeout = *timeout
+	limits.MaxSteps = *steps
+	limits.MaxMemory = *memory
+	limits.MaxRuns = *runs
+
+	fmt.Fprintf(os.Stderr, "serving the playground on http://%s\n", *addr)
+	err := http.ListenAndServe(*addr, playground.NewServer(limits))
+	fmt.Fprintln(os.Stderr, err)
+	return 1
+}
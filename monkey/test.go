@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"monkey/ast"
+	"monkey/cover"
+	"monkey/object"
+	"monkey/tester"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type testOptions struct {
+	engine    *string
+	run       *string
+	verbose   *bool
+	cover     *bool
+	coverHTML *string
+}
+
+func testCommand(args []string) int {
+	flags := newFlagSet("monkey test")
+	opts := testOptions{
+		engine:    flags.String("engine", "vm", "use 'vm' or 'eval'"),
+		run:       flags.String("run", "", "only run tests whose names match this regular expression"),
+		verbose:   flags.Bool("v", false, "list every test run, not only those that fail"),
+		cover:     flags.Bool("cover", false, "report which lines and branches of the tests and the modules they import ran"),
+		coverHTML: flags.String("coverhtml", "", "write the covered sources annotated with coverage to this HTML file"),
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *opts.engine != "vm" && *opts.engine != "eval" {
+		fmt.Fprintf(os.Stderr, "unknown engine %q, use 'vm' or 'eval'\n", *opts.engine)
+		return 2
+	}
+
+	options := tester.Options{Engine: *opts.engine}
+	if *opts.run != "" {
+		match, err := regexp.Compile(*opts.run)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "monkey test: bad -run pattern: %s\n", err)
+			return 2
+		}
+		options.Match = match
+	}
+	profiles := newCoverageProfiles()
+	if *opts.cover || *opts.coverHTML != "" {
+		options.Coverage = profiles.forFile
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := findTestFiles(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "monkey test: no %s files found\n", "*"+tester.FileSuffix)
+		return 1
+	}
+
+	status := 0
+	for _, file := range files {
+		if !testFile(file, options, opts) {
+			status = 1
+		}
+	}
+
+	if *opts.cover {
+		fmt.Println("coverage:")
+		for _, profile := range profiles.list {
+			profile.WriteText(os.Stdout)
+		}
+	}
+	if *opts.coverHTML != "" {
+		if err := writeCoverageHTML(*opts.coverHTML, profiles.list); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// Files named on the command line are run whatever their names, directories
+// are searched for test files
+func findTestFiles(paths []string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() && strings.HasSuffix(file, tester.FileSuffix) {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// Reports on the tests of one file like go test does, returning whether they
+// all passed
+func testFile(file string, options tester.Options, opts testOptions) bool {
+	start := time.Now()
+	results, err := runTestFile(file, options)
+	if err != nil {
+		fmt.Printf("FAIL\t%s\t%s\n", file, err)
+		return false
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Failure == nil {
+			if *opts.verbose {
+				fmt.Printf("--- PASS: %s (%.2fs)\n", result.Name, result.Duration.Seconds())
+			}
+			continue
+		}
+
+		failed++
+		fmt.Printf("--- FAIL: %s (%.2fs)\n", result.Name, result.Duration.Seconds())
+		line := result.Failure.Line
+		if line == 0 {
+			line = result.Line
+		}
+		fmt.Printf("    %s:%d: %s\n", file, line, result.Failure.Message)
+	}
+
+	elapsed := time.Since(start).Seconds()
+	switch {
+	case failed > 0:
+		fmt.Printf("FAIL\t%s\t%.3fs\t%d of %d tests failed\n", file, elapsed, failed, len(results))
+		return false
+	case len(results) == 0:
+		fmt.Printf("ok  \t%s\t%.3fs\tno tests to run\n", file, elapsed)
+	default:
+		fmt.Printf("ok  \t%s\t%.3fs\t%d tests\n", file, elapsed, len(results))
+	}
+	return true
+}
+
+func runTestFile(file string, options tester.Options) ([]tester.Result, error) {
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	program, err := parse(string(source))
+	if err != nil {
+		return nil, err
+	}
+	return tester.Run(file, string(source), program, options)
+}
+
+// Profiles of the test files and the modules they import, shared by all the
+// tests that run them
+type coverageProfiles struct {
+	byFile map[string]*cover.Profile // By absolute path
+	list   []*cover.Profile          // In the order first run
+}
+
+func newCoverageProfiles() *coverageProfiles {
+	return &coverageProfiles{byFile: map[string]*cover.Profile{}}
+}
+
+func (profiles *coverageProfiles) forFile(file string, source string, program *ast.Program) object.Coverage {
+	key, err := filepath.Abs(file)
+	if err != nil {
+		key = file
+	}
+	if profile, ok := profiles.byFile[key]; ok {
+		return profile
+	}
+
+	name := file
+	if wd, err := os.Getwd(); err == nil {
+		if relative, err := filepath.Rel(wd, key); err == nil && !strings.HasPrefix(relative, "..") {
+			name = relative
+		}
+	}
+	profile := cover.New(name, source, program)
+	profiles.byFile[key] = profile
+	profiles.list = append(profiles.list, profile)
+	return profile
+}
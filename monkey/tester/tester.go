@@ -0,0 +1,158 @@
+// Package tester runs the tests of Monkey test files: the top-level functions
+// whose names start with test_, in files whose names end in _test.mk
+package tester
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/module"
+	"monkey/object"
+	"monkey/token"
+	"monkey/vm"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	FileSuffix = "_test.mk"
+	TestPrefix = "test_"
+)
+
+type Options struct {
+	Engine string         // "vm" or "eval"
+	Match  *regexp.Regexp // Only tests whose names match run, nil runs them all
+	Stdout io.Writer      // For the scripts, nil leaves the runtime's default
+
+	// Coverage, if set, gives what records the coverage of the test file and
+	// of each module it imports, or nil to leave one out. It is asked again
+	// for every test
+	Coverage func(file string, source string, program *ast.Program) object.Coverage
+}
+
+// Test is a test function found in a file
+type Test struct {
+	Name       string
+	Line       int
+	Parameters int
+}
+
+type Result struct {
+	Test
+	Failure  *Failure // Nil if the test passed
+	Duration time.Duration
+}
+
+// Failure says why a test failed. Line is that of the failed assertion or of
+// the statement a runtime error came from, or 0 where it isn't known
+type Failure struct {
+	Message string
+	Line    int
+}
+
+// Tests lists the test functions defined at the top level of program, in the
+// order they appear
+func Tests(program *ast.Program) []Test {
+	tests := []Test{}
+	for _, statement := range program.Statements {
+		let, ok := statement.(*ast.LetStatement)
+		if !ok || !strings.HasPrefix(let.Name.Value, TestPrefix) {
+			continue
+		}
+		if fn, ok := let.Value.(*ast.FunctionLiteral); ok {
+			tests = append(tests, Test{Name: let.Name.Value, Line: let.Token.Line, Parameters: len(fn.Parameters)})
+		}
+	}
+	return tests
+}
+
+// Run runs each test of the file at path, whose source was parsed to program,
+// on its own: with a fresh runtime the whole file runs again before the test
+// function is called, so tests can't see each other's changes
+func Run(path string, source string, program *ast.Program, options Options) ([]Result, error) {
+	if options.Engine != "eval" {
+		// Report compile errors once, rather than as the failure of every test
+		if err := compiler.New().Compile(program); err != nil {
+			return nil, fmt.Errorf("compile error: %s", err)
+		}
+	}
+
+	results := []Result{}
+	for _, test := range Tests(program) {
+		if options.Match != nil && !options.Match.MatchString(test.Name) {
+			continue
+		}
+
+		start := time.Now()
+		failure := runTest(path, source, program, test, options)
+		results = append(results, Result{Test: test, Failure: failure, Duration: time.Since(start)})
+	}
+	return results, nil
+}
+
+func runTest(path string, source string, program *ast.Program, test Test, options Options) *Failure {
+	if test.Parameters != 0 {
+		return &Failure{Message: fmt.Sprintf("test functions take no arguments, %s takes %d", test.Name, test.Parameters)}
+	}
+
+	loader := module.NewLoader(options.Engine, filepath.Dir(path))
+	loader.Coverage = options.Coverage
+	runtime := object.NewRuntime()
+	runtime.Importer = loader
+	if options.Stdout != nil {
+		runtime.Stdout = options.Stdout
+	}
+
+	var coverage object.Coverage
+	if options.Coverage != nil {
+		coverage = options.Coverage(path, source, program)
+	}
+
+	// The file followed by a call to the test, made where it is defined
+	call := &ast.ExpressionStatement{
+		Token: token.Token{Type: token.IDENT, Literal: test.Name, Line: test.Line},
+		Expression: &ast.CallExpression{
+			Token:    token.Token{Type: token.LPAREN, Literal: "(", Line: test.Line},
+			Function: &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: test.Name, Line: test.Line}, Value: test.Name},
+		},
+	}
+	statements := append(program.Statements[:len(program.Statements):len(program.Statements)], call)
+	withCall := &ast.Program{Statements: statements}
+
+	var err error
+	var line int // Where the error came from
+	if options.Engine == "eval" {
+		env := object.NewEnvironment()
+		env.SetRuntime(runtime)
+		env.SetCoverage(coverage)
+		if result, ok := evaluator.Eval(withCall, env).(*object.Error); ok {
+			err, line = errors.New(result.Message), result.Line
+		}
+	} else {
+		comp := compiler.New()
+		err = comp.Compile(withCall)
+		if err != nil {
+			return &Failure{Message: fmt.Sprintf("compile error: %s", err)}
+		}
+		machine := vm.New(comp.Bytecode())
+		machine.SetRuntime(runtime)
+		if coverage != nil {
+			machine.SetCoverage(coverage)
+		}
+		err, line = machine.Run(), machine.Line()
+	}
+	if err == nil {
+		return nil
+	}
+
+	var assertion *object.AssertionError
+	if errors.As(runtime.Err(), &assertion) {
+		return &Failure{Message: assertion.Message, Line: assertion.Line}
+	}
+	return &Failure{Message: fmt.Sprintf("runtime error: %s", err), Line: line}
+}
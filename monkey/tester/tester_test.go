@@ -0,0 +1,213 @@
+package tester
+
+import (
+	"bytes"
+	"fmt"
+	"monkey/ast"
+	"monkey/cover"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+const mathModule = `let abs = fn(x) {
+  if (x < 0) { -x } else { x }
+};
+let double = fn(x) { x * 2 };`
+
+const mathTests = `let math = import("math");
+let counter = [];
+puts("setting up");
+let test_abs = fn() {
+  assertEqual(math.abs(-2), 2);
+  assertEqual(math.abs(3), 3);
+};
+let test_double = fn() {
+  let counter = push(counter, 1);
+  assertEqual(len(counter), 1, "tests share state");
+  assertEqual(math.double(2), 5, "double");
+};
+let test_crash = fn() { 1 + true };
+let test_takes_args = fn(x) { x };
+let helper = fn() { assert(false) };`
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
+
+func writeTests(t *testing.T) string {
+	dir := t.TempDir()
+	files := map[string]string{"math.mk": mathModule, "math_test.mk": mathTests}
+	for name, source := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "math_test.mk")
+}
+
+func TestTests(t *testing.T) {
+	expected := []Test{
+		{Name: "test_abs", Line: 4},
+		{Name: "test_double", Line: 8},
+		{Name: "test_crash", Line: 13},
+		{Name: "test_takes_args", Line: 14, Parameters: 1},
+	}
+
+	tests := Tests(parse(t, mathTests))
+	if !reflect.DeepEqual(tests, expected) {
+		t.Errorf("wrong tests.\nwant=%+v\ngot=%+v", expected, tests)
+	}
+}
+
+func TestRun(t *testing.T) {
+	path := writeTests(t)
+	program := parse(t, mathTests)
+
+	for _, engine := range []string{"vm", "eval"} {
+		var out bytes.Buffer
+		results, err := Run(path, mathTests, program, Options{Engine: engine, Stdout: &out})
+		if err != nil {
+			t.Fatalf("%s: Run error: %s", engine, err)
+		}
+
+		failures := map[string]*Failure{}
+		for _, result := range results {
+			failures[result.Name] = result.Failure
+		}
+		runtimeError := map[string]string{
+			"vm":   "runtime error: unsupported types for binary operation: INTEGER BOOLEAN",
+			"eval": "runtime error: type mismatch: INTEGER + BOOLEAN",
+		}[engine]
+		expected := map[string]*Failure{
+			"test_abs":        nil,
+			"test_double":     {Message: "double: expected 5, got 4", Line: 11},
+			"test_crash":      {Message: runtimeError, Line: 13},
+			"test_takes_args": {Message: "test functions take no arguments, test_takes_args takes 1"},
+		}
+		if !reflect.DeepEqual(failures, expected) {
+			t.Errorf("%s: wrong failures.\nwant=%s\ngot=%s", engine, describe(expected), describe(failures))
+		}
+
+		// The file runs again for each test that can be called
+		if out.String() != "setting up\nsetting up\nsetting up\n" {
+			t.Errorf("%s: wrong output. got=%q", engine, out.String())
+		}
+	}
+}
+
+func describe(failures map[string]*Failure) string {
+	var out bytes.Buffer
+	for name, failure := range failures {
+		out.WriteString(name)
+		if failure != nil {
+			fmt.Fprintf(&out, " %s (line %d)", failure.Message, failure.Line)
+		}
+		out.WriteString("; ")
+	}
+	return out.String()
+}
+
+func TestRunMatching(t *testing.T) {
+	path := writeTests(t)
+	options := Options{Engine: "vm", Match: regexp.MustCompile("abs"), Stdout: &bytes.Buffer{}}
+
+	results, err := Run(path, mathTests, parse(t, mathTests), options)
+	if err != nil {
+		t.Fatalf("Run error: %s", err)
+	}
+	if len(results) != 1 || results[0].Name != "test_abs" || results[0].Failure != nil {
+		t.Errorf("wrong results: %+v", results)
+	}
+}
+
+func TestRunCoversModules(t *testing.T) {
+	path := writeTests(t)
+
+	for _, engine := range []string{"vm", "eval"} {
+		profiles := map[string]*cover.Profile{}
+		options := Options{
+			Engine: engine,
+			Match:  regexp.MustCompile("abs"),
+			Stdout: &bytes.Buffer{},
+			Coverage: func(file string, source string, program *ast.Program) object.Coverage {
+				name := filepath.Base(file)
+				if profiles[name] == nil {
+					profiles[name] = cover.New(name, source, program)
+				}
+				return profiles[name]
+			},
+		}
+
+		_, err := Run(path, mathTests, parse(t, mathTests), options)
+		if err != nil {
+			t.Fatalf("%s: Run error: %s", engine, err)
+		}
+
+		module := profiles["math.mk"]
+		if module == nil {
+			t.Fatalf("%s: the module was not covered", engine)
+		}
+		expected := cover.Summary{Lines: 3, LinesRun: 3, Branches: 2, BranchesTaken: 2}
+		if summary := module.Summary(); summary != expected {
+			t.Errorf("%s: wrong module coverage. want=%s, got=%s", engine, expected, summary)
+		}
+	}
+}
+
+func TestRunCompileError(t *testing.T) {
+	input := `let test_a = fn() { missing };`
+	_, err := Run("a_test.mk", input, parse(t, input), Options{Engine: "vm"})
+	if err == nil || err.Error() != "compile error: undefined variable missing" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+func TestEnginesAgree(t *testing.T) {
+	input := `let broken = fn() { len(1) };
+let test_builtin_error = fn() { first(1) };
+let test_kept = fn() { assertError(len(1), "not supported") };
+let test_nested = fn() { assertError(assertError(len(1))) };
+let test_operator = fn() { assertError(1 / 0) };
+let test_indirect = fn() { assertError(broken()) };
+let test_argument = fn() { assertError(len(1 / 0)) };
+let test_aliased = fn() { let check = assertError; check(len(1)) };
+let test_shadowed = fn() { let assertError = fn(x) { x }; assertError(len(1)) };
+let test_rebound = fn() { let assertError = assertError; assertError(len(1)) };`
+	expected := map[string]*Failure{
+		"test_builtin_error": {Message: "runtime error: argument to `first` not supported, got INTEGER", Line: 2},
+		"test_kept":          nil,
+		"test_nested":        {Message: "expected an error, got null", Line: 4},
+		"test_operator":      {Message: "runtime error: division by zero", Line: 5},
+		"test_indirect":      {Message: "runtime error: argument to `len` not supported, got INTEGER", Line: 1},
+		"test_argument":      {Message: "runtime error: division by zero", Line: 7},
+		"test_aliased":       {Message: "runtime error: argument to `len` not supported, got INTEGER", Line: 8},
+		"test_shadowed":      {Message: "runtime error: argument to `len` not supported, got INTEGER", Line: 9},
+		"test_rebound":       {Message: "runtime error: argument to `len` not supported, got INTEGER", Line: 10},
+	}
+
+	for _, engine := range []string{"vm", "eval"} {
+		results, err := Run("agree_test.mk", input, parse(t, input), Options{Engine: engine})
+		if err != nil {
+			t.Fatalf("%s: Run error: %s", engine, err)
+		}
+
+		failures := map[string]*Failure{}
+		for _, result := range results {
+			failures[result.Name] = result.Failure
+		}
+		if !reflect.DeepEqual(failures, expected) {
+			t.Errorf("%s: wrong failures.\nwant=%s\ngot=%s", engine, describe(expected), describe(failures))
+		}
+	}
+}
@@ -1,15 +1,20 @@
 package token
 
+import "sort"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Line    int // Position of the first character, both starting at 1
+	Column  int
 }
 
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	COMMENT = "COMMENT" // Collected by the lexer, never given to the parser
 
 	// Identifiers + literals
 	IDENT  = "IDENT" // add, foobar, x, y, ...
@@ -33,6 +38,7 @@ const (
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":"
+	DOT       = "."
 
 	LPAREN   = "("
 	RPAREN   = ")"
@@ -61,6 +67,16 @@ var keywords = map[string]TokenType{
 	"return": RETURN,
 }
 
+// Keywords returns the reserved words, sorted
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
+
 func LookupIdent(ident string) TokenType {
 	if tok, ok := keywords[ident]; ok {
 		return tok
@@ -0,0 +1,48 @@
+package vm
+
+import (
+	"monkey/code"
+	"monkey/object"
+)
+
+// SetCoverage makes the VM report to coverage every line it enters and which
+// way every if goes. It uses the hook, replacing any other, and nil turns it
+// off. Only the program's own functions are reported to it: functions of
+// imported modules are reported to the coverage set by the module's VM, if any
+func (vm *VM) SetCoverage(coverage object.Coverage) {
+	if coverage == nil {
+		vm.SetHook(nil)
+		return
+	}
+
+	// Registered on the runtime once the VM runs, so whichever VM calls the
+	// functions reports them
+	registered := false
+	vm.SetHook(func(vm *VM) error {
+		if !registered {
+			main := vm.frames[0].closure
+			vm.runtime.SetCoverage(main.Fn, coverage)
+			for _, constant := range main.Constants {
+				if fn, ok := constant.(*object.CompiledFunction); ok {
+					vm.runtime.SetCoverage(fn, coverage)
+				}
+			}
+			registered = true
+		}
+
+		frame := vm.currentFrame()
+		fn := frame.closure.Fn
+		covered := vm.runtime.Coverage(fn)
+		if covered == nil {
+			return nil
+		}
+
+		if isStatementStart(fn.Lines, frame.ip) {
+			covered.Statement(fn.Lines.Line(frame.ip))
+		}
+		if code.Opcode(fn.Instructions[frame.ip]) == code.OpJumpNotTruthy {
+			covered.Branch(fn.Lines.Line(frame.ip), isTruthy(vm.StackTop()))
+		}
+		return nil
+	})
+}
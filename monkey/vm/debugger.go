@@ -0,0 +1,352 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/object"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+var ErrKilled = errors.New("killed by the debugger")
+
+type StopReason string
+
+const (
+	StopEntry      StopReason = "entry"
+	StopBreakpoint StopReason = "breakpoint"
+	StopStep       StopReason = "step"
+	StopPause      StopReason = "pause"
+)
+
+type stepMode int
+
+const (
+	modeRun stepMode = iota
+	modeStepInto
+	modeStepOver
+	modeStepOut
+)
+
+// Debugger pauses a VM at breakpoints and steps through it. It runs on the
+// VM's goroutine: Stopped is called whenever the VM pauses, and execution
+// resumes once it returns, the way chosen by calling Continue, one of the Step
+// methods or Kill from within it.
+//
+// The VM pauses at the start of statements, which are the instructions with
+// an entry in their function's line table. Breakpoints, Pause and Kill may also
+// be used from other goroutines while the VM runs
+type Debugger struct {
+	Stopped     func(debugger *Debugger, reason StopReason)
+	StopOnEntry bool
+
+	vm      *VM
+	globals map[int]string
+
+	mu        sync.Mutex
+	lines     map[int]bool
+	functions map[string]bool
+
+	mode    stepMode
+	depth   int // Frames on the stack when the step began
+	started bool
+	pausing atomic.Bool
+	killed  atomic.Bool
+}
+
+type Variable struct {
+	Name  string
+	Value object.Object
+}
+
+type StackFrame struct {
+	Function string
+	Line     int
+	IP       int
+}
+
+// NewDebugger attaches a debugger to vm, symbols names its globals and may be
+// nil
+func NewDebugger(vm *VM, symbols *compiler.SymbolTable) *Debugger {
+	debugger := &Debugger{
+		vm:        vm,
+		globals:   map[int]string{},
+		lines:     map[int]bool{},
+		functions: map[string]bool{},
+	}
+	if symbols != nil {
+		for _, symbol := range symbols.Symbols() {
+			if symbol.Scope == compiler.GlobalScope {
+				debugger.globals[symbol.Index] = symbol.Name
+			}
+		}
+	}
+	vm.SetHook(debugger.hook)
+	return debugger
+}
+
+func (debugger *Debugger) hook(vm *VM) error {
+	if debugger.killed.Load() {
+		return ErrKilled
+	}
+
+	frame := vm.currentFrame()
+	fn := frame.closure.Fn
+	depth := vm.framesIdx
+	statement := isStatementStart(fn.Lines, frame.ip)
+
+	var reason StopReason
+	switch {
+	case !debugger.started:
+		debugger.started = true
+		if debugger.StopOnEntry {
+			reason = StopEntry
+		}
+	case debugger.mode == modeStepInto:
+		if statement || depth < debugger.depth {
+			reason = StopStep
+		}
+	case debugger.mode == modeStepOver:
+		if depth < debugger.depth || statement && depth <= debugger.depth {
+			reason = StopStep
+		}
+	case debugger.mode == modeStepOut:
+		if depth < debugger.depth {
+			reason = StopStep
+		}
+	}
+
+	if reason == "" && (statement || frame.ip == 0) && debugger.hasBreakpoint(fn, frame.ip, statement) {
+		reason = StopBreakpoint
+	}
+	if reason == "" && debugger.pausing.Load() {
+		reason = StopPause
+	}
+
+	if reason != "" && debugger.Stopped != nil {
+		debugger.mode = modeRun
+		debugger.pausing.Store(false)
+		debugger.Stopped(debugger, reason)
+	}
+	if debugger.killed.Load() {
+		return ErrKilled
+	}
+	return nil
+}
+
+func (debugger *Debugger) hasBreakpoint(fn *object.CompiledFunction, ip int, statement bool) bool {
+	debugger.mu.Lock()
+	defer debugger.mu.Unlock()
+
+	if statement && debugger.lines[fn.Lines.Line(ip)] {
+		return true
+	}
+	return ip == 0 && fn.Name != "" && debugger.functions[fn.Name]
+}
+
+func isStatementStart(lines code.LineTable, ip int) bool {
+	i := sort.Search(len(lines), func(i int) bool { return lines[i].Offset >= ip })
+	return i < len(lines) && lines[i].Offset == ip
+}
+
+func (debugger *Debugger) BreakAtLine(line int) {
+	debugger.mu.Lock()
+	defer debugger.mu.Unlock()
+	debugger.lines[line] = true
+}
+
+func (debugger *Debugger) BreakAtFunction(name string) {
+	debugger.mu.Lock()
+	defer debugger.mu.Unlock()
+	debugger.functions[name] = true
+}
+
+func (debugger *Debugger) ClearLine(line int) {
+	debugger.mu.Lock()
+	defer debugger.mu.Unlock()
+	delete(debugger.lines, line)
+}
+
+func (debugger *Debugger) ClearFunction(name string) {
+	debugger.mu.Lock()
+	defer debugger.mu.Unlock()
+	delete(debugger.functions, name)
+}
+
+func (debugger *Debugger) ClearBreakpoints() {
+	debugger.mu.Lock()
+	defer debugger.mu.Unlock()
+	debugger.lines = map[int]bool{}
+	debugger.functions = map[string]bool{}
+}
+
+// Breakpoints returns the lines and functions the debugger stops at, sorted
+func (debugger *Debugger) Breakpoints() ([]int, []string) {
+	debugger.mu.Lock()
+	defer debugger.mu.Unlock()
+
+	lines := []int{}
+	for line := range debugger.lines {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+
+	functions := []string{}
+	for name := range debugger.functions {
+		functions = append(functions, name)
+	}
+	sort.Strings(functions)
+
+	return lines, functions
+}
+
+func (debugger *Debugger) Continue() {
+	debugger.mode = modeRun
+}
+
+// StepInto stops at the next statement, whichever function it is in
+func (debugger *Debugger) StepInto() {
+	debugger.step(modeStepInto)
+}
+
+// StepOver stops at the next statement of the current function, or of its
+// caller once it returns
+func (debugger *Debugger) StepOver() {
+	debugger.step(modeStepOver)
+}
+
+// StepOut stops as soon as the current function returns
+func (debugger *Debugger) StepOut() {
+	debugger.step(modeStepOut)
+}
+
+func (debugger *Debugger) step(mode stepMode) {
+	debugger.mode = mode
+	debugger.depth = debugger.vm.framesIdx
+}
+
+// Pause stops the VM before its next instruction
+func (debugger *Debugger) Pause() {
+	debugger.pausing.Store(true)
+}
+
+// Kill stops the VM, making Run return ErrKilled
+func (debugger *Debugger) Kill() {
+	debugger.killed.Store(true)
+}
+
+// Frames returns the call stack, innermost first
+func (debugger *Debugger) Frames() []StackFrame {
+	vm := debugger.vm
+	frames := make([]StackFrame, 0, vm.framesIdx)
+
+	for i := vm.framesIdx - 1; i >= 0; i-- {
+		frame := vm.frames[i]
+		fn := frame.closure.Fn
+		frames = append(frames, StackFrame{Function: frameName(fn, i == 0), Line: fn.Lines.Line(frame.ip), IP: frame.ip})
+	}
+	return frames
+}
+
+func (debugger *Debugger) frame(n int) (*Frame, error) {
+	if n < 0 || n >= debugger.vm.framesIdx {
+		return nil, fmt.Errorf("no frame %d, there are %d", n, debugger.vm.framesIdx)
+	}
+	return debugger.vm.frames[debugger.vm.framesIdx-1-n], nil
+}
+
+// Locals returns the named locals of frame n, counting from the innermost,
+// leaving out the ones not assigned yet
+func (debugger *Debugger) Locals(n int) ([]Variable, error) {
+	frame, err := debugger.frame(n)
+	if err != nil {
+		return nil, err
+	}
+
+	variables := []Variable{}
+	for i, name := range frame.closure.Fn.LocalNames {
+		value := debugger.vm.stack[frame.basePointer+i]
+		if name != "" && value != nil {
+			variables = append(variables, Variable{name, value})
+		}
+	}
+	return variables, nil
+}
+
+// Free returns the variables frame n's closure captured
+func (debugger *Debugger) Free(n int) ([]Variable, error) {
+	frame, err := debugger.frame(n)
+	if err != nil {
+		return nil, err
+	}
+
+	variables := []Variable{}
+	names := frame.closure.Fn.FreeNames
+	for i, value := range frame.closure.Free {
+		name := fmt.Sprintf("free %d", i)
+		if i < len(names) {
+			name = names[i]
+		}
+		variables = append(variables, Variable{name, value})
+	}
+	return variables, nil
+}
+
+// Globals returns the globals set so far, by index
+func (debugger *Debugger) Globals() []Variable {
+	variables := []Variable{}
+	for i, value := range debugger.vm.frames[0].closure.Globals {
+		if value == nil {
+			continue
+		}
+		name, ok := debugger.globals[i]
+		if !ok {
+			name = fmt.Sprintf("global %d", i)
+		}
+		variables = append(variables, Variable{name, value})
+	}
+	return variables
+}
+
+// Stack returns the values frame n has pushed and not yet popped, bottom
+// first. For outer frames that ends with the closure they are calling
+func (debugger *Debugger) Stack(n int) ([]object.Object, error) {
+	frame, err := debugger.frame(n)
+	if err != nil {
+		return nil, err
+	}
+
+	top := debugger.vm.sp
+	if n > 0 {
+		top = debugger.vm.frames[debugger.vm.framesIdx-n].basePointer
+	}
+	bottom := frame.basePointer + frame.closure.Fn.NumLocals
+
+	values := []object.Object{}
+	for i := bottom; i < top; i++ {
+		values = append(values, debugger.vm.stack[i])
+	}
+	return values, nil
+}
+
+// Lookup finds name the way code running in frame n would: among its locals,
+// then its free variables, then the globals
+func (debugger *Debugger) Lookup(n int, name string) (object.Object, bool) {
+	locals, err := debugger.Locals(n)
+	if err != nil {
+		return nil, false
+	}
+	free, _ := debugger.Free(n)
+
+	for _, variables := range [][]Variable{locals, free, debugger.Globals()} {
+		for _, variable := range variables {
+			if variable.Name == name {
+				return variable.Value, true
+			}
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,197 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"monkey/compiler"
+	"strings"
+	"testing"
+)
+
+const debuggerInput = `let counter = fn(start) {
+  let step = 2;
+  fn(x) {
+    let total = start + x * step;
+    total
+  }
+};
+let add = counter(10);
+let a = add(1);
+let b = add(a);
+b;`
+
+// Runs the input under a debugger, resuming each stop with the next action and
+// recording where it stopped
+func runDebugger(t *testing.T, setup func(debugger *Debugger), actions ...func(debugger *Debugger)) ([]string, error) {
+	t.Helper()
+
+	comp := compiler.New()
+	err := comp.Compile(parse(debuggerInput))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := New(comp.Bytecode())
+	machine.Runtime().Stdout = io.Discard
+	debugger := NewDebugger(machine, comp.SymbolTable())
+	setup(debugger)
+
+	stops := []string{}
+	debugger.Stopped = func(debugger *Debugger, reason StopReason) {
+		frame := debugger.Frames()[0]
+		stops = append(stops, fmt.Sprintf("%s %s:%d", reason, frame.Function, frame.Line))
+		if len(stops) > len(actions) {
+			t.Fatalf("unexpected stop %s", stops[len(stops)-1])
+		}
+		actions[len(stops)-1](debugger)
+	}
+
+	return stops, machine.Run()
+}
+
+func TestDebuggerStops(t *testing.T) {
+	cont := (*Debugger).Continue
+	into := (*Debugger).StepInto
+	over := (*Debugger).StepOver
+	out := (*Debugger).StepOut
+
+	tests := []struct {
+		name     string
+		setup    func(debugger *Debugger)
+		actions  []func(debugger *Debugger)
+		expected []string
+	}{
+		{
+			"step over main",
+			func(debugger *Debugger) { debugger.StopOnEntry = true },
+			[]func(debugger *Debugger){over, over, over, over, cont},
+			[]string{"entry main:1", "step main:8", "step main:9", "step main:10", "step main:11"},
+		},
+		{
+			"line breakpoint",
+			func(debugger *Debugger) { debugger.BreakAtLine(4) },
+			[]func(debugger *Debugger){cont, cont},
+			[]string{"breakpoint <anonymous>:4", "breakpoint <anonymous>:4"},
+		},
+		{
+			"function breakpoint",
+			func(debugger *Debugger) { debugger.BreakAtFunction("counter") },
+			[]func(debugger *Debugger){into, into, into, cont},
+			[]string{"breakpoint counter:2", "step counter:3", "step main:8", "step main:9"},
+		},
+		{
+			"step into and out",
+			func(debugger *Debugger) { debugger.BreakAtLine(9) },
+			[]func(debugger *Debugger){into, into, out, cont},
+			[]string{"breakpoint main:9", "step <anonymous>:4", "step <anonymous>:5", "step main:9"},
+		},
+		{
+			"pause",
+			func(debugger *Debugger) { debugger.BreakAtLine(9) },
+			[]func(debugger *Debugger){(*Debugger).Pause, cont},
+			[]string{"breakpoint main:9", "pause main:9"},
+		},
+		{
+			"clear breakpoint",
+			func(debugger *Debugger) { debugger.BreakAtLine(4) },
+			[]func(debugger *Debugger){func(debugger *Debugger) { debugger.ClearLine(4) }},
+			[]string{"breakpoint <anonymous>:4"},
+		},
+	}
+
+	for _, tt := range tests {
+		stops, err := runDebugger(t, tt.setup, tt.actions...)
+		if err != nil {
+			t.Errorf("%s: vm error: %s", tt.name, err)
+			continue
+		}
+		if strings.Join(stops, ", ") != strings.Join(tt.expected, ", ") {
+			t.Errorf("%s: wrong stops.\nwant=%q\ngot =%q", tt.name, tt.expected, stops)
+		}
+	}
+}
+
+func TestDebuggerInspection(t *testing.T) {
+	var frames, locals, free, globals, stack, caller string
+	inspect := func(debugger *Debugger) {
+		for _, frame := range debugger.Frames() {
+			frames += fmt.Sprintf("%s:%d ", frame.Function, frame.Line)
+		}
+		locals = formatVariables(debugger.Locals(0))
+		free = formatVariables(debugger.Free(0))
+		globals = formatVariables(debugger.Globals(), nil)
+
+		values, _ := debugger.Stack(0)
+		for _, value := range values {
+			stack += value.Inspect() + " "
+		}
+		values, _ = debugger.Stack(1)
+		caller = fmt.Sprint(len(values), values[len(values)-1].Type())
+	}
+
+	_, err := runDebugger(t,
+		func(debugger *Debugger) { debugger.BreakAtLine(5) },
+		inspect, (*Debugger).Continue)
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		got      string
+		expected string
+	}{
+		{"frames", frames, "<anonymous>:5 main:9 "},
+		{"locals", locals, "x=1 total=12"},
+		{"free", free, "start=10 step=2"},
+		{"globals", globals, "counter=closure add=closure"},
+		{"stack", stack, ""},
+		{"caller stack", caller, "1CLOSURE"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.expected {
+			t.Errorf("wrong %s. want=%q, got=%q", tt.name, tt.expected, tt.got)
+		}
+	}
+}
+
+func TestDebuggerLookup(t *testing.T) {
+	var found []string
+	_, err := runDebugger(t,
+		func(debugger *Debugger) { debugger.BreakAtLine(4) },
+		func(debugger *Debugger) {
+			for _, name := range []string{"x", "step", "add", "total", "missing"} {
+				if _, ok := debugger.Lookup(0, name); ok {
+					found = append(found, name)
+				}
+			}
+			if _, ok := debugger.Lookup(2, "x"); ok {
+				t.Errorf("looked up a frame that doesn't exist")
+			}
+			debugger.Kill()
+		})
+	if !errors.Is(err, ErrKilled) {
+		t.Fatalf("expected ErrKilled, got %v", err)
+	}
+
+	// total is assigned by the statement the debugger stopped at
+	if strings.Join(found, " ") != "x step add" {
+		t.Errorf("wrong variables found: %q", found)
+	}
+}
+
+func formatVariables(variables []Variable, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	parts := []string{}
+	for _, variable := range variables {
+		value := variable.Value.Inspect()
+		if variable.Value.Type() == "CLOSURE" {
+			value = "closure"
+		}
+		parts = append(parts, variable.Name+"="+value)
+	}
+	return strings.Join(parts, " ")
+}
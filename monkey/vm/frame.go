@@ -18,3 +18,14 @@ func NewFrame(closure *object.Closure, basePointer int) *Frame {
 func (frame *Frame) Instructions() code.Instructions {
 	return frame.closure.Fn.Instructions
 }
+
+// How traces, profiles and the debugger call the function fn of a frame
+func frameName(fn *object.CompiledFunction, main bool) string {
+	switch {
+	case main:
+		return "main"
+	case fn.Name == "":
+		return "<anonymous>"
+	}
+	return fn.Name
+}
@@ -0,0 +1,170 @@
+package vm
+
+import (
+	"monkey/object"
+	"monkey/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Profiler attributes the time a VM spends to the Monkey functions and lines
+// it runs, and counts function calls. While it runs, a timer asks for a sample
+// every period and the VM records its call stack before its next instruction,
+// charging it with the time since the previous sample
+type Profiler struct {
+	vm     *VM
+	file   string
+	period time.Duration
+
+	samples map[string]*stackSample // By stack
+	calls   map[*object.CompiledFunction]int64
+
+	sampling atomic.Bool
+	ticker   *time.Ticker
+	done     chan struct{}
+	start    time.Time
+	last     time.Time
+	duration time.Duration
+}
+
+type stackSample struct {
+	stack []pprof.Frame
+	count int64
+	time  time.Duration
+}
+
+// NewProfiler attaches a profiler to vm, file names the script in profiles
+func NewProfiler(vm *VM, file string, period time.Duration) *Profiler {
+	profiler := &Profiler{
+		vm:      vm,
+		file:    file,
+		period:  period,
+		samples: map[string]*stackSample{},
+		calls:   map[*object.CompiledFunction]int64{},
+	}
+	vm.SetHook(profiler.hook)
+	return profiler
+}
+
+// Start begins sampling, Stop ends it
+func (profiler *Profiler) Start() {
+	profiler.start = time.Now()
+	profiler.last = profiler.start
+	profiler.ticker = time.NewTicker(profiler.period)
+	profiler.done = make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-profiler.ticker.C:
+				profiler.sampling.Store(true)
+			case <-profiler.done:
+				return
+			}
+		}
+	}()
+}
+
+func (profiler *Profiler) Stop() {
+	profiler.ticker.Stop()
+	close(profiler.done)
+	profiler.duration = time.Since(profiler.start)
+}
+
+func (profiler *Profiler) hook(vm *VM) error {
+	frame := vm.currentFrame()
+	if frame.ip == 0 && vm.framesIdx > 1 {
+		profiler.calls[frame.closure.Fn]++
+	}
+
+	if profiler.sampling.Load() {
+		profiler.sampling.Store(false)
+		profiler.sample()
+	}
+	return nil
+}
+
+func (profiler *Profiler) sample() {
+	now := time.Now()
+	elapsed := now.Sub(profiler.last)
+	profiler.last = now
+
+	var key strings.Builder
+	stack := make([]pprof.Frame, 0, profiler.vm.framesIdx)
+	for i := profiler.vm.framesIdx - 1; i >= 0; i-- {
+		frame := profiler.vm.frames[i]
+		location := profiler.frame(frame.closure.Fn, i == 0, frame.closure.Fn.Lines.Line(frame.ip))
+		stack = append(stack, location)
+		key.WriteString(location.Function)
+		key.WriteByte(':')
+		key.WriteString(strconv.Itoa(location.StartLine))
+		key.WriteByte(':')
+		key.WriteString(strconv.Itoa(location.Line))
+		key.WriteByte(';')
+	}
+
+	sample, ok := profiler.samples[key.String()]
+	if !ok {
+		sample = &stackSample{stack: stack}
+		profiler.samples[key.String()] = sample
+	}
+	sample.count++
+	sample.time += elapsed
+}
+
+// Functions are told apart by name and the line of their first statement,
+// since anonymous ones share their name
+func (profiler *Profiler) frame(fn *object.CompiledFunction, main bool, line int) pprof.Frame {
+	startLine := 0
+	if len(fn.Lines) > 0 {
+		startLine = fn.Lines[0].Line
+	}
+	return pprof.Frame{Function: frameName(fn, main), File: profiler.file, StartLine: startLine, Line: line}
+}
+
+// Profile returns what was recorded, with samples, time and calls values.
+// Calls are recorded against the first statement of the function called
+func (profiler *Profiler) Profile() *pprof.Profile {
+	profile := &pprof.Profile{
+		SampleTypes: []pprof.ValueType{{Type: "samples", Unit: "count"}, {Type: "time", Unit: "nanoseconds"}, {Type: "calls", Unit: "count"}},
+		DefaultType: "time",
+		PeriodType:  pprof.ValueType{Type: "time", Unit: "nanoseconds"},
+		Period:      profiler.period.Nanoseconds(),
+		Start:       profiler.start,
+		Duration:    profiler.duration,
+	}
+
+	keys := make([]string, 0, len(profiler.samples))
+	for key := range profiler.samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		sample := profiler.samples[key]
+		profile.Samples = append(profile.Samples, pprof.Sample{
+			Stack:  sample.stack,
+			Values: []int64{sample.count, sample.time.Nanoseconds(), 0},
+		})
+	}
+
+	functions := make([]*object.CompiledFunction, 0, len(profiler.calls))
+	for fn := range profiler.calls {
+		functions = append(functions, fn)
+	}
+	sort.Slice(functions, func(i, j int) bool {
+		a, b := profiler.frame(functions[i], false, 0), profiler.frame(functions[j], false, 0)
+		return a.Function < b.Function || a.Function == b.Function && a.StartLine < b.StartLine
+	})
+	for _, fn := range functions {
+		location := profiler.frame(fn, false, 0)
+		location.Line = location.StartLine
+		profile.Samples = append(profile.Samples, pprof.Sample{
+			Stack:  []pprof.Frame{location},
+			Values: []int64{0, 0, profiler.calls[fn]},
+		})
+	}
+	return profile
+}
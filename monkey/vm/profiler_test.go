@@ -0,0 +1,66 @@
+package vm
+
+import (
+	"fmt"
+	"monkey/compiler"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProfiler(t *testing.T) {
+	input := `let fib = fn(n) { if (n < 2) { return n; }; fib(n - 1) + fib(n - 2) };
+let twice = fn(f) { fn(x) { f(f(x)) } };
+fib(10);
+twice(
+  fn(x) { x + 1 }
+)(0);`
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := New(comp.Bytecode())
+	profiler := NewProfiler(machine, "main.mk", time.Hour)
+	profiler.Start()
+	profiler.sampling.Store(true) // Samples the first instruction
+	err = machine.Run()
+	profiler.Stop()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	profile := profiler.Profile()
+	if len(profile.SampleTypes) != 3 || profile.SampleTypes[2].Type != "calls" || profile.Period != time.Hour.Nanoseconds() {
+		t.Fatalf("wrong sample types %v or period %d", profile.SampleTypes, profile.Period)
+	}
+
+	samples := []string{}
+	for _, sample := range profile.Samples {
+		frames := []string{}
+		for _, frame := range sample.Stack {
+			frames = append(frames, fmt.Sprintf("%s:%d:%d", frame.Function, frame.StartLine, frame.Line))
+		}
+		samples = append(samples, fmt.Sprintf("%s %v", strings.Join(frames, " "), sample.Values))
+	}
+	sort.Strings(samples)
+
+	expected := []string{
+		"<anonymous>:2:2 [0 0 1]",
+		"<anonymous>:5:5 [0 0 2]",
+		"fib:1:1 [0 0 177]",
+		"main:1:1 [1 ",
+		"twice:2:2 [0 0 1]",
+	}
+	if len(samples) != len(expected) {
+		t.Fatalf("wrong samples.\nwant=%q\ngot =%q", expected, samples)
+	}
+	for i := range samples {
+		if !strings.HasPrefix(samples[i], expected[i]) {
+			t.Errorf("wrong sample. want=%q, got=%q", expected[i], samples[i])
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"monkey/code"
+	"monkey/object"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Tracer is told about every instruction before the VM runs it. Returning an
+// error stops the VM with it
+type Tracer interface {
+	Trace(step *TraceStep) error
+}
+
+// TraceStep describes the instruction about to run. It and its slices are
+// reused, so they are only valid during the call to Trace
+type TraceStep struct {
+	Frame    *Frame
+	Function string // main, the function's name or <anonymous>
+	Depth    int    // Frames on the call stack, 1 in main
+	Line     int
+	IP       int
+	Opcode   code.Opcode
+	Name     string // Of the opcode
+	Operands []int
+	Stack    []object.Object // Bottom first
+}
+
+// SetTracer makes the VM describe each instruction to tracer. It uses the
+// hook, replacing any other, and nil turns tracing off. Without a tracer the
+// VM pays nothing for this
+func (vm *VM) SetTracer(tracer Tracer) {
+	if tracer == nil {
+		vm.SetHook(nil)
+		return
+	}
+
+	step := &TraceStep{}
+	vm.SetHook(func(vm *VM) error {
+		frame := vm.currentFrame()
+		fn := frame.closure.Fn
+		instructions := fn.Instructions
+
+		step.Frame = frame
+		step.Function = frameName(fn, vm.framesIdx == 1)
+		step.Depth = vm.framesIdx
+		step.Line = fn.Lines.Line(frame.ip)
+		step.IP = frame.ip
+		step.Opcode = code.Opcode(instructions[frame.ip])
+		step.Name = ""
+		step.Operands = step.Operands[:0]
+		if def, err := code.Lookup(instructions[frame.ip]); err == nil {
+			step.Name = def.Name
+			operands, _ := code.ReadOperands(def, instructions[frame.ip+1:])
+			step.Operands = append(step.Operands, operands...)
+		}
+		step.Stack = vm.stack[:vm.sp]
+
+		return tracer.Trace(step)
+	})
+}
+
+// NewTraceWriter returns a tracer writing a line per instruction to out, with
+// where it is, what it is and the top of the stack:
+//
+//	main:4       0013  OpCall 1               [<fn double>, 3]
+//
+// Calls are indented by their depth
+func NewTraceWriter(out io.Writer) Tracer {
+	return &traceWriter{out: out}
+}
+
+type traceWriter struct {
+	out io.Writer
+}
+
+const (
+	tracedStackItems = 4
+	tracedItemLength = 20
+)
+
+func (writer *traceWriter) Trace(step *TraceStep) error {
+	where := fmt.Sprintf("%s%s:%d", strings.Repeat("  ", step.Depth-1), step.Function, step.Line)
+
+	name := step.Name
+	if name == "" {
+		name = fmt.Sprintf("<opcode %d>", step.Opcode)
+	}
+	for _, operand := range step.Operands {
+		name += fmt.Sprintf(" %d", operand)
+	}
+
+	items := []string{}
+	stack := step.Stack
+	if len(stack) > tracedStackItems {
+		items = append(items, "...")
+		stack = stack[len(stack)-tracedStackItems:]
+	}
+	for _, item := range stack {
+		items = append(items, shorten(describe(item)))
+	}
+
+	_, err := fmt.Fprintf(writer.out, "%-12s %04d  %-22s [%s]\n", where, step.IP, name, strings.Join(items, ", "))
+	return err
+}
+
+// Values are shown as in Monkey code where that is shorter than Inspect. The
+// stack may also hold nil below its top, where locals were cleared
+func describe(item object.Object) string {
+	switch item := item.(type) {
+	case nil:
+		return "<nil>"
+	case *object.String:
+		return strconv.Quote(item.Value)
+	case *object.Closure:
+		if item.Fn.Name == "" {
+			return "<fn>"
+		}
+		return "<fn " + item.Fn.Name + ">"
+	case *object.Builtin:
+		return "<builtin>"
+	}
+	return item.Inspect()
+}
+
+func shorten(text string) string {
+	text = strings.ReplaceAll(text, "\n", " ")
+	if utf8.RuneCountInString(text) <= tracedItemLength {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:tracedItemLength-3]) + "..."
+}
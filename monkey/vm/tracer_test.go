@@ -0,0 +1,84 @@
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"monkey/compiler"
+	"strings"
+	"testing"
+)
+
+func TestTraceWriter(t *testing.T) {
+	input := `let double = fn(x) {
+  x * 2
+};
+double(3);`
+	expected := `main:1       0000  OpClosure 1 0          []
+main:1       0004  OpSetGlobal 0          [<fn double>]
+main:4       0007  OpGetGlobal 0          []
+main:4       0010  OpConstant 2           [<fn double>]
+main:4       0013  OpCall 1               [<fn double>, 3]
+  double:2   0000  OpGetLocal 0           [<fn double>, 3]
+  double:2   0002  OpConstant 0           [<fn double>, 3, 3]
+  double:2   0005  OpMul                  [<fn double>, 3, 3, 2]
+  double:2   0006  OpReturnValue          [<fn double>, 3, 6]
+main:4       0015  OpPop                  [6]
+`
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var trace bytes.Buffer
+	machine := New(comp.Bytecode())
+	machine.SetTracer(NewTraceWriter(&trace))
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	if trace.String() != expected {
+		t.Errorf("wrong trace.\nwant=\n%s\ngot=\n%s", expected, trace.String())
+	}
+}
+
+type stopAt struct {
+	opcode string
+	seen   []string
+}
+
+func (tracer *stopAt) Trace(step *TraceStep) error {
+	tracer.seen = append(tracer.seen, step.Name)
+	if step.Name == tracer.opcode {
+		return errors.New("stopped by the tracer")
+	}
+	return nil
+}
+
+func TestTracerStopsVM(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse(`1 + 2; 3 * 4`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	tracer := &stopAt{opcode: "OpMul"}
+	machine := New(comp.Bytecode())
+	machine.SetTracer(tracer)
+	err := machine.Run()
+	if err == nil || err.Error() != "stopped by the tracer" {
+		t.Fatalf("expected the tracer's error, got %v", err)
+	}
+
+	seen := strings.Join(tracer.seen, " ")
+	if seen != "OpConstant OpConstant OpAdd OpPop OpConstant OpConstant OpMul" {
+		t.Errorf("wrong instructions traced: %s", seen)
+	}
+	if machine.StackTop().Inspect() != "4" {
+		t.Errorf("OpMul should not have run, stack top is %s", machine.StackTop().Inspect())
+	}
+
+	machine.SetTracer(nil)
+	if machine.hook != nil {
+		t.Errorf("SetTracer(nil) should remove the hook")
+	}
+}
@@ -0,0 +1,315 @@
+package vm
+
+import (
+	"fmt"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/object"
+)
+
+// Verify checks that every instruction decodes, jumps land on instruction
+// boundaries, constant, global, local, builtin and free variable indices are in
+// range, and each function leaves the stack at the same depth however it
+// reaches an instruction, never popping more than it pushed. Bytecode from the
+// compiler always passes, anything loaded from elsewhere should be verified
+// before it runs
+func Verify(bytecode *compiler.Bytecode) error {
+	freeCounts, err := closureFreeCounts(bytecode)
+	if err != nil {
+		return err
+	}
+
+	main := &verifier{
+		name:         "main",
+		instructions: bytecode.Instructions,
+		constants:    bytecode.Constants,
+		isMain:       true,
+	}
+	err = main.verify()
+	if err != nil {
+		return err
+	}
+
+	for i, constant := range bytecode.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+
+		v := &verifier{
+			name:         fmt.Sprintf("constant %d (fn %s)", i, fn.Name),
+			instructions: fn.Instructions,
+			constants:    bytecode.Constants,
+			numLocals:    fn.NumLocals,
+			numFree:      freeCounts[i],
+		}
+		if fn.Name == "" {
+			v.name = fmt.Sprintf("constant %d", i)
+		}
+		if fn.NumParameters > fn.NumLocals {
+			return fmt.Errorf("%w in %s: %d parameters but only %d locals",
+				compiler.ErrInvalidBytecode, v.name, fn.NumParameters, fn.NumLocals)
+		}
+
+		err := v.verify()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Functions only know their free variables from the OpClosure instructions
+// creating them, which all have to agree
+func closureFreeCounts(bytecode *compiler.Bytecode) (map[int]int, error) {
+	counts := map[int]int{}
+	check := func(name string, ins code.Instructions) error {
+		for offset := 0; offset < len(ins); {
+			def, err := code.Lookup(ins[offset])
+			if err != nil || offset+1+operandsWidth(def) > len(ins) {
+				return nil // Reported with a position by verify
+			}
+			operands, read := code.ReadOperands(def, ins[offset+1:])
+
+			if code.Opcode(ins[offset]) == code.OpClosure {
+				index, numFree := operands[0], operands[1]
+				if count, ok := counts[index]; ok && count != numFree {
+					return fmt.Errorf("%w in %s at %04d: constant %d created with %d free variables, elsewhere with %d",
+						compiler.ErrInvalidBytecode, name, offset, index, numFree, count)
+				}
+				counts[index] = numFree
+			}
+			offset += 1 + read
+		}
+		return nil
+	}
+
+	err := check("main", bytecode.Instructions)
+	if err != nil {
+		return nil, err
+	}
+	for i, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			err := check(fmt.Sprintf("constant %d", i), fn.Instructions)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return counts, nil
+}
+
+func operandsWidth(def *code.Definition) int {
+	width := 0
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+	return width
+}
+
+type verifier struct {
+	name         string
+	instructions code.Instructions
+	constants    []object.Object
+	isMain       bool
+	numLocals    int
+	numFree      int
+
+	boundaries map[int]bool
+}
+
+func (v *verifier) errorf(offset int, format string, a ...interface{}) error {
+	return fmt.Errorf("%w in %s at %04d: %s",
+		compiler.ErrInvalidBytecode, v.name, offset, fmt.Sprintf(format, a...))
+}
+
+func (v *verifier) verify() error {
+	err := v.checkInstructions()
+	if err != nil {
+		return err
+	}
+	return v.checkStack()
+}
+
+// Decodes every instruction, reachable or not, and checks its operands
+func (v *verifier) checkInstructions() error {
+	v.boundaries = map[int]bool{}
+	ins := v.instructions
+
+	for offset := 0; offset < len(ins); {
+		v.boundaries[offset] = true
+
+		def, err := code.Lookup(ins[offset])
+		if err != nil {
+			return v.errorf(offset, "%s", err)
+		}
+		if offset+1+operandsWidth(def) > len(ins) {
+			return v.errorf(offset, "%s is missing operands", def.Name)
+		}
+
+		operands, read := code.ReadOperands(def, ins[offset+1:])
+		err = v.checkOperands(offset, def, operands)
+		if err != nil {
+			return err
+		}
+		offset += 1 + read
+	}
+
+	for offset := 0; offset < len(ins); {
+		def, _ := code.Lookup(ins[offset])
+		operands, read := code.ReadOperands(def, ins[offset+1:])
+
+		op := code.Opcode(ins[offset])
+		if op == code.OpJump || op == code.OpJumpNotTruthy {
+			target := operands[0]
+			// Jumping to the very end finishes the main program
+			if !v.boundaries[target] && !(v.isMain && target == len(ins)) {
+				return v.errorf(offset, "jump target %04d is not an instruction", target)
+			}
+		}
+		offset += 1 + read
+	}
+
+	return nil
+}
+
+func (v *verifier) checkOperands(offset int, def *code.Definition, operands []int) error {
+	switch code.Opcode(v.instructions[offset]) {
+	case code.OpConstant:
+		if operands[0] >= len(v.constants) {
+			return v.errorf(offset, "constant %d out of range, there are %d", operands[0], len(v.constants))
+		}
+
+	case code.OpClosure:
+		if operands[0] >= len(v.constants) {
+			return v.errorf(offset, "constant %d out of range, there are %d", operands[0], len(v.constants))
+		}
+		if _, ok := v.constants[operands[0]].(*object.CompiledFunction); !ok {
+			return v.errorf(offset, "constant %d is %s, not a function", operands[0], v.constants[operands[0]].Type())
+		}
+
+	case code.OpGetGlobal, code.OpSetGlobal:
+		if operands[0] >= GlobalsSize {
+			return v.errorf(offset, "global %d out of range, there are %d", operands[0], GlobalsSize)
+		}
+
+	case code.OpGetLocal, code.OpSetLocal:
+		if operands[0] >= v.numLocals {
+			return v.errorf(offset, "local %d out of range, there are %d", operands[0], v.numLocals)
+		}
+
+	case code.OpGetBuiltin:
+		if operands[0] >= len(object.Builtins) {
+			return v.errorf(offset, "builtin %d out of range, there are %d", operands[0], len(object.Builtins))
+		}
+
+	case code.OpGetFree:
+		if operands[0] >= v.numFree {
+			return v.errorf(offset, "free variable %d out of range, there are %d", operands[0], v.numFree)
+		}
+
+	case code.OpHash:
+		if operands[0]%2 != 0 {
+			return v.errorf(offset, "hash built from %d values, not key value pairs", operands[0])
+		}
+
+	case code.OpCurrentClosure, code.OpReturn:
+		if v.isMain {
+			return v.errorf(offset, "%s outside of a function", def.Name)
+		}
+	}
+
+	return nil
+}
+
+// Follows every path through the instructions, tracking how many values the
+// function has on the stack
+func (v *verifier) checkStack() error {
+	ins := v.instructions
+	depths := map[int]int{}
+	maxDepth := 0
+
+	type path struct{ offset, depth int }
+	worklist := []path{{0, 0}}
+
+	for len(worklist) > 0 {
+		current := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+
+		for offset, depth := current.offset, current.depth; ; {
+			if offset == len(ins) {
+				if !v.isMain {
+					return v.errorf(offset, "function can end without returning")
+				}
+				break
+			}
+
+			if known, ok := depths[offset]; ok {
+				if known != depth {
+					return v.errorf(offset, "stack depth is %d on one path and %d on another", known, depth)
+				}
+				break
+			}
+			depths[offset] = depth
+
+			op := code.Opcode(ins[offset])
+			def, _ := code.Lookup(ins[offset])
+			operands, read := code.ReadOperands(def, ins[offset+1:])
+
+			pops, pushes := stackEffect(op, operands)
+			if depth < pops {
+				return v.errorf(offset, "%s needs %d values on the stack, there are %d", def.Name, pops, depth)
+			}
+			depth += pushes - pops
+			if depth > maxDepth {
+				maxDepth = depth
+			}
+
+			if op == code.OpReturnValue || op == code.OpReturn {
+				break
+			}
+
+			switch op {
+			case code.OpJump:
+				offset = operands[0]
+			case code.OpJumpNotTruthy:
+				worklist = append(worklist, path{operands[0], depth})
+				offset += 1 + read
+			default:
+				offset += 1 + read
+			}
+		}
+	}
+
+	if v.numLocals+maxDepth > StackSize {
+		return v.errorf(0, "needs %d stack slots, the stack has %d", v.numLocals+maxDepth, StackSize)
+	}
+	return nil
+}
+
+// How many values op takes off the stack and puts back on
+func stackEffect(op code.Opcode, operands []int) (int, int) {
+	switch op {
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull,
+		code.OpGetGlobal, code.OpGetLocal, code.OpGetBuiltin,
+		code.OpGetFree, code.OpCurrentClosure:
+		return 0, 1
+	case code.OpPop, code.OpSetGlobal, code.OpSetLocal, code.OpJumpNotTruthy:
+		return 1, 0
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+		code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpIndex:
+		return 2, 1
+	case code.OpMinus, code.OpBang:
+		return 1, 1
+	case code.OpArray, code.OpHash:
+		return operands[0], 1
+	case code.OpClosure:
+		return operands[1], 1 // The free variables
+	case code.OpCall, code.OpTryCall:
+		return operands[0] + 1, 1
+	case code.OpReturnValue:
+		return 1, 0
+	}
+	return 0, 0
+}
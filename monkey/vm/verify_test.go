@@ -0,0 +1,216 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"monkey/compiler"
+	"monkey/object"
+	"strings"
+	"testing"
+)
+
+func TestVerifyRejectsInvalidBytecode(t *testing.T) {
+	tests := []struct {
+		listing  string
+		expected string
+	}{
+		{
+			"OpConstant 0\nOpPop",
+			"in main at 0000: constant 0 out of range, there are 0",
+		},
+		{
+			"OpJump 1\nOpPop",
+			"in main at 0000: jump target 0001 is not an instruction",
+		},
+		{
+			"OpTrue\nOpJumpNotTruthy 9",
+			"in main at 0001: jump target 0009 is not an instruction",
+		},
+		{
+			"OpPop",
+			"in main at 0000: OpPop needs 1 values on the stack, there are 0",
+		},
+		{
+			"OpAdd",
+			"in main at 0000: OpAdd needs 2 values on the stack, there are 0",
+		},
+		{
+			"OpTrue\nOpJumpNotTruthy else\nOpNull\nOpNull\nelse:\nOpNull\nOpPop",
+			"in main at 0006: stack depth is 2 on one path and 0 on another",
+		},
+		{
+			"OpGetLocal 0",
+			"in main at 0000: local 0 out of range, there are 0",
+		},
+		{
+			"OpGetBuiltin 200",
+			"in main at 0000: builtin 200 out of range, there are 14",
+		},
+		{
+			"OpNull\nOpNull\nOpNull\nOpHash 3",
+			"in main at 0003: hash built from 3 values, not key value pairs",
+		},
+		{
+			"OpCurrentClosure",
+			"in main at 0000: OpCurrentClosure outside of a function",
+		},
+		{
+			"OpClosure 0 0\nconstants:\n  0 1",
+			"in main at 0000: constant 0 is INTEGER, not a function",
+		},
+		{
+			"OpClosure 0 0\nOpPop\nfn f [constant 0, 0 params, 0 locals]:\n  OpGetFree 0\n  OpReturnValue",
+			"in constant 0 (fn f) at 0000: free variable 0 out of range, there are 0",
+		},
+		{
+			"OpNull\nOpClosure 0 1\nOpClosure 0 0\nfn [constant 0, 0 params, 0 locals]:\n  OpReturn",
+			"in main at 0005: constant 0 created with 0 free variables, elsewhere with 1",
+		},
+		{
+			"fn f [constant 0, 1 params, 1 locals]:\n  OpGetLocal 0",
+			"in constant 0 (fn f) at 0002: function can end without returning",
+		},
+		{
+			"fn f [constant 0, 0 params, 0 locals]:\n  OpReturnValue",
+			"in constant 0 (fn f) at 0000: OpReturnValue needs 1 values on the stack, there are 0",
+		},
+		{
+			"fn f [constant 0, 2 params, 1 locals]:\n  OpReturn",
+			"in constant 0 (fn f): 2 parameters but only 1 locals",
+		},
+	}
+
+	for _, tt := range tests {
+		bytecode, err := compiler.Assemble(strings.Replace(tt.listing, "fn [", "fn <anonymous> [", 1))
+		if err != nil {
+			t.Fatalf("%q: assemble error: %s", tt.listing, err)
+		}
+
+		err = Verify(bytecode)
+		if err == nil {
+			t.Errorf("%q: expected an error", tt.listing)
+			continue
+		}
+		if !errors.Is(err, compiler.ErrInvalidBytecode) {
+			t.Errorf("%q: error does not wrap ErrInvalidBytecode: %s", tt.listing, err)
+		}
+		expected := "invalid bytecode " + tt.expected
+		if err.Error() != expected {
+			t.Errorf("%q: wrong error.\nwant=%q\ngot =%q", tt.listing, expected, err)
+		}
+	}
+}
+
+func TestVerifyRejectsUndecodableBytecode(t *testing.T) {
+	tests := []struct {
+		bytecode *compiler.Bytecode
+		expected string
+	}{
+		{
+			&compiler.Bytecode{Instructions: []byte{255}},
+			"invalid bytecode in main at 0000: opcode 255 undefined",
+		},
+		{
+			&compiler.Bytecode{Instructions: []byte{0, 0}},
+			"invalid bytecode in main at 0000: OpConstant is missing operands",
+		},
+	}
+
+	for _, tt := range tests {
+		err := Verify(tt.bytecode)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expected, err)
+		}
+	}
+}
+
+// Whatever a corrupted file contains, bytecode that passes the verifier must
+// not crash the VM
+func TestVerifiedBytecodeDoesNotPanic(t *testing.T) {
+	input := `
+let map = fn(arr, f) {
+  let iter = fn(arr, acc) {
+    if (len(arr) == 0) { acc } else { iter(rest(arr), push(acc, f(first(arr)))) }
+  };
+  iter(arr, [])
+};
+let h = {"a": 1, "b": [true, "two"]};
+if (h["a"] > 0) { let x = 2; }
+map([1, 2, 3], fn(x) { -x * 2 + h["a"] / 1 });
+`
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	original := comp.Bytecode()
+
+	programs := [][]byte{original.Instructions}
+	for _, constant := range original.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			programs = append(programs, fn.Instructions)
+		}
+	}
+
+	verified := 0
+	for p, instructions := range programs {
+		for i := range instructions {
+			for _, value := range []byte{0, 1, 2, 3, 9, 19, 24, 29, 128, 255} {
+				mutated := append([]byte{}, instructions...)
+				mutated[i] = value
+
+				bytecode := mutate(original, p, mutated)
+				if Verify(bytecode) != nil {
+					continue
+				}
+				verified++
+
+				func() {
+					defer func() {
+						if r := recover(); r != nil {
+							t.Fatalf("verified bytecode panicked: %v\nprogram %d byte %d set to %d", r, p, i, value)
+						}
+					}()
+					machine := New(bytecode)
+					machine.Runtime().Stdout = io.Discard
+					machine.Runtime().Stdin = strings.NewReader("")
+					machine.Runtime().MaxSteps = 10000 // Jumps may now loop forever
+					machine.Run()
+				}()
+			}
+		}
+	}
+
+	if verified == 0 {
+		t.Fatal("no mutation passed the verifier, the test checks nothing")
+	}
+}
+
+// Copies bytecode, replacing the instructions of main (program 0) or of the
+// nth function in the constant pool
+func mutate(bytecode *compiler.Bytecode, program int, instructions []byte) *compiler.Bytecode {
+	copied := &compiler.Bytecode{
+		Instructions: bytecode.Instructions,
+		Constants:    append([]object.Object{}, bytecode.Constants...),
+	}
+	if program == 0 {
+		copied.Instructions = instructions
+		return copied
+	}
+
+	n := 0
+	for i, constant := range copied.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			n++
+			if n == program {
+				replaced := *fn
+				replaced.Instructions = instructions
+				copied.Constants[i] = &replaced
+				return copied
+			}
+		}
+	}
+	panic(fmt.Sprintf("no program %d", program))
+}
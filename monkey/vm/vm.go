@@ -8,44 +8,60 @@ import (
 )
 
 const GlobalsSize = 65536
-const MaxFrames = 1024
+const MaxFrames = object.MaxCallDepth
 const StackSize = 2048
 
 type VM struct {
-	constants []object.Object
 	stack     []object.Object
 	sp        int // Always points to the next value. Top of stack is stack[sp-1]
-	globals   []object.Object
 	frames    []*Frame
 	framesIdx int
+	runtime   *object.Runtime
+	hook      Hook
 }
 
+// Hook runs before every instruction while set, with the current frame's ip
+// on the instruction. Returning an error stops the VM with it
+type Hook func(vm *VM) error
+
+// Singletons shared by all VMs, compared by identity. They must never be modified
 var TRUE = &object.Boolean{Value: true}
 var FALSE = &object.Boolean{Value: false}
 var NULL = &object.Null{}
 
+// New only reads from bytecode, so one compiled Bytecode can back any number of
+// VMs running concurrently. Each VM gets its own stack, globals and runtime
 func New(bytecode *compiler.Bytecode) *VM {
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
-	mainClosure := &object.Closure{Fn: mainFn}
+	return NewWithGlobalsStore(bytecode, make([]object.Object, GlobalsSize))
+}
+
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, globals []object.Object) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, Lines: bytecode.Lines}
+	mainClosure := &object.Closure{Fn: mainFn, Constants: bytecode.Constants, Globals: globals}
 	mainFrame := NewFrame(mainClosure, 0)
 
 	frames := make([]*Frame, MaxFrames)
 	frames[0] = mainFrame
 
 	return &VM{
-		constants: bytecode.Constants,
 		stack:     make([]object.Object, StackSize),
 		sp:        0,
-		globals:   make([]object.Object, GlobalsSize),
 		frames:    frames,
 		framesIdx: 1,
+		runtime:   object.NewRuntime(),
 	}
 }
 
-func NewWithGlobalsStore(bytecode *compiler.Bytecode, globals []object.Object) *VM {
-	vm := New(bytecode)
-	vm.globals = globals
-	return vm
+func (vm *VM) SetRuntime(runtime *object.Runtime) {
+	vm.runtime = runtime
+}
+
+func (vm *VM) Runtime() *object.Runtime {
+	return vm.runtime
+}
+
+func (vm *VM) SetHook(hook Hook) {
+	vm.hook = hook
 }
 
 func (vm *VM) StackTop() object.Object {
@@ -61,12 +77,22 @@ func (vm *VM) Run() error {
 	var opcode code.Opcode
 
 	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		if err := vm.runtime.Step(); err != nil {
+			return err
+		}
+
 		vm.currentFrame().ip++
 
 		ip = vm.currentFrame().ip
 		instructions = vm.currentFrame().Instructions()
 		opcode = code.Opcode(instructions[ip])
 
+		if vm.hook != nil {
+			if err := vm.hook(vm); err != nil {
+				return err
+			}
+		}
+
 		switch opcode {
 		case code.OpPop:
 			vm.pop()
@@ -81,7 +107,7 @@ func (vm *VM) Run() error {
 			constIndex := code.ReadUint16(instructions[ip+1:])
 			vm.currentFrame().ip += 2
 
-			err := vm.push(vm.constants[constIndex])
+			err := vm.push(vm.currentFrame().closure.Constants[constIndex])
 			if err != nil {
 				return err
 			}
@@ -139,13 +165,19 @@ func (vm *VM) Run() error {
 			globalIndex := code.ReadUint16(instructions[ip+1:])
 			vm.currentFrame().ip += 2
 
-			vm.globals[globalIndex] = vm.pop()
+			vm.currentFrame().closure.Globals[globalIndex] = vm.pop()
 
 		case code.OpGetGlobal:
 			globalIndex := code.ReadUint16(instructions[ip+1:])
 			vm.currentFrame().ip += 2
 
-			err := vm.push(vm.globals[globalIndex])
+			// Globals whose definition failed, e.g. in the REPL, were never set
+			global := vm.currentFrame().closure.Globals[globalIndex]
+			if global == nil {
+				global = NULL
+			}
+
+			err := vm.push(global)
 			if err != nil {
 				return err
 			}
@@ -165,8 +197,14 @@ func (vm *VM) Run() error {
 
 			frame := vm.currentFrame()
 
-			// Read from hole in stack created for local vars
-			err := vm.push(vm.stack[frame.basePointer+int(localIndex)])
+			// Read from hole in stack created for local vars. Locals whose let
+			// sits in a branch that didn't run were never set
+			local := vm.stack[frame.basePointer+int(localIndex)]
+			if local == nil {
+				local = NULL
+			}
+
+			err := vm.push(local)
 			if err != nil {
 				return err
 			}
@@ -189,7 +227,12 @@ func (vm *VM) Run() error {
 			array := vm.buildArray(vm.sp-numElements, vm.sp)
 			vm.sp = vm.sp - numElements
 
-			err := vm.push(array)
+			err := vm.runtime.Allocate(array)
+			if err != nil {
+				return err
+			}
+
+			err = vm.push(array)
 			if err != nil {
 				return err
 			}
@@ -204,6 +247,11 @@ func (vm *VM) Run() error {
 			}
 			vm.sp = vm.sp - numElements
 
+			err = vm.runtime.Allocate(hash)
+			if err != nil {
+				return err
+			}
+
 			err = vm.push(hash)
 			if err != nil {
 				return err
@@ -218,11 +266,11 @@ func (vm *VM) Run() error {
 				return err
 			}
 
-		case code.OpCall:
+		case code.OpCall, code.OpTryCall:
 			numArgs := code.ReadUint8(instructions[ip+1:])
 			vm.currentFrame().ip += 1
 
-			err := vm.executeCall(int(numArgs))
+			err := vm.executeCall(int(numArgs), opcode == code.OpTryCall)
 			if err != nil {
 				return err
 			}
@@ -230,6 +278,12 @@ func (vm *VM) Run() error {
 		case code.OpReturnValue:
 			returnValue := vm.pop()
 
+			// A return outside of any function ends the program with its value,
+			// which pop left right above the stack pointer
+			if vm.framesIdx == 1 {
+				return nil
+			}
+
 			frame := vm.popFrame()
 			// Clear local vars from function and just executed function (-1) off stack
 			vm.sp = frame.basePointer - 1
@@ -332,6 +386,9 @@ func (vm *VM) executeBinaryIntegerOperation(opcode code.Opcode, left, right obje
 	case code.OpMul:
 		result = leftValue * rightValue
 	case code.OpDiv:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero")
+		}
 		result = leftValue / rightValue
 	}
 
@@ -345,7 +402,12 @@ func (vm *VM) executeBinaryStringOperation(opcode code.Opcode, left, right objec
 	leftValue := left.(*object.String).Value
 	rightValue := right.(*object.String).Value
 
-	return vm.push(&object.String{Value: leftValue + rightValue})
+	result := &object.String{Value: leftValue + rightValue}
+	if err := vm.runtime.Allocate(result); err != nil {
+		return err
+	}
+
+	return vm.push(result)
 }
 
 func (vm *VM) executeComparison(opcode code.Opcode) error {
@@ -460,6 +522,10 @@ func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
 }
 
 func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	if holder, ok := left.(object.HasMembers); ok {
+		return vm.executeMemberIndex(holder, index)
+	}
+
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return vm.executeArrayIndex(left, index)
@@ -498,6 +564,30 @@ func (vm *VM) executeHashIndex(hash, index object.Object) error {
 	return vm.push(pair.Value)
 }
 
+func (vm *VM) executeMemberIndex(holder object.HasMembers, index object.Object) error {
+	name, ok := index.(*object.String)
+	if !ok {
+		return fmt.Errorf("unusable as member name: %s", index.Type())
+	}
+
+	member, ok := holder.Member(name.Value)
+	if !ok {
+		return fmt.Errorf("undefined member %s on %s", name.Value, holder.Type())
+	}
+	if member == nil {
+		return vm.push(NULL)
+	}
+
+	return vm.push(member)
+}
+
+// Line returns the source line of the instruction being run, which after Run
+// returns an error is the one that failed
+func (vm *VM) Line() int {
+	frame := vm.currentFrame()
+	return frame.closure.Fn.Lines.Line(frame.ip)
+}
+
 func (vm *VM) currentFrame() *Frame {
 	return vm.frames[vm.framesIdx-1]
 }
@@ -512,7 +602,7 @@ func (vm *VM) popFrame() *Frame {
 	return vm.frames[vm.framesIdx]
 }
 
-func (vm *VM) executeCall(numArgs int) error {
+func (vm *VM) executeCall(numArgs int, keepError bool) error {
 	// Function object sits on stack beneath local vars (including args),
 	// additional -1 since sp points to next empty slot
 	fnIndex := vm.sp - 1 - numArgs
@@ -521,7 +611,7 @@ func (vm *VM) executeCall(numArgs int) error {
 	case *object.Closure:
 		return vm.callClosure(callee, numArgs)
 	case *object.Builtin:
-		return vm.callBuiltin(callee, numArgs)
+		return vm.callBuiltin(callee, numArgs, keepError)
 	default:
 		return fmt.Errorf("calling non-function and non-built-in")
 	}
@@ -532,15 +622,30 @@ func (vm *VM) callClosure(closure *object.Closure, numArgs int) error {
 		return fmt.Errorf("wrong number of arguments: got=%d, expected=%d", numArgs, closure.Fn.NumParameters)
 	}
 
+	if vm.framesIdx >= MaxFrames {
+		return fmt.Errorf("frame overflow")
+	}
+
+	if vm.sp-numArgs+closure.Fn.NumLocals >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+
 	frame := NewFrame(closure, vm.sp-numArgs) // Put basePointer at first arg on stack
 	vm.pushFrame(frame)
-	vm.sp = frame.basePointer + closure.Fn.NumLocals // Create hole in stack to store local vars
+
+	// Create hole in stack to store local vars, clearing what earlier calls left
+	// there so unassigned locals read as unset
+	for i := vm.sp; i < frame.basePointer+closure.Fn.NumLocals; i++ {
+		vm.stack[i] = nil
+	}
+	vm.sp = frame.basePointer + closure.Fn.NumLocals
 
 	return nil
 }
 
 func (vm *VM) pushClosure(constIndex int, numFree int) error {
-	constant := vm.constants[constIndex]
+	current := vm.currentFrame().closure
+	constant := current.Constants[constIndex]
 	fn, ok := constant.(*object.CompiledFunction)
 	if !ok {
 		return fmt.Errorf("not a function %+v", constant)
@@ -553,17 +658,34 @@ func (vm *VM) pushClosure(constIndex int, numFree int) error {
 	}
 	vm.sp = vm.sp - numFree
 
-	closure := &object.Closure{Fn: fn, Free: free}
+	closure := &object.Closure{Fn: fn, Free: free, Constants: current.Constants, Globals: current.Globals}
+	if err := vm.runtime.Allocate(closure); err != nil {
+		return err
+	}
+
 	return vm.push(closure)
 
 }
 
-func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+// An error a builtin returns stops the VM, unless keepError asks for it as a
+// value for assertError. An aborted runtime stops it either way
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int, keepError bool) error {
 	args := vm.stack[vm.sp-numArgs : vm.sp]
 
-	result := builtin.Fn(args...)
+	result := builtin.Fn(vm.runtime, args...)
 	vm.sp = vm.sp - numArgs - 1
 
+	if errObj, ok := result.(*object.Error); ok {
+		frame := vm.currentFrame()
+		object.SetAssertionLine(vm.runtime, frame.closure.Fn.Lines.Line(frame.ip))
+		if err := vm.runtime.Err(); err != nil {
+			return err
+		}
+		if !keepError {
+			return fmt.Errorf("%s", errObj.Message)
+		}
+	}
+
 	if result != nil {
 		vm.push(result)
 	} else {
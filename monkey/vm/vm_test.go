@@ -1,12 +1,17 @@
 package vm
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"monkey/ast"
 	"monkey/compiler"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -33,6 +38,11 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 			t.Fatalf("compiler error: %s", err)
 		}
 
+		err = Verify(comp.Bytecode())
+		if err != nil {
+			t.Fatalf("verifier rejected compiled bytecode: %s", err)
+		}
+
 		vm := New(comp.Bytecode())
 		err = vm.Run()
 		if err != nil {
@@ -247,6 +257,12 @@ func TestConditionals(t *testing.T) {
 		{"if (1 > 2) { 10 }", NULL},
 		{"if (false) { 10 }", NULL},
 		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		{"if (true) { let a = 1; }", NULL},
+		{"if (false) { 10 } else { }; 5", 5},
+		{"let f = fn(x) { if (x) { let a = 1; } else { 2 } }; f(true)", NULL},
+		{"let f = fn(x) { if (x) { let a = 1; } else { 2 } }; f(false)", 2},
+		{"return 7; 8", 7},
+		{"if (true) { return 7; }; 8", 7},
 	}
 
 	runVmTests(t, tests)
@@ -257,11 +273,53 @@ func TestGlobalLetStatements(t *testing.T) {
 		{"let one = 1; one", 1},
 		{"let one = 1; let two = 2; one + two", 3},
 		{"let one = 1; let two = one + one; one + two", 3},
+		{"let a = 1; let a = a + 1; a", 2},
+		{"fn(a) { let a = a * 10; a }(2)", 20},
 	}
 
 	runVmTests(t, tests)
 }
 
+// A global defined by input that then failed, as in the REPL, was never set
+func TestUnsetGlobal(t *testing.T) {
+	symbolTable := compiler.NewSymbolTable()
+	symbolTable.Define("unset")
+
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	err := comp.Compile(parse(`unset`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := NewWithGlobalsStore(comp.Bytecode(), make([]object.Object, GlobalsSize))
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	testExpectedObject(t, NULL, vm.LastPoppedStackElem())
+}
+
+// A local whose let sits in a branch that didn't run was never set
+func TestUnsetLocal(t *testing.T) {
+	tests := []vmTestCase{
+		{`let f = fn() { if (false) { let x = 1; }; x }; f()`, NULL},
+		{`let f = fn(a) { if (a) { let x = 1; }; fn() { x } }; f(false)()`, NULL},
+	}
+
+	runVmTests(t, tests)
+
+	comp := compiler.New()
+	err := comp.Compile(parse(`let f = fn() { if (false) { let x = 1; }; x + 1 }; f()`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	err = New(comp.Bytecode()).Run()
+	if err == nil || err.Error() != "unsupported types for binary operation: NULL INTEGER" {
+		t.Errorf("wrong VM error. got=%v", err)
+	}
+}
+
 func TestStringExpressions(t *testing.T) {
 	tests := []vmTestCase{
 		{`"monkey"`, "monkey"},
@@ -587,47 +645,45 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
-		{
-			`len(1)`,
-			&object.Error{
-				Message: "argument to `len` not supported, got INTEGER",
-			},
-		},
-		{`len("one", "two")`,
-			&object.Error{
-				Message: "wrong number of arguments to `len`. got=2, want=1",
-			},
-		},
 		{`len([1, 2, 3])`, 3},
 		{`len([])`, 0},
 		{`puts("hello", "world!")`, NULL},
 		{`first([1, 2, 3])`, 1},
 		{`first([])`, NULL},
-		{`first(1)`,
-			&object.Error{
-				Message: "argument to `first` not supported, got INTEGER",
-			},
-		},
 		{`last([1, 2, 3])`, 3},
 		{`last([])`, NULL},
-		{`last(1)`,
-			&object.Error{
-				Message: "argument to `last` not supported, got INTEGER",
-			},
-		},
 		{`rest([1, 2, 3])`, []int{2, 3}},
 		{`rest([])`, NULL},
 		{`push([], 1)`, []int{1}},
-		{`push(1, 1)`,
-			&object.Error{
-				Message: "argument to `push` must be ARRAY, got INTEGER",
-			},
-		},
 	}
 
 	runVmTests(t, tests)
 }
 
+func TestBuiltinErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments to `len`. got=2, want=1"},
+		{`first(1)`, "argument to `first` not supported, got INTEGER"},
+		{`last(1)`, "argument to `last` not supported, got INTEGER"},
+		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`let f = fn() { rest(1) }; f(); 2`, "argument to `rest` not supported, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = New(comp.Bytecode()).Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong VM error for %q. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
 func TestClosures(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -782,3 +838,476 @@ func TestRecursiveFibonacci(t *testing.T) {
 
 	runVmTests(t, tests)
 }
+
+func TestHostObjects(t *testing.T) {
+	counterType := object.NewHostType("COUNTER").
+		Method("add", func(host *object.Host, args ...object.Object) object.Object {
+			counter := host.Value.(*int64)
+			*counter += args[0].(*object.Integer).Value
+			return &object.Integer{Value: *counter}
+		}).
+		Property("value", func(host *object.Host) object.Object {
+			return &object.Integer{Value: *host.Value.(*int64)}
+		}).
+		Property("nothing", func(host *object.Host) object.Object {
+			return nil
+		})
+
+	tests := []vmTestCase{
+		{`counter.add(2); counter.add(3)`, 5},
+		{`counter.add(4); counter.value`, 4},
+		{`let add = counter.add; add(1); add(1)`, 2},
+		{`counter["value"]`, 0},
+		{`counter.nothing`, NULL},
+	}
+
+	for _, tt := range tests {
+		var count int64
+		symbolTable := compiler.NewSymbolTable()
+		for i, v := range object.Builtins {
+			symbolTable.DefineBuiltin(i, v.Name)
+		}
+		symbol := symbolTable.Define("counter")
+
+		globals := make([]object.Object, GlobalsSize)
+		globals[symbol.Index] = counterType.Wrap(&count)
+
+		comp := compiler.NewWithState(symbolTable, []object.Object{})
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := NewWithGlobalsStore(comp.Bytecode(), globals)
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+func TestUndefinedHostMember(t *testing.T) {
+	symbolTable := compiler.NewSymbolTable()
+	symbol := symbolTable.Define("host")
+
+	globals := make([]object.Object, GlobalsSize)
+	globals[symbol.Index] = object.NewHostType("THING").Wrap(nil)
+
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	err := comp.Compile(parse(`host.missing`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := NewWithGlobalsStore(comp.Bytecode(), globals)
+	err = vm.Run()
+	if err == nil {
+		t.Fatalf("expected VM error but resulted in none.")
+	}
+
+	expected := "undefined member missing on THING"
+	if err.Error() != expected {
+		t.Fatalf("wrong VM error: want=%q, got=%q", expected, err)
+	}
+}
+
+func TestHostNamedLikeBuiltinType(t *testing.T) {
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	symbol := symbolTable.Define("host")
+
+	globals := make([]object.Object, GlobalsSize)
+	globals[symbol.Index] = &object.Host{Kind: &object.HostType{Name: object.INTEGER_OBJ}}
+
+	tests := []vmTestCase{
+		{`host + 1`, "unsupported types for binary operation: HOST INTEGER"},
+		{`host > 1`, "unknown operator: 10 (HOST INTEGER)"},
+		{`len(host)`, "argument to `len` not supported, got HOST"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.NewWithState(symbolTable.Copy(), []object.Object{})
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = NewWithGlobalsStore(comp.Bytecode(), globals).Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong VM error for %q. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestExecutionBudgets(t *testing.T) {
+	fibonacci := `
+    let fibonacci = fn(x) {
+        if (x < 2) { return x; }
+        fibonacci(x - 1) + fibonacci(x - 2);
+    };
+    fibonacci(15);
+    `
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		input    string
+		maxSteps int
+		ctx      context.Context
+		expected error
+	}{
+		{fibonacci, 0, context.Background(), nil},
+		{fibonacci, 100, context.Background(), object.ErrStepLimitExceeded},
+		{fibonacci, 0, cancelled, object.ErrCancelled},
+		{fibonacci, 0, cancelled, context.Canceled},
+		{`let f = fn(x) { f(x + 1) }; f(0);`, 50, context.Background(), object.ErrStepLimitExceeded},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		runtime := object.NewRuntime()
+		runtime.Context = tt.ctx
+		runtime.MaxSteps = tt.maxSteps
+
+		vm := New(comp.Bytecode())
+		vm.SetRuntime(runtime)
+		err = vm.Run()
+
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("wrong VM error: want=%v, got=%v", tt.expected, err)
+		}
+		if tt.expected != nil && !errors.Is(runtime.Err(), tt.expected) {
+			t.Errorf("wrong runtime error: want=%v, got=%v", tt.expected, runtime.Err())
+		}
+	}
+}
+
+func TestInfiniteRecursion(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse(`let f = fn() { f() }; f();`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err == nil {
+		t.Fatalf("expected VM error but resulted in none.")
+	}
+
+	if err.Error() != "frame overflow" {
+		t.Fatalf("wrong VM error: want=%q, got=%q", "frame overflow", err)
+	}
+}
+
+func TestMemoryAccounting(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected object.MemoryStats
+	}{
+		{`1 + 2`, object.MemoryStats{Bytes: 0, Objects: 0}},
+		{`[1, 2, 3]`, object.MemoryStats{Bytes: 72, Objects: 1}},
+		{`"ab" + "c"`, object.MemoryStats{Bytes: 19, Objects: 1}},
+		{`{1: 2}`, object.MemoryStats{Bytes: 104, Objects: 1}},
+		{`push([1], 2)`, object.MemoryStats{Bytes: 96, Objects: 2}},
+		{`fn(a) { fn() { a } }(1)`, object.MemoryStats{Bytes: 176, Objects: 2}},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		stats := vm.Runtime().MemoryStats()
+		if stats != tt.expected {
+			t.Errorf("wrong memory stats for %q. want=%+v, got=%+v", tt.input, tt.expected, stats)
+		}
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	tests := []string{
+		`let grow = fn(s) { grow(s + s) }; grow("monkey");`,
+		`let fill = fn(arr) { fill(push(arr, arr)) }; fill([]);`,
+		`let nest = fn(h) { nest({"h": h, "a": [h, h, h]}) }; nest({});`,
+	}
+
+	for _, input := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		runtime := object.NewRuntime()
+		runtime.MaxMemory = 4096
+
+		vm := New(comp.Bytecode())
+		vm.SetRuntime(runtime)
+		err = vm.Run()
+
+		if !errors.Is(err, object.ErrMemoryLimit) {
+			t.Errorf("wrong VM error for %q: want=%v, got=%v", input, object.ErrMemoryLimit, err)
+		}
+	}
+}
+
+func TestConcurrentRunsShareBytecode(t *testing.T) {
+	input := `
+    let counter = fn(start) {
+        fn(step) { start + step };
+    };
+    let names = {"one": 1, "two": 2, "three": 3};
+    let total = fn(keys) {
+        if (len(keys) == 0) { return 0; }
+        names[first(keys)] + total(rest(keys));
+    };
+    counter(total(["one", "two", "three"]))(len(push([], "x")));
+    `
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	var wg sync.WaitGroup
+	results := make([]object.Object, 32)
+	errs := make([]error, len(results))
+
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			vm := New(bytecode)
+			errs[i] = vm.Run()
+			results[i] = vm.LastPoppedStackElem()
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range results {
+		if errs[i] != nil {
+			t.Fatalf("vm error: %s", errs[i])
+		}
+		testExpectedObject(t, 7, results[i])
+	}
+}
+
+func TestScriptIO(t *testing.T) {
+	tests := []struct {
+		input          string
+		stdin          string
+		expected       interface{}
+		expectedOutput string
+	}{
+		{`puts("hello", 1, [1, "two"])`, "", NULL, "hello\n1\n[1, two]\n"},
+		{`print("a", 1); print("b")`, "", NULL, "a1b"},
+		{`gets()`, "first\nsecond\n", "first", ""},
+		{`gets(); readline()`, "first\r\nsecond", "second", ""},
+		{`gets(); gets()`, "only\n", NULL, ""},
+		{`puts(gets() + "!")`, "hey\n", NULL, "hey!\n"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		var stdout bytes.Buffer
+		runtime := object.NewRuntime()
+		runtime.Stdout = &stdout
+		runtime.Stdin = strings.NewReader(tt.stdin)
+
+		vm := New(comp.Bytecode())
+		vm.SetRuntime(runtime)
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+		if stdout.String() != tt.expectedOutput {
+			t.Errorf("wrong output. want=%q, got=%q", tt.expectedOutput, stdout.String())
+		}
+	}
+}
+
+func TestArgsBuiltin(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse(`let a = args(); [len(a), first(a), last(a)]`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	runtime := object.NewRuntime()
+	runtime.Args = []string{"one", "two"}
+
+	vm := New(comp.Bytecode())
+	vm.SetRuntime(runtime)
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	result := vm.LastPoppedStackElem().(*object.Array)
+	testExpectedObject(t, 2, result.Elements[0])
+	testExpectedObject(t, "one", result.Elements[1])
+	testExpectedObject(t, "two", result.Elements[2])
+}
+
+// Runs hand written bytecode, see compiler.Assemble for the listing format
+func runAssemblyTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		bytecode, err := compiler.Assemble(tt.input)
+		if err != nil {
+			t.Fatalf("assemble error: %s", err)
+		}
+
+		err = Verify(bytecode)
+		if err != nil {
+			t.Fatalf("verify error: %s", err)
+		}
+
+		vm := New(bytecode)
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+func TestAssembledBytecode(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			// Monkey has no loops, but the VM happily jumps backwards
+			`
+    OpConstant 0
+    OpSetGlobal 0           ; sum = 0
+    OpConstant 1
+    OpSetGlobal 1           ; n = 10
+loop:
+    OpGetGlobal 1
+    OpConstant 0
+    OpGreaterThan
+    OpJumpNotTruthy done    ; while n > 0
+    OpGetGlobal 0
+    OpGetGlobal 1
+    OpAdd
+    OpSetGlobal 0           ; sum = sum + n
+    OpGetGlobal 1
+    OpConstant 2
+    OpSub
+    OpSetGlobal 1           ; n = n - 1
+    OpJump loop
+done:
+    OpGetGlobal 0
+    OpPop
+
+constants:
+    0  0
+    1  10
+    2  1
+`,
+			55,
+		},
+		{
+			`
+    OpConstant 0
+    OpClosure 1 1
+    OpConstant 2
+    OpCall 1
+    OpPop
+
+fn greet [constant 1, 1 params, 1 locals]:
+    OpGetFree 0
+    OpGetLocal 0
+    OpAdd
+    OpReturnValue
+
+constants:
+    0  "hello "
+    1  fn greet
+    2  "monkey"
+`,
+			"hello monkey",
+		},
+	}
+
+	runAssemblyTests(t, tests)
+}
+
+func TestDivisionByZero(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse(`let half = fn(x) { x / 0 }; half(4)`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err = New(comp.Bytecode()).Run()
+	if err == nil || err.Error() != "division by zero" {
+		t.Fatalf("wrong VM error: want=%q, got=%v", "division by zero", err)
+	}
+}
+
+func TestAssertions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // Error the VM stopped with, if any
+	}{
+		{`assert(true); assert(1 == 1, "equal"); assert(0)`, ""},
+		{`assert(false)`, "assertion failed on line 1: got false"},
+		{"1;\nassert(1 > 2, \"order\")", "assertion failed on line 2: order: got false"},
+		{`assertEqual([1, {"a": "b"}], [1, {"a": "b"}]); assertEqual(if (false) { 1 }, if (false) { 2 })`, ""},
+		{`assertEqual([1, "2"], [1, 2])`, `assertion failed on line 1: expected [1, 2], got [1, "2"]`},
+		{`assertEqual({"a": 1}, {"a": 1, "b": 2}, "hash")`, `assertion failed on line 1: hash: expected {"a": 1, "b": 2}, got {"a": 1}`},
+		{`assertError(len(1)); assertError(first(1), "not supported")`, ""},
+		{`assertError(len([]))`, "assertion failed on line 1: expected an error, got 0"},
+		{`assertError(len(1), "missing")`, "assertion failed on line 1: expected an error containing \"missing\", got \"argument to `len` not supported, got INTEGER\""},
+		{"let check = fn(x) {\n  assertEqual(x, 2);\n};\ncheck(3);", "assertion failed on line 2: expected 2, got 3"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.expected {
+			t.Errorf("wrong VM error for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}